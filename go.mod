@@ -1,6 +1,6 @@
 module goInAction2/assignment
 
-go 1.15
+go 1.23
 
 require (
 	github.com/satori/go.uuid v1.2.0
@@ -3,17 +3,25 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"goInAction2/assignment/packages/dsa"
+	"goInAction2/assignment/packages/query"
+	"goInAction2/assignment/packages/sse"
+	"goInAction2/assignment/packages/throttle"
+	"goInAction2/assignment/packages/totp"
+	"goInAction2/assignment/packages/webhook"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	uuid "github.com/satori/go.uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -21,65 +29,73 @@ import (
 
 func index(res http.ResponseWriter, req *http.Request) {
 
-	var wg sync.WaitGroup
 	checkuser := getUser(res, req)
 	myCookie, _ := req.Cookie("myCookie")
 	if myCookie == nil {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
-	} else {
-		loggedin = mapSessions[myCookie.Value]
 	}
 
 	if alreadyLoggedIn(req) {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed main menu.", loggedin.Name, loggedin.Admin))
+		generalRecord.AddLog(fmt.Sprintf("Username %s (Role: %s) accessed main menu.", checkuser.Name, checkuser.Role))
 	} else {
 		generalRecord.AddLog("New User (not logged in) accessed main menu.")
 	}
 
-	if alreadyLoggedIn(req) && !loggedin.Admin {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			mytickets = &dsa.AVLtree{
-				Root:     nil,
-				Sortfunc: dsa.ByTicketID,
-			}
-			mytickets.Root = dsa.Mytickets(ticketlog.Root, mytickets.Root, dsa.ByTicketID, loggedin.Name)
-		}()
+	// Show the user's chosen home view, if they have one and can still see it
+	var home dsa.Filter
+	var homeTickets [][]string
+	var homeErr string
+	if filter, ok := filters.GetFilter(checkuser.Home); ok && checkuser.Home != 0 && (filter.Owner == checkuser.Name || filter.Shared) {
+		home = filter
+		tickets, err := runQuery(filter.Query, checkuser.Name)
+		if err != nil {
+			homeErr = err.Error()
+		}
+		homeTickets = tickets
+	}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			myassigns = &dsa.AVLtree{
-				Root:     nil,
-				Sortfunc: dsa.ByTicketID,
-			}
-			myassigns.Root = dsa.Myassigns(ticketlog.Root, myassigns.Root, dsa.ByTicketID, loggedin.Name)
-		}()
+	data := struct {
+		dsa.User
+		Unread      int
+		HomeView    dsa.Filter
+		HomeTickets [][]string
+		HomeError   string
+	}{
+		checkuser,
+		inbox.Unread(checkuser.Name),
+		home,
+		homeTickets,
+		homeErr,
 	}
-	tpl.ExecuteTemplate(res, "index.gohtml", checkuser)
-	wg.Wait()
+	tpl.ExecuteTemplate(res, "index.gohtml", data)
 }
 
 // Login Screen
 
 func signup(res http.ResponseWriter, req *http.Request) {
 
-	if alreadyLoggedIn(req) {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed sign up. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog("New User (not logged in) accessed sign up page.")
-	}
-
-	if alreadyLoggedIn(req) {
+	if user, ok := sessionUser(req); ok {
+		generalRecord.AddLog(fmt.Sprintf("Username %s (Role: %s) accessed sign up. Redirected to main menu.", user.Name, user.Role))
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
+	generalRecord.AddLog("New User (not logged in) accessed sign up page.")
 
 	myUser, err := newacc(res, req)
 	if err == nil {
-		tpl.ExecuteTemplate(res, "signup.gohtml", myUser)
+		data := struct {
+			dsa.User
+			Roles   []dsa.Role
+			Default dsa.Role
+			Rules   string
+		}{
+			myUser,
+			nil,
+			signupRole,
+			passwords.Describe(),
+		}
+		tpl.ExecuteTemplate(res, "signup.gohtml", data)
 	}
 }
 
@@ -114,44 +130,276 @@ func login(res http.ResponseWriter, req *http.Request) {
 
 		password := <-passwordChan
 
-		// check if user exist with username
+		// Refuse attempts on a throttled username or from a throttled address before checking anything else
+		addr := clientAddr(req)
+		if wait := max(loginsByUser.Wait(username), loginsByAddr.Wait(addr)); wait > 0 {
+			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s from %s (throttled for %s).", username, addr, wait.Round(time.Second)))
+			tooManyAttempts(res, wait)
+			return
+		}
+		// check if user exist with username, and match the password entered
+		// An unknown username is checked against a placeholder hash, so that it gets the same response, after the same time, as a wrong password
 		ok, myUserNode := dsa.SearchUser(users, username)
-		if !ok {
-			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s (invalid username).", username))
-			http.Error(res, "Username and/or password do not match", http.StatusUnauthorized)
+		hash := dummyHash
+		if ok {
+			hash = myUserNode.User.Pw
+		}
+		err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if !ok || err != nil {
+			reason := "wrong password"
+			if !ok {
+				reason = "invalid username"
+			}
+			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s from %s (%s).", username, addr, reason))
+			loginFailed(res, username, addr)
 			return
 		}
-		// check if user already has existing session, i.e logged in already
-		for _, user := range mapSessions {
-			if user.Name == username {
-				userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s (already logged in).", username))
-				http.Error(res, "Inputted user already logged in!", http.StatusUnauthorized)
-				return
+		// Upgrade the stored hash if it was made with a lower cost than currently configured
+		if passwords.NeedsRehash(myUserNode.User.Pw) {
+			// Only the hash is replaced, and not if the password was changed, or the account deleted, while this one was being checked
+			stale := myUserNode.User.Pw
+			if hash, err := passwords.Hash(password); err == nil {
+				if upgraded, ok := dsa.UpdateUser(users, username, func(user *dsa.User) bool {
+					if !bytes.Equal(user.Pw, stale) {
+						return false
+					}
+					user.Pw = hash
+					return true
+				}); ok {
+					myUserNode.User = upgraded
+					userRecord.AddLog(fmt.Sprintf("Password hash for username %s upgraded to bcrypt cost %d.", upgraded.Name, passwords.Cost))
+				}
 			}
 		}
-		// Matching of password entered
-		err := bcrypt.CompareHashAndPassword(myUserNode.User.Pw, []byte(password))
-		if err != nil {
-			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s (wrong password).", username))
-			http.Error(res, "Username and/or password do not match", http.StatusForbidden)
+		// Users with a second factor, or who must enroll one, continue to the second step
+		if user := myUserNode.User; user.Enrolled() || requires2FA(user) {
+			secret := ""
+			if !user.Enrolled() {
+				if secret, err = totp.GenerateSecret(); err != nil {
+					http.Error(res, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+			}
+			beginPendingLogin(res, user, secret)
+			userRecord.AddLog(fmt.Sprintf("Password accepted for username %s; awaiting second factor.", user.Name))
+			http.Redirect(res, req, "/login2fa", http.StatusSeeOther)
 			return
 		}
 		// create session
-		id := uuid.NewV4()
-		myCookie := &http.Cookie{
-			Name:  "myCookie",
-			Value: id.String(),
-		}
-		http.SetCookie(res, myCookie)
-		mapSessions[myCookie.Value] = myUserNode.User
-		generalRecord.AddLog(fmt.Sprintf("MyCookie: New session created for username %s.", myUserNode.User.Name))
-		userRecord.AddLog(fmt.Sprintf("Successful sign-in using username %s (Admin: %t).", myUserNode.User.Name, myUserNode.User.Admin))
+		loginsByUser.Reset(username)
+		if err := startSession(res, req, myUserNode.User); err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
 	tpl.ExecuteTemplate(res, "login.gohtml", nil)
 }
 
+// login2fa is the second step of logging in, after the password has been accepted: the user enters a code from their authenticator app or a recovery code.
+// Users required to have a second factor who have not enrolled one must do so here before they are logged in, and are shown their recovery codes once.
+func login2fa(res http.ResponseWriter, req *http.Request) {
+
+	if alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+	cookie, err := req.Cookie("pendingLogin")
+	if err != nil {
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	pendingMu.Lock()
+	pending, ok := pendingLogins[cookie.Value]
+	pendingMu.Unlock()
+	if !ok || time.Now().After(pending.Expires) {
+		endPendingLogin(res, req)
+		http.Error(res, "Login has expired; please log in again.", http.StatusUnauthorized)
+		return
+	}
+	found, myUserNode := dsa.SearchUser(users, pending.User)
+	if !found {
+		endPendingLogin(res, req)
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+	user := myUserNode.User
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		// Wrong codes count against the account as wrong passwords do, so that logging in again does not allow unlimited guesses
+		addr := clientAddr(req)
+		if wait := max(loginsByUser.Wait(user.Name), loginsByAddr.Wait(addr)); wait > 0 {
+			userRecord.AddLog(fmt.Sprintf("Second-factor attempt for username %s from %s (throttled for %s).", user.Name, addr, wait.Round(time.Second)))
+			tooManyAttempts(res, wait)
+			return
+		}
+		code := req.FormValue("code")
+		var (
+			edited   dsa.User
+			kind     string
+			recovery []string
+		)
+		if user.Enrolled() {
+			if edited, kind, ok = checkSecondFactor(user, code); !ok {
+				err = errWrongCode
+			}
+		} else {
+			kind = "new authenticator"
+			edited, recovery, err = enrollSecondFactor(user, pending.Secret, code)
+		}
+		if err != nil {
+			pendingMu.Lock()
+			pending.Failures++
+			pendingLogins[cookie.Value] = pending
+			pendingMu.Unlock()
+			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s from %s (wrong second-factor code).", user.Name, addr))
+			recordLoginFailure(user.Name, addr)
+			if pending.Failures >= pendingAttempts {
+				endPendingLogin(res, req)
+				userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s (too many wrong second-factor codes).", user.Name))
+				http.Error(res, "Too many wrong codes; please log in again.", http.StatusForbidden)
+				return
+			}
+			http.Error(res, errWrongCode.Error(), http.StatusForbidden)
+			return
+		}
+		if edited, ok = dsa.UpdateUser(users, user.Name, setSecondFactor(user, edited)); !ok {
+			endPendingLogin(res, req)
+			userRecord.AddLog(fmt.Sprintf("Sign-in attempt using username %s from %s (account or second factor changed during sign-in).", user.Name, addr))
+			http.Error(res, "Your account changed while you were signing in; please log in again.", http.StatusConflict)
+			return
+		}
+		loginsByUser.Reset(user.Name)
+		endPendingLogin(res, req)
+		userRecord.AddLog(fmt.Sprintf("Second factor accepted for username %s (%s).", user.Name, kind))
+		if err := startSession(res, req, edited); err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if recovery != nil {
+			userRecord.AddLog(fmt.Sprintf("User %s enrolled a second factor at login.", user.Name))
+			tpl.ExecuteTemplate(res, "recoverycodes.gohtml", recovery)
+			return
+		}
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Name     string
+		Enrolled bool
+		enrollment
+	}{
+		user.Name,
+		user.Enrolled(),
+		enrollment{},
+	}
+	if !user.Enrolled() {
+		data.enrollment = newEnrollment(user, pending.Secret)
+	}
+	tpl.ExecuteTemplate(res, "login2fa.gohtml", data)
+}
+
+// forgotpassword emails a single-use reset link to the account matching a username or email address.
+// The same page is shown whether or not an account matches, so that it cannot be used to find out which accounts exist.
+func forgotpassword(res http.ResponseWriter, req *http.Request) {
+
+	if alreadyLoggedIn(req) {
+		http.Redirect(res, req, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	// Process form submission
+	var sent bool
+	if req.Method == http.MethodPost {
+		account := strings.TrimSpace(req.FormValue("account"))
+		if account == "" {
+			http.Error(res, errBlank.Error(), http.StatusForbidden)
+			return
+		}
+		found, myUserNode := dsa.SearchUser(users, account)
+		if !found {
+			found, myUserNode = dsa.SearchEmail(users, account)
+		}
+		if !found || myUserNode.User.Email == "" {
+			userRecord.AddLog(fmt.Sprintf("Password reset requested for %q, but no account with an email address matches.", account))
+		} else if err := sendResetLink(myUserNode.User); err != nil {
+			userRecord.AddLog(fmt.Sprintf("Password reset requested for username %s, but the reset link could not be sent: %s.", myUserNode.User.Name, err))
+		} else {
+			userRecord.AddLog(fmt.Sprintf("Password reset requested for username %s; reset link emailed (valid for %s).", myUserNode.User.Name, resetTTL))
+		}
+		sent = true
+	}
+	tpl.ExecuteTemplate(res, "forgotpassword.gohtml", sent)
+}
+
+// resetpassword sets a new password for the user a reset token was issued to. Redeeming the token uses it up.
+func resetpassword(res http.ResponseWriter, req *http.Request) {
+
+	token := req.FormValue("token")
+	username, ok := resetTokens.Check(token, time.Now())
+	if !ok {
+		userRecord.AddLog("Password reset attempted with an invalid or expired token.")
+		http.Error(res, "Reset link is invalid or has expired.", http.StatusForbidden)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		password := req.FormValue("password")
+		if password != req.FormValue("repeat") {
+			userRecord.AddLog(fmt.Sprintf("Password reset for username %s attempted, but passwords entered did not match.", username))
+			http.Error(res, "Passwords entered do not match.", http.StatusForbidden)
+			return
+		}
+		if err := passwords.Check(username, password); err != nil {
+			userRecord.AddLog(fmt.Sprintf("Password reset for username %s attempted, but new password rejected by policy (%s).", username, err))
+			http.Error(res, err.Error(), http.StatusForbidden)
+			return
+		}
+		hash, err := passwords.Hash(password)
+		if err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// Checked again while redeeming, in case the token was used or expired in the meantime
+		found, myUserNode := dsa.SearchUser(users, username)
+		if redeemed, ok := resetTokens.Redeem(token, time.Now()); !ok || redeemed != username || !found {
+			userRecord.AddLog("Password reset attempted with an invalid or expired token.")
+			http.Error(res, "Reset link is invalid or has expired.", http.StatusForbidden)
+			return
+		}
+		resetTokensCSV.SaveResetTokens(resetTokens)
+		if _, ok := dsa.UpdateUser(users, myUserNode.User.Name, func(user *dsa.User) bool {
+			user.Pw = hash
+			return true
+		}); !ok {
+			userRecord.AddLog(fmt.Sprintf("Password reset for username %s attempted, but the account was deleted.", username))
+			http.Error(res, "Reset link is invalid or has expired.", http.StatusForbidden)
+			return
+		}
+		// Saved at once, like the used-up token, so that the old password does not come back after a crash
+		usersCSV.SaveUsers(users)
+		count := sessions.RevokeUser(username, "")
+		userRecord.AddLog(fmt.Sprintf("Password reset for username %s completed; reset token used up, %d sessions logged out.", username, count))
+		http.Redirect(res, req, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Username string
+		Token    string
+		Rules    string
+	}{
+		username,
+		token,
+		passwords.Describe(),
+	}
+	tpl.ExecuteTemplate(res, "resetpassword.gohtml", data)
+}
+
 func viewusers(res http.ResponseWriter, req *http.Request) {
 
 	str := dsa.PrintHT(users, dsa.PrintSLLusername)
@@ -172,9 +420,21 @@ func demo(res http.ResponseWriter, req *http.Request) {
 	userRecord.AddLog("Non-Admin account")
 
 	submissions = demodata.Testsubs
+	submissions.SetAging(submissionAging)
 	users = demodata.Testusers
-	ticketlog = demodata.Testticketlog
+	ticketlog = dsa.NewTicketlog(demodata.Testticketlog.Root)
+	ticketindex = ticketlog.Index()
 	products = demodata.Testproducts
+	commentlog = dsa.NewCommentlog()
+	inbox = dsa.NewInbox()
+	filters = dsa.NewFilterbook()
+	teams = dsa.NewTeamroster()
+	productAccess = dsa.NewProductaccess()
+	resetTokens = dsa.NewResettokens()
+	for _, session := range sessions.AllSessions() {
+		sessions.Revoke(session.Hash)
+	}
+	searchIndex = buildIndex()
 
 	tpl.ExecuteTemplate(res, "demo.gohtml", nil)
 }
@@ -183,151 +443,230 @@ func demo(res http.ResponseWriter, req *http.Request) {
 
 func adduser(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin add user. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin add user. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin add user.", loggedin.Name, loggedin.Admin))
-	}
-
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
-	currsesh, _ := req.Cookie("myCookie")
 	_, err := newaccadmin(res, req)
 	if err == nil {
-		tpl.ExecuteTemplate(res, "signup.gohtml", mapSessions[currsesh.Value])
+		data := struct {
+			dsa.User
+			Roles   []dsa.Role
+			Default dsa.Role
+			Rules   string
+		}{
+			requestUser(req),
+			dsa.Roles,
+			signupRole,
+			passwords.Describe(),
+		}
+		tpl.ExecuteTemplate(res, "signup.gohtml", data)
 	}
 }
 
 func edituser(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin edit user. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin edit user. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin edit user.", loggedin.Name, loggedin.Admin))
-	}
+	user := requestUser(req)
 
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
 	var retrieved, edited dsa.User
-	var newname, newpw string
-	str := dsa.PrintHT(users, dsa.PrintSLLusername)
+	var newname, newpw, newemail, newrole string
+	var changes []func(user *dsa.User) // Applied to the account as stored when saved, so that changes made since it was fetched are kept
 
 	// Process form submission
 	if req.Method == http.MethodPost {
-		userchoice, _ := strconv.Atoi(req.FormValue("account"))
-		username := strings.Fields(str[userchoice][0])[1]
-		_, myUserNode := dsa.SearchUser(users, username)
+		found, myUserNode := dsa.SearchUser(users, req.FormValue("account"))
+		if !found {
+			http.Error(res, "Please select an existing account.", http.StatusForbidden)
+			return
+		}
 		retrieved = myUserNode.User
 
 		newname = req.FormValue("username")
 		newpw = req.FormValue("password")
+		newemail = req.FormValue("email")
+		newrole = req.FormValue("role")
 
 		edited = retrieved
 
 		if newname != "" {
 			if exists, _ := dsa.SearchUser(users, newname); exists {
-				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but new username %s matches existing account.", loggedin.Name, newname))
+				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but new username %s matches existing account.", user.Name, newname))
 				http.Error(res, "New username cannot be identical to existing account.", http.StatusUnauthorized)
 				return
 			}
 			edited.Name = newname
-			userRecord.AddLog(fmt.Sprintf("Admin user %s changed username %s to %s.", loggedin.Name, retrieved.Name, edited.Name))
+			userRecord.AddLog(fmt.Sprintf("Admin user %s changed username %s to %s.", user.Name, retrieved.Name, edited.Name))
 		}
 		if newpw != "" {
-			input, _ := bcrypt.GenerateFromPassword([]byte(newpw), bcrypt.MinCost)
-			edited.Pw = input
-			userRecord.AddLog(fmt.Sprintf("Admin user %s changed password for username %s.", loggedin.Name, edited.Name))
+			if err := passwords.Check(edited.Name, newpw); err != nil {
+				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but new password for username %s rejected by policy (%s).", user.Name, edited.Name, err))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return
+			}
+			input, err := passwords.Hash(newpw)
+			if err != nil {
+				http.Error(res, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			changes = append(changes, func(user *dsa.User) { user.Pw = input })
+			// The account's own sessions are logged out, unless the admin is changing their own password
+			current, _ := currentSession(req)
+			count := sessions.RevokeUser(retrieved.Name, current.Hash)
+			userRecord.AddLog(fmt.Sprintf("Admin user %s changed password for username %s; %d sessions logged out.", user.Name, edited.Name, count))
+		}
+		if newemail != "" {
+			email, err := checkEmail(newemail)
+			if err != nil {
+				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but new email address %s invalid or taken.", user.Name, newemail))
+				http.Error(res, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			changes = append(changes, func(user *dsa.User) { user.Email = email })
+			userRecord.AddLog(fmt.Sprintf("Admin user %s changed email address for username %s.", user.Name, edited.Name))
+		}
+		if newrole != "" {
+			role, ok := dsa.ParseRole(newrole)
+			if !ok {
+				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but new role %s invalid.", user.Name, newrole))
+				http.Error(res, "Invalid role.", http.StatusForbidden)
+				return
+			}
+			if retrieved.Role == dsa.RoleAdmin && role != dsa.RoleAdmin && adminCount() == 1 {
+				userRecord.AddLog(fmt.Sprintf("Admin User %s attempted to change the role of username %s, but it is the only Admin account.", user.Name, retrieved.Name))
+				http.Error(res, "At least one account must remain Admin.", http.StatusForbidden)
+				return
+			}
+			changes = append(changes, func(user *dsa.User) { user.Role = role })
+			userRecord.AddLog(fmt.Sprintf("Admin user %s changed role for username %s from %s to %s.", user.Name, edited.Name, retrieved.Role, role))
+		}
+		switch req.FormValue("twofactor") {
+		case "require":
+			changes = append(changes, func(user *dsa.User) { user.Require2FA = true })
+			userRecord.AddLog(fmt.Sprintf("Admin user %s required a second factor for username %s.", user.Name, edited.Name))
+		case "optional":
+			changes = append(changes, func(user *dsa.User) { user.Require2FA = false })
+			userRecord.AddLog(fmt.Sprintf("Admin user %s made a second factor optional for username %s.", user.Name, edited.Name))
+		case "reset":
+			// For users who have lost both their authenticator and recovery codes; they enroll again at their next login if required to
+			changes = append(changes, func(user *dsa.User) { user.TOTP, user.TOTPStep, user.Recovery = "", 0, nil })
+			userRecord.AddLog(fmt.Sprintf("Admin user %s removed the second factor of username %s.", user.Name, edited.Name))
 		}
 	}
 
 	// Add form submission to data structure and exit to main menu
 	if retrieved.Name != "" {
-		dsa.EditUser(users, retrieved, edited)
+		stored, ok := dsa.UpdateUser(users, retrieved.Name, func(user *dsa.User) bool {
+			for _, change := range changes {
+				change(user)
+			}
+			return true
+		})
+		if !ok {
+			userRecord.AddLog(fmt.Sprintf("Admin User %s attempted user editing, but username %s was deleted in the meantime.", user.Name, retrieved.Name))
+			http.Error(res, "Please select an existing account.", http.StatusForbidden)
+			return
+		}
+		if edited.Name != retrieved.Name {
+			renamed := stored
+			renamed.Name = edited.Name
+			dsa.EditUser(users, stored, renamed)
+		}
+		usersCSV.SaveUsers(users) // So that a changed password or role holds even if the server does not exit cleanly
+		inbox.RenameUser(retrieved.Name, edited.Name)
+		filters.RenameOwner(retrieved.Name, edited.Name)
+		teams.RenameUser(retrieved.Name, edited.Name)
+		productAccess.RenameUser(retrieved.Name, edited.Name)
+		resetTokens.RenameUser(retrieved.Name, edited.Name)
+		sessions.RenameUser(retrieved.Name, edited.Name)
 		userRecord.AddLog("Hash table updated with edited account.")
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 	}
-	if currsesh, _ := req.Cookie("myCookie"); retrieved.Name == (mapSessions[currsesh.Value]).Name {
-		mapSessions[currsesh.Value] = edited
+	data := struct {
+		Users []userChoice
+		Roles []dsa.Role
+		Rules string
+	}{
+		userChoices(),
+		dsa.Roles,
+		passwords.Describe(),
 	}
-	tpl.ExecuteTemplate(res, "edituser.gohtml", str)
+	tpl.ExecuteTemplate(res, "edituser.gohtml", data)
 }
 
 func deleteuser(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin delete user. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin delete user. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin delete user.", loggedin.Name, loggedin.Admin))
-	}
+	user := requestUser(req)
 
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
 	var todelete dsa.User
-	str := dsa.PrintHT(users, dsa.PrintSLLusername)
 
 	// Process form submission
 	if req.Method == http.MethodPost {
-		userchoice, _ := strconv.Atoi(req.FormValue("account"))
-		username := strings.Fields(str[userchoice][0])[1]
-		_, myUserNode := dsa.SearchUser(users, username)
+		found, myUserNode := dsa.SearchUser(users, req.FormValue("account"))
+		if !found {
+			http.Error(res, "Please select an existing account.", http.StatusForbidden)
+			return
+		}
 		todelete = myUserNode.User
+		if todelete.Role == dsa.RoleAdmin && adminCount() == 1 {
+			userRecord.AddLog(fmt.Sprintf("Admin User %s attempted to delete username %s, but it is the only Admin account.", user.Name, todelete.Name))
+			http.Error(res, "At least one account must remain Admin.", http.StatusForbidden)
+			return
+		}
 	}
 
 	// Delete user from hash table, delete cookie from active sessions, exit to main menu
 	if todelete.Name != "" {
 		dsa.DeleteUser(users, todelete.Name)
+		inbox.DeleteUser(todelete.Name)
+		filters.DeleteOwner(todelete.Name)
+		teams.DeleteUser(todelete.Name)
+		productAccess.DeleteUser(todelete.Name)
+		resetTokens.DeleteUser(todelete.Name)
+		sessions.RevokeUser(todelete.Name, "")
+		userRecord.AddLog(fmt.Sprintf("Admin user %s deleted account %s from hash table.", user.Name, todelete.Name))
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 	}
-	if currsesh, _ := req.Cookie("myCookie"); todelete.Name == (mapSessions[currsesh.Value]).Name {
-		delete(mapSessions, currsesh.Value)
-		userRecord.AddLog(fmt.Sprintf("Admin user %s deleted account %s from hash table.", loggedin.Name, todelete.Name))
-	}
-	tpl.ExecuteTemplate(res, "deleteuser.gohtml", str)
+	tpl.ExecuteTemplate(res, "deleteuser.gohtml", userChoices())
 }
 
-func manprods(res http.ResponseWriter, req *http.Request) {
+// lockouts lists the usernames and client addresses whose logins are throttled or locked out after failed attempts, and lets an admin unlock them.
+func lockouts(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin manage products. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin manage products. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin manage products.", loggedin.Name, loggedin.Admin))
-	}
+	user := requestUser(req)
 
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+	// Process form submission
+	if req.Method == http.MethodPost {
+		key := req.FormValue("key")
+		limiter, kind := loginsByUser, "username"
+		if req.FormValue("kind") == "address" {
+			limiter, kind = loginsByAddr, "address"
+		}
+		if !limiter.Unlock(key) {
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		userRecord.AddLog(fmt.Sprintf("Admin user %s unlocked sign-in for %s %s.", user.Name, kind, key))
+		http.Redirect(res, req, "/lockouts", http.StatusSeeOther)
 		return
 	}
+
+	data := struct {
+		Users     []throttle.Lock
+		Addresses []throttle.Lock
+		LockAfter int
+		LockFor   time.Duration
+	}{
+		loginsByUser.Locks(),
+		loginsByAddr.Locks(),
+		loginsByUser.LockAfter,
+		loginsByUser.LockFor,
+	}
+	tpl.ExecuteTemplate(res, "lockouts.gohtml", data)
+}
+
+func manprods(res http.ResponseWriter, req *http.Request) {
+
 	tpl.ExecuteTemplate(res, "manprods.gohtml", products)
 }
 
 func addproducts(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin add products. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin add products. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin add products.", loggedin.Name, loggedin.Admin))
-	}
-
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
 	if req.Method == http.MethodPost {
 		newproduct := req.FormValue("productname")
 		if unique := !searchSlice(products, newproduct); unique && newproduct != "" {
@@ -342,18 +681,6 @@ func addproducts(res http.ResponseWriter, req *http.Request) {
 
 func editproducts(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin edit products. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin edit products. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin edit products.", loggedin.Name, loggedin.Admin))
-	}
-
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
 	// Process form submission
 	if req.Method == http.MethodPost {
 		editindex, _ := strconv.Atoi(req.FormValue("product"))
@@ -366,7 +693,9 @@ func editproducts(res http.ResponseWriter, req *http.Request) {
 					http.Error(res, "New Name must be unique.", http.StatusUnauthorized)
 					return
 				}
+				productAccess.RenameProduct((*products)[editindex], newname)
 				(*products)[editindex] = newname
+				productACLCSV.SaveProductAccess(productAccess)
 				http.Redirect(res, req, "/manprods", http.StatusSeeOther)
 			} else {
 				http.Error(res, "New Name cannot be blank.", http.StatusUnauthorized)
@@ -379,19 +708,6 @@ func editproducts(res http.ResponseWriter, req *http.Request) {
 
 func deleteproducts(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin delete products. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin delete products. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin delete products.", loggedin.Name, loggedin.Admin))
-	}
-
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
-
 	// Process form submission
 	if req.Method == http.MethodPost {
 		dltname := req.FormValue("product")
@@ -402,10 +718,20 @@ func deleteproducts(res http.ResponseWriter, req *http.Request) {
 			} else {
 				// Delete all products of that category in ticketlog
 				ticketsToDlt := &[]int64{}
-				ticketsToDlt = dltProductsAVL(dltindex, products, ticketsToDlt, ticketlog.Root)
+				ticketsToDlt = dltProductsAVL(dltindex, products, ticketsToDlt, ticketlog.Snapshot())
 
 				for index := range *ticketsToDlt {
-					ticketlog.Root = dsa.AVLdelete(ticketlog.Root, (*ticketsToDlt)[index])
+					ticketlog.Delete((*ticketsToDlt)[index])
+					commentlog.DeleteComments((*ticketsToDlt)[index])
+					searchIndex.Remove((*ticketsToDlt)[index])
+				}
+				// Renumber the products of the remaining tickets to match the shortened product list
+				for _, ticket := range collectTickets(ticketlog.Snapshot(), nil) {
+					if ticket.Product > dltindex {
+						ticketlog.Update(ticket.TicketID, func(ticket *dsa.Ticket) {
+							ticket.Product--
+						})
+					}
 				}
 
 				// Delete all products of that category in submissions
@@ -413,11 +739,13 @@ func deleteproducts(res http.ResponseWriter, req *http.Request) {
 				submissionsToDlt = dltProductsHeap(dltindex, products, submissionsToDlt, submissions)
 
 				for index := range *submissionsToDlt {
-					_, heapindex := dsa.Searchsubmissions(submissions, (*submissionsToDlt)[index])
-					copy((*submissions)[heapindex:], (*submissions)[heapindex+1:])
-					(*submissions) = (*submissions)[:len(*submissions)-1]
+					submissions.Remove((*submissionsToDlt)[index])
+					commentlog.DeleteComments((*submissionsToDlt)[index])
+					searchIndex.Remove((*submissionsToDlt)[index])
 				}
-				dsa.Makeheap(submissions, 0)
+
+				productAccess.DeleteProduct((*products)[dltindex])
+				productACLCSV.SaveProductAccess(productAccess)
 
 				// Delete product element from products slice
 				(*products)[dltindex] = ""
@@ -433,73 +761,323 @@ func deleteproducts(res http.ResponseWriter, req *http.Request) {
 
 func managesubmissions(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		generalRecord.AddLog("New User (not logged in) accessed admin manage products. Redirected to main menu.")
-	} else if !loggedin.Admin {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin manage products. Redirected to main menu.", loggedin.Name, loggedin.Admin))
-	} else {
-		generalRecord.AddLog(fmt.Sprintf("Username %s (Admin: %t) accessed admin manage products.", loggedin.Name, loggedin.Admin))
-	}
-
-	if !alreadyLoggedIn(req) || !loggedin.Admin {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
 	var s [][]string
 	var popped dsa.Ticket
 	var apprej string
-	s = dsa.LOtraversal(submissions, priorities, products, statuses, categories)
+	user := requestUser(req)
+	visible, all := viewable(user)
+	s = dsa.Printsubmissions(submissions, time.Now(), visible, priorities, products, statuses, categories)
 
 	if req.Method == http.MethodPost {
-		popped = dsa.Popsubmission(submissions)
+		var ok bool
+		if all {
+			popped, ok = submissions.Pop()
+		} else {
+			// Skip over submissions for products the user cannot view, leaving them for someone who can
+			for _, submission := range submissions.Tickets() {
+				if visible(submission) {
+					popped, ok = submissions.Remove(submission.TicketID)
+					break
+				}
+			}
+		}
+		if !ok {
+			tpl.ExecuteTemplate(res, "managesubmissions.gohtml", s)
+			return
+		}
 		apprej = req.FormValue("apprej")
 
 		if apprej == "Approve" {
-			newticket := &dsa.TicketNode{
-				Ticket: popped,
-				Height: 0,
-				Left:   nil,
-				Right:  nil,
-			}
-			ticketlog.Root = dsa.AVLinsert(newticket, ticketlog.Sortfunc, ticketlog.Root)
-			s = dsa.LOtraversal(submissions, priorities, products, statuses, categories)
-			ticketRecord.AddLog(fmt.Sprintf("Admin user %s approved submission (ID %v).", loggedin.Name, newticket.Ticket.TicketID))
+			ticketlog.Insert(popped)
+			s = dsa.Printsubmissions(submissions, time.Now(), visible, priorities, products, statuses, categories)
+			ticketRecord.AddLog(fmt.Sprintf("User %s (Role: %s) approved submission (ID %v).", user.Name, user.Role, popped.TicketID))
+			emitEvent(webhook.SubmissionApproved, popped, user.Name)
 		} else {
-			s = dsa.LOtraversal(submissions, priorities, products, statuses, categories)
-			ticketRecord.AddLog(fmt.Sprintf("Admin user %s rejected submission (ID %v).", loggedin.Name, popped.TicketID))
+			s = dsa.Printsubmissions(submissions, time.Now(), visible, priorities, products, statuses, categories)
+			ticketRecord.AddLog(fmt.Sprintf("User %s (Role: %s) rejected submission (ID %v).", user.Name, user.Role, popped.TicketID))
+			commentlog.DeleteComments(popped.TicketID)
+			emitEvent(webhook.SubmissionRejected, popped, user.Name)
 		}
 	}
 	tpl.ExecuteTemplate(res, "managesubmissions.gohtml", s)
 }
 
-// Non-Admin Features
+func webhooks(res http.ResponseWriter, req *http.Request) {
 
-func submitticket(res http.ResponseWriter, req *http.Request) {
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+	user := requestUser(req)
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		req.ParseForm()
+		if dltraw := req.FormValue("delete"); dltraw != "" {
+			dltID, err := strconv.ParseInt(dltraw, 10, 64)
+			if err != nil || !hookDispatcher.DeleteHook(dltID) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			webhookRecord.AddLog(fmt.Sprintf("Admin user %s deleted webhook %d.", user.Name, dltID))
+		} else {
+			hook, err := hookDispatcher.AddHook(req.FormValue("url"), req.FormValue("secret"), req.Form["events"])
+			if err != nil {
+				webhookRecord.AddLog(fmt.Sprintf("Admin user %s attempted webhook registration, but %s.", user.Name, err))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return
+			}
+			webhookRecord.AddLog(fmt.Sprintf("Admin user %s registered webhook %d (%s) for events %s.", user.Name, hook.ID, hook.URL, strings.Join(hook.Events, ", ")))
+		}
+		webhooksCSV.SaveWebhooks(hookDispatcher.Hooks())
+		http.Redirect(res, req, "/webhooks", http.StatusSeeOther)
 		return
 	}
-	var titleChan, descChan, creatorChan, assigneeChan chan string
-	var startdateChan chan time.Time
-	var priorityChan, dueyearsChan, duemonthsChan, duedaysChan, productChan, statusChan, categoryChan, esthoursChan chan int
-	var ticketIDChan chan int64
-	var erryChan, errmChan, errdChan, errEHChan chan error
 
-	titleChan = make(chan string)
-	descChan = make(chan string)
-	creatorChan = make(chan string)
-	assigneeChan = make(chan string)
+	data := struct {
+		Hooks  []webhook.Hook
+		Events []string
+	}{
+		hookDispatcher.Hooks(),
+		webhook.Events,
+	}
+	tpl.ExecuteTemplate(res, "webhooks.gohtml", data)
+}
 
-	startdateChan = make(chan time.Time)
+func webhookdeliveries(res http.ResponseWriter, req *http.Request) {
 
-	priorityChan = make(chan int)
-	dueyearsChan = make(chan int)
-	duemonthsChan = make(chan int)
-	duedaysChan = make(chan int)
-	productChan = make(chan int)
-	statusChan = make(chan int)
-	categoryChan = make(chan int)
-	esthoursChan = make(chan int)
+	tpl.ExecuteTemplate(res, "webhookdeliveries.gohtml", hookDispatcher.Deliveries())
+}
+
+func diagnostics(res http.ResponseWriter, req *http.Request) {
+
+	root := ticketlog.Snapshot()
+	height := 0
+	if root != nil {
+		height = root.Height
+	}
+	data := struct {
+		Users   dsa.HashStats
+		MaxLoad float64
+		Tickets int
+		Height  int
+	}{
+		users.Stats(),
+		dsa.MaxLoadFactor,
+		dsa.AVLsize(root),
+		height,
+	}
+	tpl.ExecuteTemplate(res, "diagnostics.gohtml", data)
+}
+
+func manageteams(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		name := strings.TrimSpace(req.FormValue("team"))
+		username := strings.TrimSpace(req.FormValue("username"))
+		switch req.FormValue("action") {
+		case "create":
+			if name == "" {
+				http.Error(res, errBlank.Error(), http.StatusForbidden)
+				return
+			}
+			team := dsa.Team{Name: name}
+			if username != "" {
+				if !canWork(username) {
+					http.Error(res, "Lead cannot be assigned tickets.", http.StatusForbidden)
+					return
+				}
+				team.Lead = username
+				team.Members = []string{username}
+			}
+			if !teams.AddTeam(team) {
+				userRecord.AddLog(fmt.Sprintf("Admin user %s attempted to create team %s, but the name is taken.", user.Name, name))
+				http.Error(res, errExisting.Error(), http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("Admin user %s created team %s (Lead: %s).", user.Name, name, username))
+		case "addmember":
+			if !canWork(username) {
+				http.Error(res, "Member cannot be assigned tickets.", http.StatusForbidden)
+				return
+			}
+			if !teams.AddMember(name, username) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("Admin user %s added user %s to team %s.", user.Name, username, name))
+		case "removemember":
+			if !teams.RemoveMember(name, username) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("Admin user %s removed user %s from team %s.", user.Name, username, name))
+		case "setlead":
+			if !teams.SetLead(name, username) {
+				http.Error(res, "Lead must be a member of the team.", http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("Admin user %s made user %s lead of team %s.", user.Name, username, name))
+		case "delete":
+			team, ok := teams.GetTeam(name)
+			if !ok {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			if len(unclaimed(team.Name)) > 0 {
+				http.Error(res, "Team still has unclaimed tickets; assign them before deleting the team.", http.StatusForbidden)
+				return
+			}
+			for _, submission := range submissions.Tickets() {
+				if submission.Team == team.Name {
+					http.Error(res, "Team still has submissions awaiting approval.", http.StatusForbidden)
+					return
+				}
+			}
+			// Claimed tickets stay with their assignee
+			for _, ticket := range ticketindex.Team(team.Name) {
+				ticketlog.Update(ticket.TicketID, func(ticket *dsa.Ticket) {
+					ticket.Team = ""
+				})
+			}
+			teams.DeleteTeam(team.Name)
+			userRecord.AddLog(fmt.Sprintf("Admin user %s deleted team %s.", user.Name, team.Name))
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		teamsCSV.SaveTeams(teams)
+		http.Redirect(res, req, "/teams", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Teams []dsa.Team
+		Users [][]string
+	}{
+		teams.AllTeams(),
+		dsa.PrintHT(users, dsa.PrintSLLassignable),
+	}
+	tpl.ExecuteTemplate(res, "teams.gohtml", data)
+}
+
+// productmembers lists every product the user may view, and shows the members page of one chosen with ?product=.
+// Users who may manage products can restrict or open any product; members granted Manage access can change who else may access it.
+func productmembers(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+	index, err := strconv.Atoi(req.FormValue("product"))
+	chosen := err == nil && index >= 0 && index < len(*products)
+	if req.FormValue("product") != "" && (!chosen || !productAllows(user, index, dsa.AccessView)) {
+		http.Error(res, errNoAccess.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		if !chosen || !canManageProduct(user, index) {
+			http.Error(res, errNoAccess.Error(), http.StatusForbidden)
+			return
+		}
+		name := (*products)[index]
+		username := strings.TrimSpace(req.FormValue("username"))
+		switch req.FormValue("action") {
+		case "restrict":
+			if !user.Can(dsa.ManageProducts) || !productAccess.Restrict(name) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("User %s restricted product %s to its members.", user.Name, name))
+		case "open":
+			if !user.Can(dsa.ManageProducts) || !productAccess.Open(name) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("User %s opened product %s to every user.", user.Name, name))
+		case "grant":
+			access, ok := dsa.ParseAccess(req.FormValue("access"))
+			if !ok {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			if found, _ := dsa.SearchUser(users, username); !found {
+				http.Error(res, "User does not exist.", http.StatusForbidden)
+				return
+			}
+			if !productAccess.Grant(name, username, access) {
+				http.Error(res, "Product is open to every user; restrict it first.", http.StatusForbidden)
+				return
+			}
+			userRecord.AddLog(fmt.Sprintf("User %s set user %s's access to product %s to %s.", user.Name, username, name, access))
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		productACLCSV.SaveProductAccess(productAccess)
+		http.Redirect(res, req, fmt.Sprintf("/productmembers?product=%d", index), http.StatusSeeOther)
+		return
+	}
+
+	type product struct {
+		Index      int
+		Name       string
+		Restricted bool
+	}
+	data := struct {
+		Products []product
+		Product  product
+		Members  []dsa.Member
+		Manage   bool // The user may change the chosen product's members
+		Admin    bool // The user may restrict or open the chosen product
+		Accesses []dsa.Access
+		NoAccess dsa.Access
+	}{
+		Products: make([]product, 0, len(*products)),
+		Accesses: dsa.Accesses,
+		NoAccess: dsa.NoAccess,
+	}
+	for i, name := range *products {
+		if productAllows(user, i, dsa.AccessView) {
+			data.Products = append(data.Products, product{i, name, productAccess.Restricted(name)})
+		}
+	}
+	if chosen {
+		name := (*products)[index]
+		data.Product = product{index, name, productAccess.Restricted(name)}
+		data.Members = productAccess.Members(name)
+		data.Manage = canManageProduct(user, index)
+		data.Admin = user.Can(dsa.ManageProducts)
+	}
+	tpl.ExecuteTemplate(res, "productmembers.gohtml", data)
+}
+
+// Non-Admin Features
+
+func submitticket(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+
+	var titleChan, descChan, creatorChan, assigneeChan, teamChan chan string
+	var startdateChan chan time.Time
+	var priorityChan, dueyearsChan, duemonthsChan, duedaysChan, productChan, statusChan, categoryChan, esthoursChan chan int
+	var ticketIDChan chan int64
+	var erryChan, errmChan, errdChan, errEHChan chan error
+
+	titleChan = make(chan string)
+	descChan = make(chan string)
+	creatorChan = make(chan string)
+	assigneeChan = make(chan string)
+	teamChan = make(chan string)
+
+	startdateChan = make(chan time.Time)
+
+	priorityChan = make(chan int)
+	dueyearsChan = make(chan int)
+	duemonthsChan = make(chan int)
+	duedaysChan = make(chan int)
+	productChan = make(chan int)
+	statusChan = make(chan int)
+	categoryChan = make(chan int)
+	esthoursChan = make(chan int)
 
 	ticketIDChan = make(chan int64)
 
@@ -508,7 +1086,7 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 	errdChan = make(chan error)
 	errEHChan = make(chan error)
 
-	var title, desc, creator, assignee string
+	var title, desc, creator, assignee, team string
 	var startdate, duedate time.Time
 	var priority, dueyears, duemonths, duedays, product, status, category, esthours int
 	var ticketID int64
@@ -528,9 +1106,9 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 		}()
 
 		go func() {
-			currsesh, _ := req.Cookie("myCookie")
+			creator := requestUser(req)
 			mu.Lock()
-			creatorChan <- mapSessions[currsesh.Value].Name
+			creatorChan <- creator.Name
 			mu.Unlock()
 			// close(creatorChan)
 		}()
@@ -559,18 +1137,25 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 		}()
 
 		go func() {
-			currsesh, _ := req.Cookie("myCookie")
+			creator := requestUser(req)
 			mu.Lock()
-			creatorChan <- mapSessions[currsesh.Value].Name
+			creatorChan <- creator.Name
 			mu.Unlock()
 		}()
 
 		go func() {
-			assigneeRaw := req.FormValue("assignee")
-			assignee := (strings.Fields(assigneeRaw))[1]
+			// Tickets assigned to a team may be left without an assignee, for one of its members to claim
+			var assignee string
+			if assigneeRaw := strings.Fields(req.FormValue("assignee")); len(assigneeRaw) > 1 {
+				assignee = assigneeRaw[1]
+			}
 			assigneeChan <- assignee
 		}()
 
+		go func() {
+			teamChan <- req.FormValue("team")
+		}()
+
 		go func() {
 			esthours, errEH := strconv.Atoi(req.FormValue("esthours"))
 			esthoursChan <- esthours
@@ -626,6 +1211,7 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 		desc = <-descChan
 		creator = <-creatorChan
 		assignee = <-assigneeChan
+		team = <-teamChan
 		startdate = <-startdateChan
 		esthours = <-esthoursChan
 		errEH = <-errEHChan
@@ -641,13 +1227,13 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 		category = <-categoryChan
 
 		if title == "" {
-			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", loggedin.Name))
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
 			http.Error(res, "Title cannot be empty.", http.StatusForbidden)
 			return
 		}
 
 		if desc == "" {
-			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", loggedin.Name))
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
 			http.Error(res, "Description cannot be empty.", http.StatusForbidden)
 			return
 		}
@@ -655,46 +1241,96 @@ func submitticket(res http.ResponseWriter, req *http.Request) {
 		if ((erry == nil) && (dueyears > 0)) && ((errm == nil) && (duemonths > 0)) && ((errd == nil) && (duedays > 0)) {
 			duedate = startdate.AddDate(dueyears, duemonths, duedays)
 		} else {
-			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", loggedin.Name))
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
 			http.Error(res, "Invalid ticket duration.", http.StatusForbidden)
 			return
 		}
 
 		if errEH != nil || esthours <= 0 {
-			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", loggedin.Name))
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
 			http.Error(res, "Invalid estimated hours entry.", http.StatusForbidden)
 			return
 		}
 
+		if team != "" {
+			assignedTeam, found := teams.GetTeam(team)
+			if !found {
+				submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+				http.Error(res, "Team does not exist.", http.StatusForbidden)
+				return
+			}
+			if assignee != "" && !assignedTeam.HasMember(assignee) {
+				submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+				http.Error(res, "Assignee must be a member of the team.", http.StatusForbidden)
+				return
+			}
+			team = assignedTeam.Name
+		} else if assignee == "" {
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+			http.Error(res, "Ticket must be assigned to a user or a team.", http.StatusForbidden)
+			return
+		}
+
+		if found, assigneeNode := dsa.SearchUser(users, assignee); assignee != "" && (!found || !assigneeNode.User.Can(dsa.WorkTickets)) {
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+			http.Error(res, "Assignee cannot be assigned tickets.", http.StatusForbidden)
+			return
+		}
+
+		if product < 0 || product >= len(*products) {
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+			http.Error(res, "Invalid product.", http.StatusForbidden)
+			return
+		}
+		if !userAllows(creator, product, dsa.AccessSubmit) {
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission to product %s without access.", creator, (*products)[product]))
+			http.Error(res, errNoAccess.Error(), http.StatusForbidden)
+			return
+		}
+		if assignee != "" && !userAllows(assignee, product, dsa.AccessView) {
+			submissionRecord.AddLog(fmt.Sprintf("User %s attempted ticket submission with one or more invalid inputs.", user.Name))
+			http.Error(res, "Assignee does not have access to this product.", http.StatusForbidden)
+			return
+		}
+
 		if title != "" {
 			submissionRecord.AddLog(fmt.Sprintf("Ticket ID %v submitted by user %v.", ticketID, creator))
 			newticket := newSubmission(title, desc, creator, assignee, startdate, duedate, priority, dueyears, duemonths, duedays, product, status, category, esthours, priorities, products, statuses, categories, ticketID)
 
-			var mu sync.Mutex
-			mu.Lock()
-			dsa.Addsubmission(submissions, <-newticket)
-			mu.Unlock()
+			ticket := <-newticket
+			ticket.Team = team
+			submissions.Push(ticket)
+			emitEvent(webhook.SubmissionCreated, ticket, creator)
 
 			http.Redirect(res, req, "/submitted", http.StatusSeeOther)
 			return
 		}
 	}
-	str := dsa.PrintHT(users, dsa.PrintSLLnoadmin)
+	str := dsa.PrintHT(users, dsa.PrintSLLassignable)
+	// Only the products the user may submit to are offered, keyed by their index
+	choices := make(map[int]string)
+	for index, name := range *products {
+		if userAllows(creator, index, dsa.AccessSubmit) {
+			choices[index] = name
+		}
+	}
 	data := struct {
 		Loggedinuser string
 		Users        [][]string
+		Teams        []dsa.Team
 		Priorities   []string
 		Startdate    time.Time
-		Products     []string
+		Products     map[int]string
 		Statuses     []string
 		Categories   []string
 		TicketID     int64
 	}{
 		creator,
 		str,
+		teams.AllTeams(),
 		*priorities,
 		startdate,
-		*products,
+		choices,
 		*statuses,
 		*categories,
 		ticketID,
@@ -709,22 +1345,26 @@ func submitted(res http.ResponseWriter, req *http.Request) {
 
 func viewsubmissions(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
-	s := dsa.LOtraversal(submissions, priorities, products, statuses, categories)
+	user := requestUser(req)
+	visible, _ := viewable(user)
+	s := dsa.Printsubmissions(submissions, time.Now(), visible, priorities, products, statuses, categories)
 	tpl.ExecuteTemplate(res, "viewsubmissions.gohtml", s)
 }
 
 func viewmytickets(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
+	user := requestUser(req)
+	visible, all := viewable(user)
+	from, size := pageRequest(req)
+	var tickets []dsa.Ticket
+	var total int
+	// Tickets of products the user may no longer view are left out, as in viewalltickets
+	if all {
+		tickets, total = ticketindex.CreatedRange(user.Name, from, size)
+	} else {
+		tickets, total = pageTickets(keepTickets(ticketindex.Created(user.Name), visible), from, size)
 	}
-	str := make([][]string, 0)
-	str = dsa.IOtraversal(mytickets.Root, priorities, products, statuses, categories, str)
+	str := printTickets(tickets)
 	owner := "My"
 	object := "Tickets"
 
@@ -732,22 +1372,30 @@ func viewmytickets(res http.ResponseWriter, req *http.Request) {
 		Tickets [][]string
 		Owner   string
 		Object  string
+		Page    pager
 	}{
 		str,
 		owner,
 		object,
+		newPager(req, from, size, total),
 	}
 	tpl.ExecuteTemplate(res, "viewtickets.gohtml", data)
 }
 
 func viewmyassignments(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
+	user := requestUser(req)
+	visible, all := viewable(user)
+	from, size := pageRequest(req)
+	var tickets []dsa.Ticket
+	var total int
+	// Tickets of products the user may no longer view are left out, as in viewalltickets
+	if all {
+		tickets, total = ticketindex.AssignedRange(user.Name, from, size)
+	} else {
+		tickets, total = pageTickets(keepTickets(ticketindex.Assigned(user.Name), visible), from, size)
 	}
-	str := make([][]string, 0)
-	str = dsa.IOtraversal(myassigns.Root, priorities, products, statuses, categories, str)
+	str := printTickets(tickets)
 	owner := "My"
 	object := "Assignments"
 
@@ -755,60 +1403,686 @@ func viewmyassignments(res http.ResponseWriter, req *http.Request) {
 		Tickets [][]string
 		Owner   string
 		Object  string
+		Page    pager
 	}{
 		str,
 		owner,
 		object,
+		newPager(req, from, size, total),
 	}
 	tpl.ExecuteTemplate(res, "viewtickets.gohtml", data)
 }
 
 func viewalltickets(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
-	}
-	str := make([][]string, 0)
-	str = dsa.IOtraversal(ticketlog.Root, priorities, products, statuses, categories, str)
+	user := requestUser(req)
+	visible, all := viewable(user)
+	from, size := pageRequest(req)
+	var tickets []dsa.Ticket
+	var total int
 	owner := "All"
 	object := "Tickets"
 
+	// Narrow the view down to a single team's tickets, if one is chosen
+	// Users who may view every product are served a page at a time straight from the tree; others have the tickets of hidden products filtered out first
+	if name := req.FormValue("team"); name != "" {
+		team, ok := teams.GetTeam(name)
+		if !ok {
+			http.Error(res, "Invalid team.", http.StatusForbidden)
+			return
+		}
+		if all {
+			tickets, total = ticketindex.TeamRange(team.Name, from, size)
+		} else {
+			tickets, total = pageTickets(keepTickets(ticketindex.Team(team.Name), visible), from, size)
+		}
+		owner = "Team " + team.Name
+	} else if all {
+		root := ticketlog.Snapshot()
+		tickets, total = dsa.AVLrange(root, from, size, make([]dsa.Ticket, 0)), dsa.AVLsize(root)
+	} else {
+		tickets, total = pageTickets(keepTickets(collectTickets(ticketlog.Snapshot(), nil), visible), from, size)
+	}
+	str := printTickets(tickets)
+
 	data := struct {
 		Tickets [][]string
 		Owner   string
 		Object  string
+		Page    pager
 	}{
 		str,
 		owner,
 		object,
+		newPager(req, from, size, total),
 	}
 	tpl.ExecuteTemplate(res, "viewtickets.gohtml", data)
 }
 
-func deletemytickets(res http.ResponseWriter, req *http.Request) {
+func comments(res http.ResponseWriter, req *http.Request) {
+
+	var ticketID int64 = -1
+	if raw := req.FormValue("ticket"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || !ticketExists(parsed) {
+			http.Error(res, "Invalid ticket ID input.", http.StatusForbidden)
+			return
+		}
+		ticketID = parsed
+	}
+	user := requestUser(req)
+	if ticket, ok := findTicket(ticketID); ok && !productAllows(user, ticket.Product, dsa.AccessView) {
+		http.Error(res, errNoAccess.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost && ticketID >= 0 {
+		if !user.Can(dsa.CommentTickets) {
+			http.Error(res, "Your role does not allow commenting on tickets.", http.StatusForbidden)
+			return
+		}
+		body := strings.TrimSpace(req.FormValue("body"))
+		if body == "" {
+			http.Error(res, errBlank.Error(), http.StatusForbidden)
+			return
+		}
+		author := user.Name
+		comment := dsa.Comment{
+			TicketID: ticketID,
+			Author:   author,
+			Body:     body,
+			Posted:   time.Now(),
+		}
+		commentlog.AddComment(comment)
+		ticketRecord.AddLog(fmt.Sprintf("Comment added to ticket ID %v by user %v.", ticketID, author))
+		emitComment(comment)
+		http.Redirect(res, req, fmt.Sprintf("/comments?ticket=%d", ticketID), http.StatusSeeOther)
+		return
+	}
+
+	var ticket []string
+	if node := dsa.AVLsearch(ticketlog.Snapshot(), ticketID); node != nil {
+		ticket = dsa.PrintTicket(node.Ticket, priorities, products, statuses, categories)
+	} else if submission, found := submissions.Get(ticketID); found {
+		ticket = dsa.PrintTicket(submission, priorities, products, statuses, categories)
+	}
+
+	data := struct {
+		TicketID int64
+		Ticket   []string
+		Comments []dsa.Comment
+	}{
+		ticketID,
+		ticket,
+		commentlog.Comments(ticketID),
+	}
+	tpl.ExecuteTemplate(res, "comments.gohtml", data)
+}
+
+func preferences(res http.ResponseWriter, req *http.Request) {
+
+	retrieved, ok := sessionUser(req)
+	if !ok {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		req.ParseForm()
+		if req.FormValue("newmailkey") != "" {
+			key := dsa.NewMailKey()
+			if _, ok := dsa.UpdateUser(users, retrieved.Name, func(user *dsa.User) bool {
+				user.MailKey = key
+				return true
+			}); !ok {
+				http.Redirect(res, req, "/", http.StatusSeeOther)
+				return
+			}
+			usersCSV.SaveUsers(users)
+			userRecord.AddLog(fmt.Sprintf("User %s generated new personal inbound email addresses.", retrieved.Name))
+			http.Redirect(res, req, "/preferences", http.StatusSeeOther)
+			return
+		}
+		email := retrieved.Email
+		if newemail := strings.TrimSpace(req.FormValue("email")); !strings.EqualFold(newemail, retrieved.Email) {
+			checked, err := checkEmail(newemail)
+			if err != nil {
+				userRecord.AddLog(fmt.Sprintf("User %s attempted to change email address, but %s invalid or taken.", retrieved.Name, newemail))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return
+			}
+			email = checked
+		}
+		notify := 0
+		for _, raw := range req.Form["notify"] {
+			flag, _ := strconv.Atoi(raw)
+			notify |= flag & dsa.NotifyAll
+		}
+		edited, ok := dsa.UpdateUser(users, retrieved.Name, func(user *dsa.User) bool {
+			user.Email, user.Notify = email, notify
+			return true
+		})
+		if !ok {
+			http.Redirect(res, req, "/", http.StatusSeeOther)
+			return
+		}
+		userRecord.AddLog(fmt.Sprintf("User %s updated notification preferences (email: %q, flags: %d).", edited.Name, edited.Email, edited.Notify))
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	addresses := map[string]string{}
+	for index, product := range *products {
+		if productAllows(retrieved, index, dsa.AccessSubmit) {
+			addresses[product] = personalAddress(retrieved, index)
+		}
+	}
+
+	data := struct {
+		Email     string
+		Assigned  bool
+		Approval  bool
+		Due       bool
+		Flags     map[string]int
+		Addresses map[string]string // Product -> the user's personal inbound address for it
+	}{
+		retrieved.Email,
+		retrieved.Notify&dsa.NotifyAssigned != 0,
+		retrieved.Notify&dsa.NotifyApproval != 0,
+		retrieved.Notify&dsa.NotifyDue != 0,
+		map[string]int{
+			"Assigned": dsa.NotifyAssigned,
+			"Approval": dsa.NotifyApproval,
+			"Due":      dsa.NotifyDue,
+		},
+		addresses,
+	}
+	tpl.ExecuteTemplate(res, "preferences.gohtml", data)
+}
+
+// profile shows the logged in user's account, and lets them change their password given their current one.
+func profile(res http.ResponseWriter, req *http.Request) {
+
+	user, ok := sessionUser(req)
+	if !ok {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		current := req.FormValue("current")
+		password := req.FormValue("password")
+		if err := bcrypt.CompareHashAndPassword(user.Pw, []byte(current)); err != nil {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their password, but the current password entered was wrong.", user.Name))
+			http.Error(res, "Current password is incorrect.", http.StatusForbidden)
+			return
+		}
+		if password != req.FormValue("repeat") {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their password, but passwords entered did not match.", user.Name))
+			http.Error(res, "Passwords entered do not match.", http.StatusForbidden)
+			return
+		}
+		if err := passwords.Check(user.Name, password); err != nil {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their password, but new password rejected by policy (%s).", user.Name, err))
+			http.Error(res, err.Error(), http.StatusForbidden)
+			return
+		}
+		hash, err := passwords.Hash(password)
+		if err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		// Refused if the password was changed elsewhere since the current one was checked
+		if _, ok := dsa.UpdateUser(users, user.Name, func(stored *dsa.User) bool {
+			if !bytes.Equal(stored.Pw, user.Pw) {
+				return false
+			}
+			stored.Pw = hash
+			return true
+		}); !ok {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their password, but it was changed elsewhere in the meantime.", user.Name))
+			http.Error(res, "Your password was changed elsewhere; please try again.", http.StatusConflict)
+			return
+		}
+		usersCSV.SaveUsers(users)
+		// A reset link requested before the change is no longer needed, and sessions elsewhere may have been started with the old password
+		resetTokens.DeleteUser(user.Name)
+		resetTokensCSV.SaveResetTokens(resetTokens)
+		session, _ := currentSession(req)
+		count := sessions.RevokeUser(user.Name, session.Hash)
+		userRecord.AddLog(fmt.Sprintf("User %s changed their password; %d other sessions logged out.", user.Name, count))
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		dsa.User
+		Rules string
+	}{
+		user,
+		passwords.Describe(),
+	}
+	tpl.ExecuteTemplate(res, "profile.gohtml", data)
+}
+
+// twofactor lets a user enroll a second factor, regenerate their recovery codes, or remove the second factor unless it is required of them.
+// Each change needs a current code, and removal also the password, so that an unattended session cannot be used to take over the account.
+func twofactor(res http.ResponseWriter, req *http.Request) {
+
+	user, ok := sessionUser(req)
+	if !ok {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		code := req.FormValue("code")
+		var (
+			edited   dsa.User
+			recovery []string
+			err      error
+		)
+		switch req.FormValue("action") {
+		case "enable":
+			if user.Enrolled() {
+				http.Error(res, "A second factor is already enrolled.", http.StatusForbidden)
+				return
+			}
+			edited, recovery, err = enrollSecondFactor(user, req.FormValue("secret"), code)
+		case "recovery", "disable":
+			if !user.Enrolled() {
+				http.Error(res, "No second factor is enrolled.", http.StatusForbidden)
+				return
+			}
+			if edited, _, ok = checkSecondFactor(user, code); !ok {
+				err = errWrongCode
+				break
+			}
+			if req.FormValue("action") == "recovery" {
+				var hashes []string
+				if recovery, hashes, err = totp.RecoveryCodes(recoveryCount); err == nil {
+					edited.Recovery = hashes
+				}
+				break
+			}
+			if requires2FA(user) {
+				http.Error(res, "A second factor is required for your account, and cannot be removed.", http.StatusForbidden)
+				return
+			}
+			if bcrypt.CompareHashAndPassword(user.Pw, []byte(req.FormValue("password"))) != nil {
+				userRecord.AddLog(fmt.Sprintf("User %s attempted to remove their second factor, but the password entered was wrong.", user.Name))
+				http.Error(res, "Password is incorrect.", http.StatusForbidden)
+				return
+			}
+			edited.TOTP, edited.TOTPStep, edited.Recovery = "", 0, nil
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, errWrongCode) {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their second factor, but the code entered was wrong.", user.Name))
+			http.Error(res, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if _, ok := dsa.UpdateUser(users, user.Name, setSecondFactor(user, edited)); !ok {
+			userRecord.AddLog(fmt.Sprintf("User %s attempted to change their second factor, but it was changed elsewhere in the meantime.", user.Name))
+			http.Error(res, "Your second factor was changed elsewhere; please try again.", http.StatusConflict)
+			return
+		}
+		switch {
+		case !edited.Enrolled():
+			userRecord.AddLog(fmt.Sprintf("User %s removed their second factor.", user.Name))
+		case user.Enrolled():
+			userRecord.AddLog(fmt.Sprintf("User %s regenerated their recovery codes.", user.Name))
+		default:
+			userRecord.AddLog(fmt.Sprintf("User %s enrolled a second factor.", user.Name))
+		}
+		if recovery != nil {
+			tpl.ExecuteTemplate(res, "recoverycodes.gohtml", recovery)
+			return
+		}
+		http.Redirect(res, req, "/twofactor", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Name      string
+		Enrolled  bool
+		Required  bool
+		Remaining int
+		enrollment
+	}{
+		user.Name,
+		user.Enrolled(),
+		requires2FA(user),
+		len(user.Recovery),
+		enrollment{},
+	}
+	if !user.Enrolled() {
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			http.Error(res, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		data.enrollment = newEnrollment(user, secret)
+	}
+	tpl.ExecuteTemplate(res, "twofactor.gohtml", data)
+}
+
+// activesessions lists the sessions a user is logged in with, e.g. on other devices, and lets them log any of them out.
+// Admins who may manage users also see every user's sessions, and may log out any session or every session of a user.
+func activesessions(res http.ResponseWriter, req *http.Request) {
+
+	current, ok := currentSession(req)
+	if !ok {
+		http.Redirect(res, req, "/", http.StatusSeeOther)
+		return
+	}
+	user, _ := sessionUser(req)
+	admin := user.Can(dsa.ManageUsers)
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		switch req.FormValue("action") {
+		case "revoke":
+			target, ok := sessions.Get(req.FormValue("session"))
+			if !ok || (target.User != user.Name && !admin) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			sessions.Revoke(target.Hash)
+			if target.User == user.Name {
+				userRecord.AddLog(fmt.Sprintf("User %s logged out their session started %s from %s.", user.Name, target.Created.Format(time.RFC3339), target.Addr))
+			} else {
+				userRecord.AddLog(fmt.Sprintf("Admin user %s logged out the session of username %s started %s from %s.", user.Name, target.User, target.Created.Format(time.RFC3339), target.Addr))
+			}
+		case "others":
+			count := sessions.RevokeUser(user.Name, current.Hash)
+			userRecord.AddLog(fmt.Sprintf("User %s logged out their %d other sessions.", user.Name, count))
+		case "user":
+			username := req.FormValue("username")
+			if found, _ := dsa.SearchUser(users, username); !admin || !found {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			count := sessions.RevokeUser(username, "")
+			userRecord.AddLog(fmt.Sprintf("Admin user %s logged out username %s everywhere (%d sessions).", user.Name, username, count))
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		http.Redirect(res, req, "/sessions", http.StatusSeeOther)
+		return
+	}
+
+	type sessionView struct {
+		dsa.Session
+		Expires time.Time
+		Current bool
+	}
+	view := func(list []dsa.Session) []sessionView {
+		result := make([]sessionView, len(list))
+		for i, session := range list {
+			result[i] = sessionView{session, sessions.Expires(session), session.Hash == current.Hash}
+		}
+		return result
+	}
+	data := struct {
+		Name     string
+		Mine     []sessionView
+		Admin    bool
+		All      []sessionView
+		Lifetime time.Duration
+		Idle     time.Duration
+	}{
+		Name:     user.Name,
+		Mine:     view(sessions.UserSessions(user.Name)),
+		Admin:    admin,
+		Lifetime: sessionLifetime,
+		Idle:     sessionIdle,
+	}
+	if admin {
+		data.All = view(sessions.AllSessions())
+	}
+	tpl.ExecuteTemplate(res, "sessions.gohtml", data)
+}
+
+func viewinbox(res http.ResponseWriter, req *http.Request) {
 
 	if !alreadyLoggedIn(req) {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
+	user, _ := sessionUser(req)
+	username := user.Name
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		if req.FormValue("all") != "" {
+			count := inbox.MarkAllRead(username)
+			generalRecord.AddLog(fmt.Sprintf("User %s marked %d notifications as read.", username, count))
+		} else {
+			id, err := strconv.ParseInt(req.FormValue("read"), 10, 64)
+			if err != nil || !inbox.MarkRead(username, id) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		http.Redirect(res, req, "/inbox", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		Unread        int
+		Notifications []dsa.Notification
+	}{
+		inbox.Unread(username),
+		inbox.Notifications(username),
+	}
+	tpl.ExecuteTemplate(res, "inbox.gohtml", data)
+}
+
+func duedates(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+	visible, _ := viewable(user)
+
+	// Users who may edit any ticket see every flagged ticket of the products they may view; other users only those they created or are assigned
+	type flagged struct {
+		State  string
+		Ticket []string
+	}
+	tickets := make([]flagged, 0)
+	for _, flag := range dueWatcher.Flagged() {
+		node := dsa.AVLsearch(ticketlog.Snapshot(), flag.TicketID)
+		if node == nil || !visible(node.Ticket) || (!user.Can(dsa.EditAnyTicket) && node.Ticket.Creator != user.Name && node.Ticket.Assignee != user.Name) {
+			continue
+		}
+		tickets = append(tickets, flagged{
+			flag.State.String(),
+			dsa.PrintTicket(node.Ticket, priorities, products, statuses, categories),
+		})
+	}
+
+	data := struct {
+		Tickets []flagged
+		DueSoon time.Duration
+	}{
+		tickets,
+		dueWatcher.DueSoon,
+	}
+	tpl.ExecuteTemplate(res, "duedates.gohtml", data)
+}
+
+func searchtickets(res http.ResponseWriter, req *http.Request) {
+
+	query := strings.TrimSpace(req.FormValue("q"))
+	user := requestUser(req)
+	visible, _ := viewable(user)
+
+	type result struct {
+		TicketID int64
+		Kind     string
+		Score    string
+		Ticket   []string
+	}
+	results := make([]result, 0)
+	if query != "" {
+		for _, hit := range searchIndex.Search(query) {
+			kind := "Ticket"
+			ticket, ok := findTicket(hit.ID)
+			if !ok || !visible(ticket) {
+				continue
+			} else if dsa.AVLsearch(ticketlog.Snapshot(), hit.ID) == nil {
+				kind = "Submission"
+			}
+			results = append(results, result{
+				hit.ID,
+				kind,
+				strconv.FormatFloat(hit.Score, 'f', 2, 64),
+				dsa.PrintTicket(ticket, priorities, products, statuses, categories),
+			})
+		}
+		generalRecord.AddLog(fmt.Sprintf("User %s searched for %q (%d results).", user.Name, query, len(results)))
+	}
+
+	data := struct {
+		Query   string
+		Results []result
+	}{
+		query,
+		results,
+	}
+	tpl.ExecuteTemplate(res, "search.gohtml", data)
+}
+
+func savedfilters(res http.ResponseWriter, req *http.Request) {
+
+	retrieved := requestUser(req)
+
+	// Process form submission
+	if req.Method == http.MethodPost {
+		switch req.FormValue("action") {
+		case "save":
+			name := strings.TrimSpace(req.FormValue("name"))
+			input := strings.TrimSpace(req.FormValue("q"))
+			if name == "" || input == "" {
+				http.Error(res, errBlank.Error(), http.StatusForbidden)
+				return
+			}
+			if _, err := query.Compile(input, queryEnv(retrieved.Name)); err != nil {
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return
+			}
+			for _, existing := range filters.Visible(retrieved.Name) {
+				if existing.Owner == retrieved.Name && strings.EqualFold(existing.Name, name) {
+					http.Error(res, errExisting.Error(), http.StatusForbidden)
+					return
+				}
+			}
+			filter := filters.AddFilter(dsa.Filter{
+				Owner:  retrieved.Name,
+				Name:   name,
+				Query:  input,
+				Shared: req.FormValue("shared") != "",
+			})
+			generalRecord.AddLog(fmt.Sprintf("User %s saved filter %d %q (shared: %t): %s", retrieved.Name, filter.ID, filter.Name, filter.Shared, filter.Query))
+		case "delete":
+			id, _ := strconv.ParseInt(req.FormValue("id"), 10, 64)
+			filter, ok := filters.GetFilter(id)
+			if !ok || filter.Owner != retrieved.Name {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			filters.DeleteFilter(id)
+			generalRecord.AddLog(fmt.Sprintf("User %s deleted filter %d %q.", retrieved.Name, filter.ID, filter.Name))
+		case "home":
+			id, _ := strconv.ParseInt(req.FormValue("id"), 10, 64)
+			if filter, ok := filters.GetFilter(id); id != 0 && (!ok || (filter.Owner != retrieved.Name && !filter.Shared)) {
+				http.Error(res, errInvalid.Error(), http.StatusForbidden)
+				return
+			}
+			dsa.UpdateUser(users, retrieved.Name, func(user *dsa.User) bool {
+				user.Home = id
+				return true
+			})
+			userRecord.AddLog(fmt.Sprintf("User %s set home view to filter %d.", retrieved.Name, id))
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		http.Redirect(res, req, "/filters", http.StatusSeeOther)
+		return
+	}
+
+	// Run an ad hoc query, or a saved filter
+	input := strings.TrimSpace(req.FormValue("q"))
+	if raw := req.FormValue("id"); raw != "" {
+		id, _ := strconv.ParseInt(raw, 10, 64)
+		filter, ok := filters.GetFilter(id)
+		if !ok || (filter.Owner != retrieved.Name && !filter.Shared) {
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		input = filter.Query
+	}
+	var tickets [][]string
+	var queryErr string
+	if input != "" {
+		var err error
+		if tickets, err = runQuery(input, retrieved.Name); err != nil {
+			queryErr = err.Error()
+		}
+	}
+
+	data := struct {
+		User    string
+		Home    int64
+		Query   string
+		Error   string
+		Tickets [][]string
+		Filters []dsa.Filter
+	}{
+		retrieved.Name,
+		retrieved.Home,
+		input,
+		queryErr,
+		tickets,
+		filters.Visible(retrieved.Name),
+	}
+	tpl.ExecuteTemplate(res, "filters.gohtml", data)
+}
+
+func deletemytickets(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+	username := user.Name
+	visible, _ := viewable(user)
 
 	var deleteID int64
 
 	if req.Method == http.MethodPost {
 		deleteIDraw, deleteerr := strconv.Atoi(req.FormValue("deleteID"))
 		deleteID = int64(deleteIDraw)
-		if deleteerr != nil || req.FormValue("deleteID") == "" || deleteID < 0 || dsa.AVLsearch(mytickets.Root, deleteID) == nil {
-			ticketRecord.AddLog(fmt.Sprintf("Attempted ticket deletion by user %v, but invalid ticket ID input.", loggedin.Name))
+		todelete, ok := ticketindex.Get(deleteID)
+		if deleteerr != nil || req.FormValue("deleteID") == "" || deleteID < 0 || !ok || !visible(todelete) || (todelete.Creator != username && !user.Can(dsa.EditAnyTicket)) {
+			ticketRecord.AddLog(fmt.Sprintf("Attempted ticket deletion by user %v, but invalid ticket ID input.", user.Name))
 			http.Error(res, "Invalid ticket ID input.", http.StatusForbidden)
 			return
 		}
-		todelete := dsa.AVLsearch(ticketlog.Root, deleteID)
-		ticketlog.Root = dsa.AVLdelete(ticketlog.Root, todelete.Ticket.TicketID)
-		ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v has been deleted by user %v.", todelete.Ticket.TicketID, loggedin.Name))
+		ticketlog.Delete(todelete.TicketID)
+		ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v has been deleted by user %v.", todelete.TicketID, user.Name))
+		commentlog.DeleteComments(todelete.TicketID)
+		emitEvent(webhook.TicketDeleted, todelete, user.Name)
 	}
-	str := make([][]string, 0)
-	str = dsa.IOtraversal(mytickets.Root, priorities, products, statuses, categories, str)
+	str := printTickets(keepTickets(ticketindex.Created(username), visible))
 	owner := "My"
 	object := "Tickets"
 
@@ -825,29 +2099,68 @@ func deletemytickets(res http.ResponseWriter, req *http.Request) {
 	tpl.ExecuteTemplate(res, "deletetickets.gohtml", data)
 }
 
-func markmyassignments(res http.ResponseWriter, req *http.Request) {
+func updatemyassignments(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
-		return
+	user := requestUser(req)
+	username := user.Name
+	visible, _ := viewable(user)
+
+	if req.Method == http.MethodPost {
+		updateIDraw, updateerr := strconv.Atoi(req.FormValue("updateID"))
+		updateID := int64(updateIDraw)
+		status, statuserr := strconv.Atoi(req.FormValue("status"))
+		if current, ok := ticketindex.Get(updateID); updateerr != nil || updateID < 0 || !ok || !visible(current) || (current.Assignee != username && !user.Can(dsa.EditAnyTicket)) {
+			ticketRecord.AddLog(fmt.Sprintf("Attempted assignment update by user %v, but invalid ticket ID input.", user.Name))
+			http.Error(res, "Invalid ticket ID input.", http.StatusForbidden)
+			return
+		}
+		if statuserr != nil || status < 0 || status >= len(*statuses) {
+			ticketRecord.AddLog(fmt.Sprintf("Attempted assignment update by user %v, but invalid status input.", user.Name))
+			http.Error(res, "Invalid status input.", http.StatusForbidden)
+			return
+		}
+		updated, _ := ticketlog.Update(updateID, func(ticket *dsa.Ticket) {
+			ticket.Status = status
+		})
+		ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v status set to %s by user %v.", updateID, (*statuses)[status], user.Name))
+		emitEvent(webhook.TicketUpdated, updated, user.Name)
 	}
+	str := printTickets(keepTickets(ticketindex.Assigned(username), visible))
+
+	data := struct {
+		Tickets  [][]string
+		Statuses []string
+	}{
+		str,
+		*statuses,
+	}
+
+	tpl.ExecuteTemplate(res, "updatetickets.gohtml", data)
+}
+
+func markmyassignments(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+	username := user.Name
+	visible, _ := viewable(user)
 
 	var deleteID int64
 
 	if req.Method == http.MethodPost {
 		deleteIDraw, deleteerr := strconv.Atoi(req.FormValue("deleteID"))
 		deleteID = int64(deleteIDraw)
-		if deleteerr != nil || req.FormValue("deleteID") == "" || deleteID < 0 || dsa.AVLsearch(mytickets.Root, deleteID) == nil {
-			submissionRecord.AddLog(fmt.Sprintf("Attempted assignment clearing by user %v, but invalid ticket ID input.", loggedin.Name))
+		todelete, ok := ticketindex.Get(deleteID)
+		if deleteerr != nil || req.FormValue("deleteID") == "" || deleteID < 0 || !ok || !visible(todelete) || (todelete.Assignee != username && !user.Can(dsa.EditAnyTicket)) {
+			submissionRecord.AddLog(fmt.Sprintf("Attempted assignment clearing by user %v, but invalid ticket ID input.", user.Name))
 			http.Error(res, "Invalid ticket ID input.", http.StatusForbidden)
 			return
 		}
-		todelete := dsa.AVLsearch(ticketlog.Root, deleteID)
-		ticketlog.Root = dsa.AVLdelete(ticketlog.Root, todelete.Ticket.TicketID)
-		ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v has been marked complete by user %v.", todelete.Ticket.TicketID, loggedin.Name))
+		ticketlog.Delete(todelete.TicketID)
+		ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v has been marked complete by user %v.", todelete.TicketID, user.Name))
+		commentlog.DeleteComments(todelete.TicketID)
+		emitEvent(webhook.TicketResolved, todelete, user.Name)
 	}
-	str := make([][]string, 0)
-	str = dsa.IOtraversal(myassigns.Root, priorities, products, statuses, categories, str)
+	str := printTickets(keepTickets(ticketindex.Assigned(username), visible))
 	owner := "My"
 	object := "Assignments"
 
@@ -864,81 +2177,342 @@ func markmyassignments(res http.ResponseWriter, req *http.Request) {
 	tpl.ExecuteTemplate(res, "deletetickets.gohtml", data)
 }
 
-func resorttickets(res http.ResponseWriter, req *http.Request) {
-	if !alreadyLoggedIn(req) {
-		http.Redirect(res, req, "/", http.StatusSeeOther)
+func teamqueue(res http.ResponseWriter, req *http.Request) {
+
+	user := requestUser(req)
+	team, ok := teams.GetTeam(req.FormValue("team"))
+	if req.FormValue("team") != "" && (!ok || (!team.HasMember(user.Name) && !user.Can(dsa.EditAnyTicket))) {
+		http.Error(res, "Invalid team.", http.StatusForbidden)
 		return
 	}
 
-	// Possible pivot options
-	options := []string{
-		"Product",
-		"Status",
-		"Category",
-		"Estimated Hours to Complete",
-		"Priority",
-		"Start Date",
-		"Due Date",
-		"Creator",
-		"Assignee",
-		"Title",
-		"Description",
+	// Process form submission
+	if req.Method == http.MethodPost && ok {
+		ticketID, err := strconv.ParseInt(req.FormValue("ticketID"), 10, 64)
+		current, found := ticketindex.Get(ticketID)
+		if err != nil || !found || current.Team != team.Name || !productAllows(user, current.Product, dsa.AccessView) {
+			ticketRecord.AddLog(fmt.Sprintf("Attempted team ticket assignment by user %v, but invalid ticket ID input.", user.Name))
+			http.Error(res, "Invalid ticket ID input.", http.StatusForbidden)
+			return
+		}
+		switch req.FormValue("action") {
+		case "claim":
+			if !team.HasMember(user.Name) {
+				http.Error(res, "Only members of the team may claim its tickets.", http.StatusForbidden)
+				return
+			}
+			// Checked again while updating, in case another member claimed the ticket first
+			claimed := false
+			updated, _ := ticketlog.Update(ticketID, func(ticket *dsa.Ticket) {
+				if ticket.Assignee == "" {
+					ticket.Assignee = user.Name
+					claimed = true
+				}
+			})
+			if !claimed {
+				http.Error(res, "Ticket has already been claimed.", http.StatusConflict)
+				return
+			}
+			ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v in team %s claimed by user %v.", ticketID, team.Name, user.Name))
+			emitEvent(webhook.TicketClaimed, updated, user.Name)
+		case "assign":
+			assignee := req.FormValue("assignee")
+			if team.Lead != user.Name && !user.Can(dsa.EditAnyTicket) {
+				http.Error(res, "Only the team lead may assign the team's tickets.", http.StatusForbidden)
+				return
+			}
+			if !team.HasMember(assignee) || !canWork(assignee) {
+				http.Error(res, "Assignee must be a member of the team.", http.StatusForbidden)
+				return
+			}
+			if !userAllows(assignee, current.Product, dsa.AccessView) {
+				http.Error(res, "Assignee does not have access to this product.", http.StatusForbidden)
+				return
+			}
+			var previous string
+			updated, _ := ticketlog.Update(ticketID, func(ticket *dsa.Ticket) {
+				previous = ticket.Assignee
+				ticket.Assignee = assignee
+			})
+			ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v in team %s assigned to user %v by user %v.", ticketID, team.Name, assignee, user.Name))
+			emitEvent(webhook.TicketClaimed, updated, user.Name)
+			if previous != assignee {
+				addNotification(user.Name, webhook.TicketClaimed, updated, fmt.Sprintf("Ticket #%d \"%s\" was reassigned from you to %s by %s.", updated.TicketID, updated.Title, assignee, user.Name), previous)
+			}
+		default:
+			http.Error(res, errInvalid.Error(), http.StatusForbidden)
+			return
+		}
+		http.Redirect(res, req, "/teamqueue?team="+url.QueryEscape(team.Name), http.StatusSeeOther)
+		return
 	}
-	prepivots := passPreload(options)
 
-	// Concurrently pre-pivot tickets for all approaches
-	if req.Method == http.MethodPost {
-		label := req.FormValue("criteria")
-		var pivotedtickets *dsa.AVLtree
-		for i := 0; i < len(options); i++ {
-			pivoted := <-prepivots
-			if pivoted.label == label {
-				pivotedtickets = pivoted.pivoted
+	// Teams to choose from: one's own, or every team for users who may edit any ticket
+	choices := teams.MemberOf(user.Name)
+	if user.Can(dsa.EditAnyTicket) {
+		choices = teams.AllTeams()
+	}
+	var queue, list [][]string
+	var page pager
+	if ok {
+		visible, all := viewable(user)
+		queue = printTickets(keepTickets(unclaimed(team.Name), visible))
+		from, size := pageRequest(req)
+		var tickets []dsa.Ticket
+		var total int
+		if all {
+			tickets, total = ticketindex.TeamRange(team.Name, from, size)
+		} else {
+			tickets, total = pageTickets(keepTickets(ticketindex.Team(team.Name), visible), from, size)
+		}
+		list = printTickets(tickets)
+		page = newPager(req, from, size, total)
+	}
+
+	data := struct {
+		Teams     []dsa.Team
+		Team      dsa.Team
+		Lead      bool
+		Member    bool
+		Unclaimed [][]string
+		Tickets   [][]string
+		Page      pager
+	}{
+		choices,
+		team,
+		ok && (team.Lead == user.Name || user.Can(dsa.EditAnyTicket)),
+		team.HasMember(user.Name),
+		queue,
+		list,
+		page,
+	}
+	tpl.ExecuteTemplate(res, "teamqueue.gohtml", data)
+}
+
+func resorttickets(res http.ResponseWriter, req *http.Request) {
+
+	labels := make([]string, len(sortOptions))
+	for i, option := range sortOptions {
+		labels[i] = option.label
+	}
+
+	// Process form submission. The form is submitted by GET, so that each page of the results can be linked to.
+	req.ParseForm()
+	if len(req.Form["key"]) > 0 {
+		var chosen []string
+		var descending []bool
+		for i, label := range req.Form["key"] {
+			if label == "" {
+				continue
 			}
+			chosen = append(chosen, label)
+			descending = append(descending, i < len(req.Form["order"]) && req.Form["order"][i] == "desc")
+		}
+		keys, field, described, err := sortKeysFor(chosen, descending)
+		if err != nil || len(keys) == 0 {
+			http.Error(res, "Please choose at least one valid sort key.", http.StatusForbidden)
+			return
 		}
 
-		str := make([][]string, 0)
-		str = dsa.IOtraversal(pivotedtickets.Root, priorities, products, statuses, categories, str)
+		user := requestUser(req)
+		input := strings.TrimSpace(req.FormValue("q"))
+		filter, err := query.Compile(input, queryEnv(user.Name))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusForbidden)
+			return
+		}
+		visible, all := viewable(user)
+		// Every order is the one dsa.Chain gives for the chosen keys. Each secondary index is itself sorted by the Chain of its field's key, so an unfiltered sort by a single ascending key,
+		// for a user who may view every product, is served a page at a time straight from the index. Otherwise tickets matching the filter (and visible to the user) are sorted by the Chain.
+		from, size := pageRequest(req)
+		var page []dsa.Ticket
+		var total int
+		if input == "" && len(keys) == 1 && !keys[0].Descending && all {
+			page, total = ticketindex.SortedRange(field, false, from, size)
+		} else {
+			matching := make([]dsa.Ticket, 0)
+			for _, ticket := range ticketindex.Sorted("TicketID", false) {
+				if filter(ticket) && visible(ticket) {
+					matching = append(matching, ticket)
+				}
+			}
+			less := dsa.Chain(keys...)
+			sort.Slice(matching, func(i, j int) bool {
+				return less(&dsa.TicketNode{Ticket: matching[i]}, &dsa.TicketNode{Ticket: matching[j]})
+			})
+			total = len(matching)
+			if from > total {
+				from = total
+			}
+			page = matching[from:]
+			if len(page) > size {
+				page = page[:size]
+			}
+		}
+		str := printTickets(page)
 
 		owner := "All"
-		object := fmt.Sprintf("Tickets (resorted by %s)", label)
+		if input != "" {
+			owner = "Matching"
+		}
+		object := fmt.Sprintf("Tickets (resorted by %s)", described)
 
 		data := struct {
 			Tickets [][]string
 			Owner   string
 			Object  string
+			Page    pager
 		}{
 			str,
 			owner,
 			object,
+			newPager(req, from, size, total),
 		}
 
 		tpl.ExecuteTemplate(res, "viewtickets.gohtml", data)
 		return
 	}
 
-	tpl.ExecuteTemplate(res, "resorttickets.gohtml", options)
+	data := struct {
+		Options []string
+		Keys    []int
+	}{
+		labels,
+		[]int{1, 2, 3},
+	}
+	tpl.ExecuteTemplate(res, "resorttickets.gohtml", data)
+}
+
+// events streams live updates to the browser as server-sent events. Each user only receives events concerning tickets they created or are assigned to, with admins additionally receiving submission queue changes.
+func events(res http.ResponseWriter, req *http.Request) {
+
+	user, ok := sessionUser(req)
+	if !ok {
+		http.Error(res, "Not logged in", http.StatusUnauthorized)
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		generalRecord.AddLog(fmt.Sprintf("User %s's connection doesn't support server-sent events", user.Name))
+		http.Error(res, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+
+	client := liveBroker.Subscribe(user.Name, user.Can(dsa.ApproveSubmissions))
+	defer liveBroker.Unsubscribe(client)
+	generalRecord.AddLog(fmt.Sprintf("User %s subscribed to live updates.", user.Name))
+
+	sse.Comment(res, "connected")
+	flusher.Flush()
+
+	// Send a comment periodically to prevent connection timeout.
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			generalRecord.AddLog(fmt.Sprintf("User %s unsubscribed from live updates.", user.Name))
+			return
+		case event := <-client.Events:
+			if err := sse.Write(res, event); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := sse.Comment(res, "keep-alive"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// apitickets serves the ticket log as JSON, one page at a time in TicketID order.
+// Pages are chosen either by number ("page" and "size"), or by cursor ("after", the TicketID of the last ticket already received, as returned in "next").
+func apitickets(res http.ResponseWriter, req *http.Request) {
+
+	root := ticketlog.Snapshot()
+	user := requestUser(req)
+	visible, all := viewable(user)
+	// Users who may not view every product page through only the tickets they may view
+	var matching []dsa.Ticket
+	if !all {
+		matching = keepTickets(collectTickets(root, nil), visible)
+	}
+	from, size := pageRequest(req)
+	if raw := req.FormValue("after"); raw != "" {
+		after, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(res, "Invalid cursor.", http.StatusBadRequest)
+			return
+		}
+		// Skip every ticket up to and including the cursor
+		if all {
+			from = dsa.AVLrank(root, &dsa.TicketNode{Ticket: dsa.Ticket{TicketID: after + 1}}, dsa.ByTicketID)
+		} else {
+			from = sort.Search(len(matching), func(i int) bool { return matching[i].TicketID > after })
+		}
+	}
+
+	var tickets []dsa.Ticket
+	var total int
+	if all {
+		tickets, total = dsa.AVLrange(root, from, size, make([]dsa.Ticket, 0)), dsa.AVLsize(root)
+	} else {
+		tickets, total = pageTickets(matching, from, size)
+	}
+	page := newPager(req, from, size, total)
+	data := struct {
+		Tickets []ticketEvent `json:"tickets"`
+		Page    int           `json:"page"`
+		Pages   int           `json:"pages"`
+		Total   int           `json:"total"`
+		Next    string        `json:"next,omitempty"`
+	}{
+		Tickets: make([]ticketEvent, 0, len(tickets)),
+		Page:    page.Number,
+		Pages:   page.Count,
+		Total:   page.Total,
+	}
+	for _, ticket := range tickets {
+		data.Tickets = append(data.Tickets, newTicketEvent(ticket, ""))
+	}
+	if len(tickets) > 0 && from+len(tickets) < page.Total {
+		data.Next = strconv.FormatInt(tickets[len(tickets)-1].TicketID, 10)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(data)
 }
 
 func logout(res http.ResponseWriter, req *http.Request) {
 
-	if !alreadyLoggedIn(req) {
+	session, ok := currentSession(req)
+	if !ok {
 		http.Redirect(res, req, "/", http.StatusSeeOther)
 		return
 	}
 	// Cookie management
-	currsesh, _ := req.Cookie("myCookie")
-	delete(mapSessions, currsesh.Value)
-	currsesh.MaxAge = -1
-	http.SetCookie(res, currsesh)
-	userRecord.AddLog(fmt.Sprintf("User %v has logged out. Session cookie has been deleted.", loggedin.Name))
+	sessions.Revoke(session.Hash)
+	http.SetCookie(res, &http.Cookie{Name: "myCookie", Path: "/", MaxAge: -1})
+	userRecord.AddLog(fmt.Sprintf("User %v has logged out. Session cookie has been deleted.", session.User))
 
 	// Saving Submissions to CSV
 	submissionsCSV.SaveSubmissions(submissions)
 	ticketsCSV.SaveTickets(ticketlog)
 	productsCSV.SaveProducts(products)
 	usersCSV.SaveUsers(users)
-	generalRecord.AddLog("Submissions, Tickets, Products and Users Saved.")
+	webhooksCSV.SaveWebhooks(hookDispatcher.Hooks())
+	commentsCSV.SaveComments(commentlog)
+	inboxCSV.SaveInbox(inbox)
+	filtersCSV.SaveFilters(filters)
+	teamsCSV.SaveTeams(teams)
+	productACLCSV.SaveProductAccess(productAccess)
+	resetTokensCSV.SaveResetTokens(resetTokens)
+	generalRecord.AddLog("Submissions, Tickets, Products, Users, Webhooks, Comments, Notifications, Filters, Teams, Product Access and Reset Tokens Saved.")
 
 	http.Redirect(res, req, "/", http.StatusSeeOther)
 }
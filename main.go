@@ -1,39 +1,126 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"goInAction2/assignment/packages/dsa"
+	"goInAction2/assignment/packages/duewatch"
 	"goInAction2/assignment/packages/hashcsv"
 	"goInAction2/assignment/packages/hashlog"
+	"goInAction2/assignment/packages/mailer"
+	"goInAction2/assignment/packages/mailin"
+	"goInAction2/assignment/packages/password"
+	"goInAction2/assignment/packages/search"
+	"goInAction2/assignment/packages/sse"
 	"goInAction2/assignment/packages/test"
+	"goInAction2/assignment/packages/throttle"
+	"goInAction2/assignment/packages/totp"
+	"goInAction2/assignment/packages/webhook"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
-// Used for pre-loading AVLtree pivots
-type pivotItem struct {
+// Used for re-sorting tickets by a chain of keys
+type sortOption struct {
 	label   string
-	pivoted *dsa.AVLtree
+	field   string // Name of the matching field in dsa.Sortfuncs, used to read tickets from the secondary index
+	compare dsa.Comparator
+}
+
+// Used for paginating ticket lists
+type pager struct {
+	Number int    // Current page, counting from 1
+	Count  int    // Total number of pages
+	Total  int    // Total number of tickets across all pages
+	Prev   string // Link to the previous page, if any
+	Next   string // Link to the next page, if any
 }
 
 var (
 	// Networking-related variables
-	tpl         *template.Template
-	mapSessions map[string]dsa.User
+	tpl *template.Template
+
+	// Logins, keyed by the hash of the token in each user's "myCookie" cookie; held in memory only, or also saved to csv (BUGTRACKER_SESSION_STORE)
+	sessions        dsa.SessionStore
+	sessionLifetime time.Duration
+	sessionIdle     time.Duration
 
 	// User-tracking variable
-	users    *[]*dsa.UserNode
-	loggedin dsa.User
+	users *dsa.Userlog
+
+	// Role given to accounts created through the sign up page; admins may assign other roles later
+	signupRole = dsa.RoleReporter
+
+	// Rules for new passwords and the bcrypt cost of their hashes, configured through the environment
+	passwords *password.Policy
+	// Compared against instead of a stored hash when a login names an unknown user, so that the response takes as long as for a wrong password
+	dummyHash []byte
+
+	// Failed logins, counted per username and per client address to slow down password guessing
+	loginsByUser *throttle.Limiter
+	loginsByAddr *throttle.Limiter
+
+	// Password resets: outstanding tokens, how long each stays valid, and the address of the app linked to in reset emails
+	resetTokens *dsa.Resettokens
+	resetTTL    time.Duration
+	baseURL     string
+
+	// Second factors: the key sealing TOTP secrets in the user store, roles which must enroll one, and logins waiting for one
+	totpSealer    *totp.Sealer
+	require2FA    []dsa.Role
+	pendingLogins = make(map[string]pendingLogin) // Cookie value -> login; guard with pendingMu
+	pendingMu     sync.Mutex
+
+	// Pagination of ticket lists; pages may ask for a different size, up to maxPageSize
+	defaultPageSize = 25
+	maxPageSize     = 100
 
 	// Ticket-tracking
 	ticketIDcounter int64
-	submissions     *[]dsa.Ticket
-	ticketlog       *dsa.AVLtree
-	mytickets       *dsa.AVLtree
-	myassigns       *dsa.AVLtree
+	submissions     *dsa.Submissionqueue
+	ticketlog       *dsa.Ticketlog   // Published copy-on-write; read through Snapshot
+	ticketindex     *dsa.Ticketindex // Secondary indexes over ticketlog, kept by it (ticketlog.Index); read only
+	commentlog      *dsa.Commentlog
+	inbox           *dsa.Inbox
+	searchIndex     *search.Index
+	filters         *dsa.Filterbook
+	teams           *dsa.Teamroster
+	productAccess   *dsa.Productaccess // Access lists of confidential products; check through productAllows and viewable
+
+	// Aging of queued submissions, configured through the environment; see dsa.Aging
+	submissionAging dsa.Aging
+
+	// Outbound webhooks
+	hookDispatcher *webhook.Dispatcher
+
+	// Live updates pushed to connected browsers
+	liveBroker = sse.NewBroker()
+
+	// Outbound email notifications. The relay is configured through the environment; leaving BUGTRACKER_SMTP_RELAY blank disables sending.
+	notifier *mailer.Mailer
+
+	// Due date reminders and escalation. Thresholds are configured through the environment.
+	dueWatcher *duewatch.Scheduler
+
+	// Inbound email, turned into submissions and comments. Users' personal addresses are in mailDomain.
+	mailDomain  = "bugtracker.localhost"
+	inboundMail = &mailin.Server{
+		Addr:     "localhost:2525",
+		Hostname: mailDomain,
+		Handler:  receiveMail,
+	}
 
 	// Categories
 	products   = &([]string{})
@@ -52,18 +139,40 @@ var (
 	errBlank = errors.New("blank input not allowed -- please try again")
 	// errInvalid signals that a disallowed blank input was provided
 	errInvalid = errors.New("invalid input -- please try again")
+	// errUnknownSender signals that an inbound email's sender does not match any account
+	errUnknownSender = errors.New("sender does not match the email address of any account")
+	// errWrongMailKey signals that an inbound email was not sent to one of its sender's personal addresses
+	errWrongMailKey = errors.New("recipient address does not carry the sender's personal key")
+	// errUnknownProduct signals that an inbound email's recipients do not match any product
+	errUnknownProduct = errors.New("recipient address does not match any product")
+	// errUnknownTicket signals that an inbound email replied to a ticket which does not exist
+	errUnknownTicket = errors.New("ticket ID does not match any ticket or submission")
+	// errNoAccess signals that a user tried to use a confidential product they have not been given access to
+	errNoAccess = errors.New("you do not have access to this product")
+	// errWrongCode signals that a second-factor code was wrong, expired or already used
+	errWrongCode = errors.New("code is incorrect or has already been used")
 
 	// Initialize Loggers
 	userRecord       = hashlog.Init("UserRecord")
 	generalRecord    = hashlog.Init("GeneralRecord")
 	ticketRecord     = hashlog.Init("TicketRecord")
 	submissionRecord = hashlog.Init("SubmissionRecord")
+	webhookRecord    = hashlog.Init("WebhookRecord")
+	mailRecord       = hashlog.Init("MailRecord")
 
 	// // Initialize Persistent Storage (CSV)
 	submissionsCSV = hashcsv.Init("submissions")
 	ticketsCSV     = hashcsv.Init("tickets")
 	productsCSV    = hashcsv.Init("products")
 	usersCSV       = hashcsv.Init("users")
+	webhooksCSV    = hashcsv.Init("webhooks")
+	commentsCSV    = hashcsv.Init("comments")
+	inboxCSV       = hashcsv.Init("notifications")
+	filtersCSV     = hashcsv.Init("filters")
+	teamsCSV       = hashcsv.Init("teams")
+	productACLCSV  = hashcsv.Init("productaccess")
+	resetTokensCSV = hashcsv.Init("resettokens")
+	sessionsCSV    = hashcsv.Init("sessions")
 )
 
 func init() {
@@ -71,16 +180,82 @@ func init() {
 	tpl = template.Must(template.ParseGlob("templates/*"))
 
 	// Initialize Data Structures
-	mapSessions = make(map[string]dsa.User)
 	users = dsa.NewHT()
-	submissions = &[]dsa.Ticket{}
-	ticketlog = dsa.NewAVLT(dsa.ByTicketID)
+	submissions = dsa.NewSubmissionqueue()
 
 	// Read in data from persistent storage, if any
+	submissionAging = dsa.Aging{
+		Step:      envDuration("BUGTRACKER_AGING_STEP", 7*24*time.Hour),
+		FairShare: envInt("BUGTRACKER_FAIR_SHARE", 0),
+	}
 	submissions = submissionsCSV.LoadSubmissions()
-	ticketlog.Root = ticketsCSV.LoadTickets()
+	submissions.SetAging(submissionAging)
+	ticketlog = dsa.NewTicketlog(ticketsCSV.LoadTickets())
+	ticketindex = ticketlog.Index()
 	products = productsCSV.LoadProducts()
 	users = usersCSV.LoadUsers()
+	usersCSV.SaveUsers(users) // Keeps the mail keys given to any users loaded without one
+	commentlog = commentsCSV.LoadComments()
+	inbox = inboxCSV.LoadInbox()
+	filters = filtersCSV.LoadFilters()
+	teams = teamsCSV.LoadTeams()
+	productAccess = productACLCSV.LoadProductAccess()
+	resetTokens = resetTokensCSV.LoadResetTokens()
+	sessionLifetime = envDuration("BUGTRACKER_SESSION_LIFETIME", 12*time.Hour)
+	sessionIdle = envDuration("BUGTRACKER_SESSION_IDLE", 30*time.Minute)
+	if envOr("BUGTRACKER_SESSION_STORE", "csv") == "memory" {
+		sessions = dsa.NewSessions(sessionLifetime, sessionIdle)
+	} else {
+		sessions = hashcsv.NewSessionStore(sessionsCSV, sessionLifetime, sessionIdle)
+	}
+	searchIndex = buildIndex()
+	hookDispatcher = webhook.New(webhooksCSV.LoadWebhooks())
+	hookDispatcher.Log = webhookRecord.AddLog
+
+	var relayAuth smtp.Auth
+	if username := envOr("BUGTRACKER_SMTP_USERNAME", ""); username != "" {
+		relayAuth = smtp.PlainAuth("", username, envOr("BUGTRACKER_SMTP_PASSWORD", ""), envOr("BUGTRACKER_SMTP_HOST", "localhost"))
+	}
+	notifier = mailer.New(envOr("BUGTRACKER_SMTP_RELAY", ""), envOr("BUGTRACKER_MAIL_FROM", "bugtracker@localhost"), relayAuth, 2, 100)
+	notifier.Log = mailRecord.AddLog
+
+	passwords = password.New(envInt("BUGTRACKER_PASSWORD_MIN_LENGTH", 8), envInt("BUGTRACKER_BCRYPT_COST", bcrypt.DefaultCost))
+	if count, err := passwords.LoadBlocklist(envOr("BUGTRACKER_PASSWORD_BLOCKLIST", "blocklist/passwords.txt")); err != nil {
+		generalRecord.AddLog(fmt.Sprintf("Password blocklist not loaded: %s", err))
+	} else {
+		generalRecord.AddLog(fmt.Sprintf("Password blocklist loaded (%d passwords).", count))
+	}
+	var err error
+	if dummyHash, err = passwords.Hash("no account has this password"); err != nil {
+		log.Fatal("Failed to hash placeholder password: ", err)
+	}
+	loginsByUser = throttle.New(envInt("BUGTRACKER_LOGIN_FREE_ATTEMPTS", 3), time.Second, time.Minute)
+	loginsByUser.LockAfter = envInt("BUGTRACKER_LOCKOUT_AFTER", 10)
+	loginsByUser.LockFor = envDuration("BUGTRACKER_LOCKOUT_DURATION", 15*time.Minute)
+	// Addresses get more leeway, since several users may share one
+	loginsByAddr = throttle.New(envInt("BUGTRACKER_LOGIN_FREE_ATTEMPTS", 3)*5, time.Second, time.Minute)
+	loginsByAddr.LockAfter = loginsByUser.LockAfter * 5
+	loginsByAddr.LockFor = loginsByUser.LockFor
+	resetTTL = envDuration("BUGTRACKER_RESET_TTL", time.Hour)
+	baseURL = strings.TrimSuffix(envOr("BUGTRACKER_BASE_URL", "https://localhost:8081"), "/")
+
+	key, err := loadTOTPKey(envOr("BUGTRACKER_TOTP_KEY", ""), envOr("BUGTRACKER_TOTP_KEYFILE", "cert/totp.key"))
+	if err != nil {
+		log.Fatal("Failed to load TOTP key: ", err)
+	}
+	if totpSealer, err = totp.NewSealer(key); err != nil {
+		log.Fatal("Failed to load TOTP key: ", err)
+	}
+	for _, name := range strings.Split(envOr("BUGTRACKER_REQUIRE_2FA", ""), ",") {
+		if role, ok := dsa.ParseRole(strings.TrimSpace(name)); ok {
+			require2FA = append(require2FA, role)
+		}
+	}
+
+	dueWatcher = duewatch.New(func() []dsa.Ticket { return collectTickets(ticketlog.Snapshot(), nil) }, envDuration("BUGTRACKER_DUE_INTERVAL", time.Hour), envDuration("BUGTRACKER_DUE_SOON", 48*time.Hour))
+	dueWatcher.EscalateAfter = envDuration("BUGTRACKER_ESCALATE_AFTER", 0)
+	dueWatcher.Escalate = escalateTicket
+	dueWatcher.Notify = notifyDue
 }
 
 func main() {
@@ -89,9 +264,18 @@ func main() {
 		if err := recover(); err != nil {
 			generalRecord.AddLog(fmt.Sprintf("%s: %s", msg, err))
 			generalRecord.AddLog("Resetting data structure states. Previous data not saved.")
-			submissions = &[]dsa.Ticket{}
+			submissions = dsa.NewSubmissionqueue()
+			submissions.SetAging(submissionAging)
 			users = dsa.NewHT()
-			ticketlog = dsa.NewAVLT(dsa.ByTicketID)
+			ticketlog = dsa.NewTicketlog(nil)
+			ticketindex = ticketlog.Index()
+			commentlog = dsa.NewCommentlog()
+			inbox = dsa.NewInbox()
+			searchIndex = search.NewIndex()
+			filters = dsa.NewFilterbook()
+			teams = dsa.NewTeamroster()
+			productAccess = dsa.NewProductaccess()
+			resetTokens = dsa.NewResettokens()
 			products = &([]string{})
 			statuses = &([]string{"Not Started", "In Progress", "Paused"})
 			categories = &([]string{"New feature", "Bug", "Enhancement"})
@@ -101,6 +285,16 @@ func main() {
 			ticketsCSV.SaveTickets(ticketlog)
 			productsCSV.SaveProducts(products)
 			usersCSV.SaveUsers(users)
+			webhooksCSV.SaveWebhooks(hookDispatcher.Hooks())
+			commentsCSV.SaveComments(commentlog)
+			inboxCSV.SaveInbox(inbox)
+			filtersCSV.SaveFilters(filters)
+			teamsCSV.SaveTeams(teams)
+			productACLCSV.SaveProductAccess(productAccess)
+			resetTokensCSV.SaveResetTokens(resetTokens)
+			sessions.Expire(time.Now())
+			dueWatcher.Stop()
+			notifier.Close()
 			generalRecord.AddLog("Exited safely.")
 		}
 	}()
@@ -117,35 +311,101 @@ func main() {
 	http.Handle("/favicon.ico", http.NotFoundHandler())
 	http.HandleFunc("/signup", signup)
 	http.HandleFunc("/login", login)
+	http.HandleFunc("/login2fa", login2fa)
+	http.HandleFunc("/forgotpassword", forgotpassword)
+	http.HandleFunc("/resetpassword", resetpassword)
 	http.HandleFunc("/viewusers", viewusers)
 	http.HandleFunc("/demo", demo)
 
-	// Admin features
-	http.HandleFunc("/adduser", adduser)
-	http.HandleFunc("/edituser", edituser)
-	http.HandleFunc("/deleteuser", deleteuser)
-	http.HandleFunc("/manprods", manprods)
-	http.HandleFunc("/addproducts", addproducts)
-	http.HandleFunc("/editproducts", editproducts)
-	http.HandleFunc("/deleteproducts", deleteproducts)
-	http.HandleFunc("/managesubmissions", managesubmissions)
+	// Admin features; each page requires a permission, granted through the user's role (see dsa.Role)
+	http.HandleFunc("/adduser", requirePermission(dsa.ManageUsers, "admin add user", adduser))
+	http.HandleFunc("/edituser", requirePermission(dsa.ManageUsers, "admin edit user", edituser))
+	http.HandleFunc("/deleteuser", requirePermission(dsa.ManageUsers, "admin delete user", deleteuser))
+	http.HandleFunc("/manprods", requirePermission(dsa.ManageProducts, "admin manage products", manprods))
+	http.HandleFunc("/addproducts", requirePermission(dsa.ManageProducts, "admin add products", addproducts))
+	http.HandleFunc("/editproducts", requirePermission(dsa.ManageProducts, "admin edit products", editproducts))
+	http.HandleFunc("/deleteproducts", requirePermission(dsa.ManageProducts, "admin delete products", deleteproducts))
+	http.HandleFunc("/productmembers", requirePermission(dsa.ViewTickets, "product members", productmembers))
+	http.HandleFunc("/managesubmissions", requirePermission(dsa.ApproveSubmissions, "manage submissions", managesubmissions))
+	http.HandleFunc("/webhooks", requirePermission(dsa.ManageSystem, "admin manage webhooks", webhooks))
+	http.HandleFunc("/webhookdeliveries", requirePermission(dsa.ManageSystem, "admin webhook deliveries", webhookdeliveries))
+	http.HandleFunc("/diagnostics", requirePermission(dsa.ManageSystem, "admin diagnostics", diagnostics))
+	http.HandleFunc("/teams", requirePermission(dsa.ManageUsers, "admin manage teams", manageteams))
+	http.HandleFunc("/lockouts", requirePermission(dsa.ManageUsers, "admin unlock accounts", lockouts))
 
 	// Non-Admin features
-	http.HandleFunc("/submitticket", submitticket)
-	http.HandleFunc("/submitted", submitted)
-	http.HandleFunc("/viewmytickets", viewmytickets)
-	http.HandleFunc("/deletemytickets", deletemytickets)
-	http.HandleFunc("/viewmyassignments", viewmyassignments)
-	http.HandleFunc("/markmyassignments", markmyassignments)
-	http.HandleFunc("/viewalltickets", viewalltickets)
-	http.HandleFunc("/ressorttickets", resorttickets)
-	http.HandleFunc("/viewsubmissions", viewsubmissions)
+	http.HandleFunc("/submitticket", requirePermission(dsa.SubmitTickets, "submit ticket", submitticket))
+	http.HandleFunc("/submitted", requirePermission(dsa.SubmitTickets, "ticket submitted", submitted))
+	http.HandleFunc("/viewmytickets", requirePermission(dsa.SubmitTickets, "view my tickets", viewmytickets))
+	http.HandleFunc("/deletemytickets", requirePermission(dsa.SubmitTickets, "delete my tickets", deletemytickets))
+	http.HandleFunc("/viewmyassignments", requirePermission(dsa.WorkTickets, "view my assignments", viewmyassignments))
+	http.HandleFunc("/updatemyassignments", requirePermission(dsa.WorkTickets, "update my assignments", updatemyassignments))
+	http.HandleFunc("/markmyassignments", requirePermission(dsa.WorkTickets, "mark my assignments", markmyassignments))
+	http.HandleFunc("/teamqueue", requirePermission(dsa.WorkTickets, "team queue", teamqueue))
+	http.HandleFunc("/viewalltickets", requirePermission(dsa.ViewTickets, "view all tickets", viewalltickets))
+	http.HandleFunc("/ressorttickets", requirePermission(dsa.ViewTickets, "re-sort tickets", resorttickets))
+	http.HandleFunc("/viewsubmissions", requirePermission(dsa.ViewTickets, "view submissions", viewsubmissions))
+	http.HandleFunc("/comments", requirePermission(dsa.ViewTickets, "ticket comments", comments))
+	http.HandleFunc("/preferences", preferences)
+	http.HandleFunc("/profile", profile)
+	http.HandleFunc("/twofactor", twofactor)
+	http.HandleFunc("/sessions", activesessions)
+	http.HandleFunc("/inbox", viewinbox)
+	http.HandleFunc("/duedates", requirePermission(dsa.ViewTickets, "due dates", duedates))
+	http.HandleFunc("/search", requirePermission(dsa.ViewTickets, "search", searchtickets))
+	http.HandleFunc("/filters", requirePermission(dsa.ViewTickets, "saved filters", savedfilters))
 
+	http.HandleFunc("/events", events)
+	http.HandleFunc("/api/tickets", requireAPIPermission(dsa.ViewTickets, apitickets))
 	http.HandleFunc("/logout", logout)
 	wg.Wait()
-	err := http.ListenAndServeTLS(":8081", "./cert/cert.pem", "./cert/key.pem", nil)
-	// err := http.ListenAndServe(":8081", nil)
-	if err != nil {
-		log.Fatal(err)
+
+	// Listen for inbound email alongside the web server
+	go func() {
+		if err := inboundMail.ListenAndServe(); err != nil && err != mailin.ErrServerClosed {
+			generalRecord.AddLog(fmt.Sprintf("Inbound email listener stopped: %s", err))
+		}
+	}()
+
+	// Periodically remind users of tickets due soon or overdue
+	go dueWatcher.Run()
+
+	// Periodically discard expired sessions, which also saves the last-used times of persisted ones
+	go func() {
+		for range time.Tick(time.Minute) {
+			if count := sessions.Expire(time.Now()); count > 0 {
+				generalRecord.AddLog(fmt.Sprintf("%d expired sessions discarded.", count))
+			}
+		}
+	}()
+
+	// Serve until interrupted, then stop taking requests and let those in progress finish, so that main returns and the deferred save above runs
+	// Live update streams only end when their request context does, so it is cancelled once shutdown starts
+	stopping, stop := context.WithCancel(context.Background())
+	server := &http.Server{
+		Addr:        ":8081",
+		BaseContext: func(net.Listener) context.Context { return stopping },
+	}
+	server.RegisterOnShutdown(stop)
+	shutdown := make(chan struct{})
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+		received := <-interrupt
+		generalRecord.AddLog(fmt.Sprintf("Received %s; shutting down.", received))
+		inboundMail.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			generalRecord.AddLog(fmt.Sprintf("Requests still in progress at shutdown were cut off: %s", err))
+		}
+		close(shutdown)
+	}()
+
+	err := server.ListenAndServeTLS("./cert/cert.pem", "./cert/key.pem")
+	// err := server.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err) // Exits without saving; nothing has changed if the server could not start
 	}
+	<-shutdown
 }
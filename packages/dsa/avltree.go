@@ -34,49 +34,15 @@ func IOtraversal(avlroot *TicketNode, priorities, products, statuses, categories
 func AVLinsert(newticket *TicketNode,
 	sortfunc func(newticket *TicketNode, junction *TicketNode) bool,
 	subtree *TicketNode) *TicketNode {
+	return avlInsert(newticket, sortfunc, subtree, inplace[*TicketNode])
+}
 
-	// BST Insertion
-	if subtree == nil {
-		newticket.Height = 1
-		return (newticket)
-	}
-
-	if sortfunc(newticket, subtree) {
-		subtree.Left = AVLinsert(newticket, sortfunc, subtree.Left)
-	} else {
-		subtree.Right = AVLinsert(newticket, sortfunc, subtree.Right)
-	}
-
-	// Update heights of parent nodes
-	subtree.Height = 1 + max(height(subtree.Left), height(subtree.Right))
-
-	// Check if parent nodes balanced
-	bf := getbf(subtree)
-
-	// Left Left
-	if bf > 1 && sortfunc(newticket, subtree.Left) {
-		return rightrotate(subtree)
-	}
-
-	// Right Right
-	if bf < -1 && !sortfunc(newticket, subtree.Right) {
-		return leftrotate(subtree)
-	}
-
-	// Left Right
-	if bf > 1 && !sortfunc(newticket, subtree.Left) {
-		subtree.Left = leftrotate(subtree.Left)
-		return rightrotate(subtree)
-	}
-
-	// Right Left
-	if bf < -1 && sortfunc(newticket, subtree.Right) {
-		subtree.Right = rightrotate(subtree.Right)
-		return leftrotate(subtree)
-	}
-
-	// No change needed because balanced
-	return subtree
+// AVLinsertCopy is the persistent version of AVLinsert: rather than modifying the tree, it copies the nodes along the path to the new node (and any it rotates), leaving the original tree intact.
+// Returns root of the new version of the subtree, which shares all unmodified nodes with the original.
+func AVLinsertCopy(newticket *TicketNode,
+	sortfunc func(newticket *TicketNode, junction *TicketNode) bool,
+	subtree *TicketNode) *TicketNode {
+	return avlInsert(newticket, sortfunc, subtree, pathcopy[*TicketNode])
 }
 
 // Mytickets traverses an AVL tree (at a given root node), and returns pointer to a subsetted AVL tree containing only nodes with a particular username as creator.
@@ -148,80 +114,34 @@ func AVLpivot(source, destination *TicketNode,
 // Returns root of the modified subtree.
 // Important: Assumes tree is sorted by ticketID.
 func AVLdelete(subtree *TicketNode, targetID int64) *TicketNode {
-	if subtree == nil {
-		return subtree
-	}
-
-	// Does root node contain key to be deleted? If not,
-	// Does key to be deleted lie to the left or right subtree?
-	if avlSearchDirect(subtree, targetID) == -1 {
-		subtree.Left = AVLdelete(subtree.Left, targetID)
-	} else if avlSearchDirect(subtree, targetID) == 1 {
-		subtree.Right = AVLdelete(subtree.Right, targetID)
-	} else {
-		var tmp *TicketNode
-
-		// Node with one subtree or less
-		if subtree.Left == nil || subtree.Right == nil {
-			if subtree.Left == nil {
-				tmp = subtree.Left
-			} else {
-				tmp = subtree.Right
-			}
-
-			if tmp == nil { // Node with no subtrees
-				tmp = subtree
-				subtree = nil
-			} else { // Node with one subtree
-				*subtree = *tmp
-			}
-		} else {
-			// Node with two subtrees (get inorder successor, smallest in right subtree)
-			tmp = MinIDnode(subtree.Right)
-
-			// Copy inorder successor's data to this node
-			subtree.Ticket = tmp.Ticket
-
-			// Delete inorder successor
-			subtree.Right = AVLdelete(subtree.Right, tmp.Ticket.TicketID)
-		}
-	}
-
-	// If tree only has one lone node, return
-	if subtree == nil {
-		return subtree
-	}
-
-	// Update height of current node
-	subtree.Height = 1 + max(height(subtree.Left), height(subtree.Right))
-
-	// Check if parent nodes balanced
-	bf := getbf(subtree)
-
-	// Left Left
-	if bf > 1 && getbf(subtree.Left) >= 0 {
-		return rightrotate(subtree)
-	}
+	return AVLdeleteBy(subtree, &TicketNode{Ticket: Ticket{TicketID: targetID}}, ByTicketID)
+}
 
-	// Right Right
-	if bf < -1 && getbf(subtree.Right) <= 0 {
-		return leftrotate(subtree)
-	}
+// AVLdeleteBy recursively deletes the node holding a target ticket from a tree sorted by any sortfunc, does required rotations.
+// The target must hold the ticket's values as they were when it was inserted, since those determine where it sits in the tree.
+// Returns root of the modified subtree.
+func AVLdeleteBy(subtree, target *TicketNode,
+	sortfunc func(newticket *TicketNode, junction *TicketNode) bool) *TicketNode {
+	return avlDelete(subtree, target, sortfunc, inplace[*TicketNode])
+}
 
-	// Left Right
-	if bf > 1 && getbf(subtree.Left) < 0 {
-		subtree.Left = leftrotate(subtree.Left)
-		return rightrotate(subtree)
-	}
+// AVLdeleteCopy is the persistent version of AVLdelete: rather than modifying the tree, it copies the nodes along the path to the deleted node (and any it rotates), leaving the original tree intact.
+// Returns root of the new version of the subtree. Important: Assumes tree is sorted by ticketID.
+func AVLdeleteCopy(subtree *TicketNode, targetID int64) *TicketNode {
+	return avlDelete(subtree, &TicketNode{Ticket: Ticket{TicketID: targetID}}, ByTicketID, pathcopy[*TicketNode])
+}
 
-	// Right Left
-	if bf < -1 && getbf(subtree.Right) > 0 {
-		subtree.Right = rightrotate(subtree.Right)
-		return leftrotate(subtree)
-	}
+// AVLreplaceCopy returns a new version of a tree in which the ticket with the same TicketID as a given ticket is replaced by it, copying the nodes along the path to it and leaving the original tree intact.
+// Important: Assumes tree is sorted by ticketID, and that the ticket is in the tree.
+func AVLreplaceCopy(subtree *TicketNode, ticket Ticket) *TicketNode {
+	return avlReplace(subtree, &TicketNode{Ticket: ticket}, ByTicketID, pathcopy[*TicketNode])
+}
 
-	// No change needed because balanced
-	return subtree
+// AVLfind searches a tree sorted by any sortfunc for the node holding a target ticket, returning its pointer (or nil, if it is not in the tree).
+// As with AVLdeleteBy, the target must hold the ticket's values as they were when it was inserted.
+func AVLfind(subtree, target *TicketNode,
+	sortfunc func(newticket *TicketNode, junction *TicketNode) bool) *TicketNode {
+	return avlFind(subtree, target, sortfunc)
 }
 
 // AVLsearch searches the AVLtree (sorted by ticketID only) and returns to pointer to that node, if it exists (otherwise, returns nil).
@@ -238,6 +158,37 @@ func AVLsearch(subtree *TicketNode, targetID int64) *TicketNode {
 	return subtree // Implicitly only gets here if targetID not contined in tree
 }
 
+// AVLsize returns the number of nodes in the subtree with a given root. Runs in O(1).
+func AVLsize(subtree *TicketNode) int {
+	_, size := subtree.dims()
+	return size
+}
+
+// AVLselect returns the node at a given rank (counting from 0) in the order of the tree, or nil if the rank is out of range. Runs in O(log n).
+func AVLselect(subtree *TicketNode, rank int) *TicketNode {
+	return avlSelect(subtree, rank)
+}
+
+// AVLrank returns the number of nodes in a tree sorted by sortfunc which sort before a target, i.e. the rank the target has (or would have, if it is not in the tree). Runs in O(log n).
+func AVLrank(subtree, target *TicketNode,
+	sortfunc func(newticket *TicketNode, junction *TicketNode) bool) int {
+	return avlRank(subtree, target, sortfunc)
+}
+
+// AVLrange returns, in order, up to limit tickets starting from a given rank (counting from 0).
+// Subtrees lying wholly before the starting rank are skipped using their sizes, so only O(log n + limit) nodes are visited.
+func AVLrange(subtree *TicketNode, from, limit int, result []Ticket) []Ticket {
+	if limit <= 0 {
+		return result
+	}
+	avlAscend(subtree, from, func(node *TicketNode) bool {
+		result = append(result, node.Ticket)
+		limit--
+		return limit > 0
+	})
+	return result
+}
+
 // AVL tree sortfuncs;
 // Returns bool for program flow control; true and false direct tree traversal/recursion left and right, respectively
 
@@ -369,63 +320,25 @@ func avlSearchDirect(subtree *TicketNode, targetID int64) int {
 	return 1
 }
 
-// Calculates the height of the AVL subtree with a given root.
-func height(tree *TicketNode) int {
-	if tree == nil {
-		return 0
-	}
-
-	lheight := height(tree.Left)
-	rheight := height(tree.Right)
-
-	if lheight > rheight {
-		return (lheight + 1)
-	}
-	return (rheight + 1)
-}
-
-// Returns max of two integers
-func max(a, b int) int {
-	if a > b {
-		return a
-	}
-	return b
-}
+// TicketNode implements avlnode, so that the AVL algorithms shared with AVLTree can be applied to ticket trees.
 
-// Rotates subtree at a given root right
-func rightrotate(subtree *TicketNode) *TicketNode {
-	leftsub := subtree.Left
-	orphan := leftsub.Right
+func (node *TicketNode) left() *TicketNode          { return node.Left }
+func (node *TicketNode) right() *TicketNode         { return node.Right }
+func (node *TicketNode) setLeft(child *TicketNode)  { node.Left = child }
+func (node *TicketNode) setRight(child *TicketNode) { node.Right = child }
+func (node *TicketNode) setDims(height, size int)   { node.Height, node.Size = height, size }
+func (node *TicketNode) copyFrom(other *TicketNode) { node.Ticket = other.Ticket }
 
-	leftsub.Right = subtree
-	subtree.Left = orphan
-
-	subtree.Height = max(height(subtree.Left), height(subtree.Right)+1)
-	leftsub.Height = max(height(leftsub.Left), height(leftsub.Right)+1)
-
-	return leftsub
+func (node *TicketNode) duplicate() *TicketNode {
+	copied := *node
+	return &copied
 }
 
-// Rotates subtree at a given root left
-func leftrotate(subtree *TicketNode) *TicketNode {
-	rightsub := subtree.Right
-	orphan := rightsub.Left
-
-	rightsub.Left = subtree
-	subtree.Right = orphan
-
-	subtree.Height = max(height(subtree.Left), height(subtree.Right)+1)
-	rightsub.Height = max(height(rightsub.Left), height(rightsub.Right)+1)
-
-	return rightsub
-}
-
-// Calculate balance factor for the root of a given subtree
-func getbf(subtree *TicketNode) int {
-	if subtree == nil {
-		return 0
+func (node *TicketNode) dims() (int, int) {
+	if node == nil {
+		return 0, 0
 	}
-	return height(subtree.Left) - height(subtree.Right)
+	return node.Height, node.Size
 }
 
 // MinIDnode returns the node within a subtree with the minimum key value in that tree
@@ -0,0 +1,62 @@
+package dsa
+
+import (
+	"cmp"
+	"sync"
+	"time"
+)
+
+// Comment struct logs a remark left on a ticket or submission.
+type Comment struct {
+	TicketID int64
+	Author   string
+	Body     string
+	Posted   time.Time
+}
+
+// Commentlog groups comments by the TicketID they belong to, in an AVLTree ordered by TicketID. Safe for concurrent use, as comments may arrive by email while handlers are serving requests.
+type Commentlog struct {
+	mu       sync.Mutex
+	byTicket *AVLTree[int64, []Comment]
+}
+
+// NewCommentlog initializes an empty comment log.
+func NewCommentlog() *Commentlog {
+	return &Commentlog{byTicket: NewAVLTree[int64, []Comment](cmp.Compare[int64])}
+}
+
+// AddComment appends a comment to the thread of its ticket.
+func (cl *Commentlog) AddComment(comment Comment) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	thread, _ := cl.byTicket.Get(comment.TicketID)
+	cl.byTicket.Put(comment.TicketID, append(thread, comment))
+}
+
+// Comments returns a copy of the comments left on a ticket, in the order posted.
+func (cl *Commentlog) Comments(ticketID int64) []Comment {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	thread, _ := cl.byTicket.Get(ticketID)
+	result := make([]Comment, len(thread))
+	copy(result, thread)
+	return result
+}
+
+// DeleteComments removes every comment left on a ticket, e.g. when the ticket is deleted from the log.
+func (cl *Commentlog) DeleteComments(ticketID int64) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.byTicket.Delete(ticketID)
+}
+
+// AllComments returns every comment in the log, ordered by TicketID and then by the order posted.
+func (cl *Commentlog) AllComments() []Comment {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	result := make([]Comment, 0)
+	for _, thread := range cl.byTicket.All() {
+		result = append(result, thread...)
+	}
+	return result
+}
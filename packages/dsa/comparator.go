@@ -0,0 +1,115 @@
+package dsa
+
+import (
+	"strings"
+)
+
+// Comparator compares two tickets on a single key, returning a negative number if a sorts before b, zero if they tie, and a positive number if a sorts after b.
+type Comparator func(a, b Ticket) int
+
+// SortKey pairs a Comparator with the direction it is applied in.
+type SortKey struct {
+	Compare    Comparator
+	Descending bool
+}
+
+// Chain combines an ordered list of sort keys into a sortfunc which can be passed to AVLinsert and AVLpivot.
+// Tickets are ordered by the first key; ties are broken by each following key in turn, and finally by TicketID (ascending) so that no two tickets ever tie.
+func Chain(keys ...SortKey) func(newticket *TicketNode, junction *TicketNode) bool {
+	return func(newticket *TicketNode, junction *TicketNode) bool {
+		for _, key := range keys {
+			c := key.Compare(newticket.Ticket, junction.Ticket)
+			if key.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return ByTicketID(newticket, junction)
+	}
+}
+
+// Ticket comparators, one per sortable field. Text fields compare case-insensitively.
+
+// CompareTicketID
+func CompareTicketID(a, b Ticket) int {
+	return compareInt64(a.TicketID, b.TicketID)
+}
+
+// CompareProduct
+func CompareProduct(a, b Ticket) int {
+	return compareInt64(int64(a.Product), int64(b.Product))
+}
+
+// CompareStatus
+func CompareStatus(a, b Ticket) int {
+	return compareInt64(int64(a.Status), int64(b.Status))
+}
+
+// CompareCategory
+func CompareCategory(a, b Ticket) int {
+	return compareInt64(int64(a.Category), int64(b.Category))
+}
+
+// ComparePriority
+func ComparePriority(a, b Ticket) int {
+	return compareInt64(int64(a.Priority), int64(b.Priority))
+}
+
+// CompareEstHours
+func CompareEstHours(a, b Ticket) int {
+	return compareInt64(int64(a.EstHours), int64(b.EstHours))
+}
+
+// CompareStartDate
+func CompareStartDate(a, b Ticket) int {
+	if a.StartDate.Before(b.StartDate) {
+		return -1
+	} else if a.StartDate.After(b.StartDate) {
+		return 1
+	}
+	return 0
+}
+
+// CompareDueDate
+func CompareDueDate(a, b Ticket) int {
+	if a.DueDate.Before(b.DueDate) {
+		return -1
+	} else if a.DueDate.After(b.DueDate) {
+		return 1
+	}
+	return 0
+}
+
+// CompareCreator
+func CompareCreator(a, b Ticket) int {
+	return strings.Compare(strings.ToLower(a.Creator), strings.ToLower(b.Creator))
+}
+
+// CompareAssignee
+func CompareAssignee(a, b Ticket) int {
+	return strings.Compare(strings.ToLower(a.Assignee), strings.ToLower(b.Assignee))
+}
+
+// CompareTitle
+func CompareTitle(a, b Ticket) int {
+	return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+}
+
+// CompareDescription
+func CompareDescription(a, b Ticket) int {
+	return strings.Compare(strings.ToLower(a.Description), strings.ToLower(b.Description))
+}
+
+// Utility functions
+
+// Returns -1, 0 or 1 as a is less than, equal to or greater than b.
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
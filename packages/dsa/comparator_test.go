@@ -0,0 +1,108 @@
+package dsa
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Returns n tickets with few distinct values per field, so that sorts have plenty of ties to break.
+func randomTickets(rng *rand.Rand, n int) []Ticket {
+	names := []string{"alice", "Bob", "carol", "", "ALICE"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tickets := make([]Ticket, n)
+	for i := range tickets {
+		tickets[i] = Ticket{
+			TicketID:  int64(i), // Unique, as in the ticket log
+			Product:   rng.Intn(3),
+			Status:    rng.Intn(3),
+			Category:  rng.Intn(3),
+			Priority:  rng.Intn(3),
+			EstHours:  rng.Intn(4),
+			StartDate: start.AddDate(0, 0, rng.Intn(5)),
+			DueDate:   start.AddDate(0, 0, rng.Intn(5)),
+			Creator:   names[rng.Intn(len(names))],
+			Assignee:  names[rng.Intn(len(names))],
+			Title:     names[rng.Intn(len(names))],
+		}
+	}
+	rng.Shuffle(len(tickets), func(i, j int) { tickets[i], tickets[j] = tickets[j], tickets[i] })
+	return tickets
+}
+
+// Sorts a copy of tickets by a chain of keys.
+func chainSorted(tickets []Ticket, keys ...SortKey) []Ticket {
+	result := append([]Ticket(nil), tickets...)
+	less := Chain(keys...)
+	sort.Slice(result, func(i, j int) bool {
+		return less(&TicketNode{Ticket: result[i]}, &TicketNode{Ticket: result[j]})
+	})
+	return result
+}
+
+func TestIndexOrderMatchesChain(t *testing.T) {
+	comparators := map[string]Comparator{
+		"Product":     CompareProduct,
+		"Status":      CompareStatus,
+		"Category":    CompareCategory,
+		"Priority":    ComparePriority,
+		"EstHours":    CompareEstHours,
+		"StartDate":   CompareStartDate,
+		"DueDate":     CompareDueDate,
+		"Creator":     CompareCreator,
+		"Assignee":    CompareAssignee,
+		"Title":       CompareTitle,
+		"Description": CompareDescription,
+		"TicketID":    CompareTicketID,
+	}
+	tickets := randomTickets(rand.New(rand.NewSource(1)), 500)
+	ti := NewTicketindex()
+	for _, ticket := range tickets {
+		ti.Insert(ticket)
+	}
+	for field := range Sortfuncs {
+		want := chainSorted(tickets, SortKey{Compare: comparators[field]})
+		got := ti.Sorted(field, false)
+		if len(got) != len(want) {
+			t.Fatalf("%s: index holds %d tickets, want %d", field, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].TicketID != want[i].TicketID {
+				t.Errorf("%s: position %d holds ticket %d, Chain puts ticket %d there", field, i, got[i].TicketID, want[i].TicketID)
+				break
+			}
+		}
+	}
+}
+
+func TestChainBreaksTies(t *testing.T) {
+	tickets := randomTickets(rand.New(rand.NewSource(2)), 300)
+	keys := []SortKey{
+		{Compare: ComparePriority},
+		{Compare: CompareDueDate, Descending: true},
+		{Compare: CompareAssignee},
+	}
+	sorted := chainSorted(tickets, keys...)
+	for i := 1; i < len(sorted); i++ {
+		a, b := sorted[i-1], sorted[i]
+		switch {
+		case a.Priority != b.Priority:
+			if a.Priority > b.Priority {
+				t.Fatalf("position %d: priority %d before %d", i, a.Priority, b.Priority)
+			}
+		case !a.DueDate.Equal(b.DueDate):
+			if a.DueDate.Before(b.DueDate) {
+				t.Fatalf("position %d: due date %v before %v, want descending", i, a.DueDate, b.DueDate)
+			}
+		case CompareAssignee(a, b) != 0:
+			if CompareAssignee(a, b) > 0 {
+				t.Fatalf("position %d: assignee %q before %q", i, a.Assignee, b.Assignee)
+			}
+		default:
+			if a.TicketID > b.TicketID {
+				t.Fatalf("position %d: full tie not broken by ascending TicketID (%d before %d)", i, a.TicketID, b.TicketID)
+			}
+		}
+	}
+}
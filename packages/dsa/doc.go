@@ -3,8 +3,8 @@
    Ticket is a custom struct containing all the fields to be tracked, pivoted, edited and displayed.
    It underlies both the priority queue and AVL tree data structures implemented in the application.
    For storage and handling of the data across function calls, Tickets are contained within TicketNodes, which contain other fields required to store Tickets within the ticket log AVL tree.
-   A Ticket can only be created by a non-admin user. When a non-admin user creates a ticket, it is not directly added into the ticket log AVL tree; rather, it is first added to a priority queue called submissions, which is implemented via an array-based heap.
-   From submissions, the ticket must first be approved by an admin user before the ticket is wrapped in a TicketNode and added to the ticket log AVL tree.
+   A Ticket can only be created by a user whose role may submit tickets. When such a user creates a ticket, it is not directly added into the ticket log AVL tree; rather, it is first added to a priority queue called submissions, which is implemented via an array-based heap.
+   From submissions, the ticket must first be approved by a user whose role may approve submissions (an admin or triager) before the ticket is wrapped in a TicketNode and added to the ticket log AVL tree.
 
    avltree.go:
    Implements an adapted AVL tree and associated functions to initialize, traverse, insert nodes, delete nodes and others.
@@ -22,16 +22,81 @@
    - Ticket Description
    - Ticket Assignee
    AVLtrees can be pivoted to apply a different sorting criteria, changing the order in which tickets are displayed.
+   Each TicketNode also records the size of its subtree, making the tree an order-statistic tree: the ticket at a given rank (AVLselect), the rank of a given ticket (AVLrank) and a run of tickets starting from a given rank (AVLrange) are all found in O(log n), which is used to paginate ticket lists.
+
+   comparator.go:
+   Implements per-field ticket Comparators, and Chain, which combines an ordered list of them (each ascending or descending) into a single sortfunc.
+   Chained sortfuncs can be passed to AVLinsert and AVLpivot like any other, allowing tickets to be sorted by several keys at once (e.g. Priority, then Due Date descending, then Assignee).
+
+   ticketlog.go:
+   Implements Ticketlog, the log of approved tickets, which is written copy-on-write so that it can be read without locks.
+   Writes use the persistent versions of the AVL tree functions (AVLinsertCopy, AVLdeleteCopy and AVLreplaceCopy), which copy the nodes along the path they change rather than modifying them, and publish the new root through an atomic pointer.
+   Readers (page handlers, saving to CSV etc.) take a Snapshot of the root, which no later write will modify.
+   The log also keeps the secondary indexes of ticketindex.go, updating them within the same write. The log is authoritative; while a write publishes its root the index is locked, so a reader who has seen a version of the log never finds the index behind it.
+
+   ticketindex.go:
+   Implements secondary indexes over the ticket log: one AVL tree per sortable field, plus per-user trees of the tickets each user created or is assigned, and per-team trees of the tickets assigned to each team.
+   Indexes are kept up to date as tickets are inserted, edited and deleted, so views of a user's tickets or assignments, and re-sorts, no longer rebuild a tree on each request.
 
    heap.go:
    Array-based implementation of a heap, which is used as a priority queue used to track user submissions.
    Note that in this heap, the topmost tickets are the highest-priority ones (lowest priority score).
    Thus, an admin appoving user ticket submissions will first start from the highest-priority ticket, making use of the min-heap property.
+   PriorityQueue takes its ordering as a Comparator; the submissions queue is ordered by Firstinline (priority, then due date, then TicketID).
+   It also maps each TicketID to its position in the heap, so a queued ticket can be looked up, removed or updated without scanning the heap.
+
+   submissions.go:
+   Implements Submissionqueue, the PriorityQueue of submissions awaiting approval, ordered by effective priority rather than the priority each was submitted with.
+   With aging, a submission gains a priority level for each Aging.Step it waits, up to the highest priority, so low-priority submissions are eventually approved or rejected; with fair share, it loses Aging.FairShare levels for each earlier submission by the same creator still queued.
+   Since all submissions age at the same rate, the order of any two never changes with time alone, so the heap does not need to be reordered as time passes.
+
+   tree.go:
+   Implements AVLTree, a generic ordered map from keys to values, ordered by a comparator over the keys.
+   Besides lookup, insertion and deletion by key, it supports selection by rank, the rank of a key, iteration over all keys or a range of keys, and cloning.
+   The AVL algorithms themselves are written once, over any node type implementing avlnode; TicketNode implements it too, so the ticket tree functions in avltree.go are thin wrappers around the same code.
+
+   hashmap.go:
+   Implements HashMap, a generic hash table with separate chaining, i.e. an array of SLLs of entries, with keys assigned to buckets by a hash function.
+   The number of buckets doubles whenever the load factor (entries per bucket) passes MaxLoadFactor, keeping lookups O(1) on average; Stats reports how evenly entries are spread across buckets.
 
    userhash.go:
-   Implements a hash table, used in the application to record and manipulate information of user accounts in-memory.
-   Hash table is implemented as an array of SLLs made up of UserNodes.
-   UserNodes contain a User, and a pointer to another UserNode (thus forming the SLL).
-   User info includes a username(string), bcrypt-hashed password([]byte), and admin status(bool)
+   Implements the hash table used in the application to record and manipulate information of user accounts in-memory.
+   The user hash table (Userlog) is a HashMap from usernames to Users, and the functions in this file are thin wrappers around it.
+   Changes to an existing user go through UpdateUser, which edits the user as stored under the hash table's lock, so that a change made from an earlier copy cannot undo others or bring back a deleted user.
+   Usernames are hashed with a randomly seeded maphash, so that bucket assignment is well-distributed and cannot be predicted from outside.
+   User info includes a username(string), bcrypt-hashed password([]byte), role(Role), and email address(string), and optionally a second factor: a sealed TOTP secret(string) with hashed recovery codes([]string).
+
+   role.go:
+   Implements role-based access control. Each user has a Role (Admin, Triager, Developer, Reporter or Viewer), which grants a fixed set of Permissions, such as approving submissions or managing users.
+   Handlers check permissions rather than roles, so what each role may do is decided in one place.
+
+   comment.go:
+   Implements a comment log, recording remarks left on tickets and submissions (e.g. by replying to a ticket's email).
+   Comments are grouped by the TicketID they belong to, in an AVLTree (see tree.go) keyed by TicketID, and kept in the order posted.
+
+   inbox.go:
+   Implements an inbox of in-app notifications, recording events which concern each user (assignments, comments, status changes and approvals).
+   Notifications are grouped by recipient username, and can be marked read individually or all at once.
+
+   filter.go:
+   Implements a filterbook, recording named ticket queries saved by users.
+   Filters are private to their owner unless shared, and any visible filter can be chosen as a user's home view on the main menu.
+
+   team.go:
+   Implements a team roster, recording named teams of users, each with a lead.
+   A ticket may be assigned to a team rather than (or as well as) a user; while it has no assignee, it waits in the team's queue until a member claims it or the lead hands it to a member.
+
+   productaccess.go:
+   Implements Productaccess, the access lists of confidential products.
+   Products are open to every user until restricted; a restricted product's tickets and submissions can only be seen, submitted to or have their access list changed by its members, up to the Access each was granted.
+
+   resettoken.go:
+   Implements Resettokens, the outstanding password reset tokens emailed to users who forgot their password.
+   Tokens are stored only as SHA-256 hashes, expire after a set time, and are discarded once redeemed; each user has at most one outstanding.
+
+   session.go:
+   Implements Sessions, the logins of users. A user may be logged in from several devices at once, each with its own session.
+   Sessions expire after a fixed lifetime, or sooner if left idle, and can be revoked individually or all at once; like reset tokens, they are stored only as hashes of the token in the user's cookie.
+   Sessions is held in memory only; SessionStore is the interface it shares with stores which also persist sessions (see hashcsv.SessionStore).
 */
 package dsa
@@ -0,0 +1,124 @@
+package dsa
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Filter struct records a named ticket query saved by a user, e.g. `status:"In Progress" assignee:me`.
+type Filter struct {
+	ID     int64 // Assigned from 1, so that 0 can mean "no filter"
+	Owner  string
+	Name   string
+	Query  string
+	Shared bool // If true, every user can see and run the filter; otherwise only its owner
+}
+
+// Filterbook holds every saved filter. Safe for concurrent use.
+type Filterbook struct {
+	mu      sync.Mutex
+	filters map[int64]Filter
+	nextID  int64
+}
+
+// NewFilterbook initializes an empty filterbook.
+func NewFilterbook() *Filterbook {
+	return &Filterbook{filters: make(map[int64]Filter), nextID: 1}
+}
+
+// AddFilter assigns a new filter its ID and stores it. Returns the stored filter.
+func (fb *Filterbook) AddFilter(filter Filter) Filter {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	filter.ID = fb.nextID
+	fb.nextID++
+	fb.filters[filter.ID] = filter
+	return filter
+}
+
+// Restore adds a previously stored filter, keeping its ID. Used when loading from persistent storage.
+func (fb *Filterbook) Restore(filter Filter) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if filter.ID >= fb.nextID {
+		fb.nextID = filter.ID + 1
+	}
+	fb.filters[filter.ID] = filter
+}
+
+// GetFilter returns the filter with a given ID, if any.
+func (fb *Filterbook) GetFilter(id int64) (Filter, bool) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	filter, ok := fb.filters[id]
+	return filter, ok
+}
+
+// DeleteFilter removes the filter with a given ID. Returns false if no such filter exists.
+func (fb *Filterbook) DeleteFilter(id int64) bool {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if _, ok := fb.filters[id]; !ok {
+		return false
+	}
+	delete(fb.filters, id)
+	return true
+}
+
+// Visible returns the filters a user can run (their own, and those shared by others), with the user's own first, then ordered by name.
+func (fb *Filterbook) Visible(user string) []Filter {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	result := make([]Filter, 0)
+	for _, filter := range fb.filters {
+		if filter.Owner == user || filter.Shared {
+			result = append(result, filter)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if mine := result[i].Owner == user; mine != (result[j].Owner == user) {
+			return mine
+		}
+		if a, b := strings.ToLower(result[i].Name), strings.ToLower(result[j].Name); a != b {
+			return a < b
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// RenameOwner moves a user's filters over to their new username.
+func (fb *Filterbook) RenameOwner(oldname, newname string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	for id, filter := range fb.filters {
+		if filter.Owner == oldname {
+			filter.Owner = newname
+			fb.filters[id] = filter
+		}
+	}
+}
+
+// DeleteOwner removes every filter saved by a user.
+func (fb *Filterbook) DeleteOwner(user string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	for id, filter := range fb.filters {
+		if filter.Owner == user {
+			delete(fb.filters, id)
+		}
+	}
+}
+
+// AllFilters returns every saved filter, ordered by ID.
+func (fb *Filterbook) AllFilters() []Filter {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	result := make([]Filter, 0, len(fb.filters))
+	for _, filter := range fb.filters {
+		result = append(result, filter)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
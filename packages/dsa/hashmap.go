@@ -0,0 +1,219 @@
+package dsa
+
+import (
+	"iter"
+	"sync"
+)
+
+const (
+	MaxLoadFactor = 0.75 // Average entries per bucket beyond which a HashMap doubles its number of buckets
+)
+
+// HashMap is a generic hash table, implemented as an array of SLLs (buckets) of entries, with keys assigned to buckets by a hash function.
+// The number of buckets doubles whenever the load factor passes MaxLoadFactor, so that chains stay short and lookups O(1) on average however many keys are added. Safe for concurrent use.
+type HashMap[K comparable, V any] struct {
+	mu      sync.RWMutex
+	buckets []*hashEntry[K, V]
+	hash    func(key K) uint64
+	size    int
+	resizes int
+}
+
+// HashStats describes how evenly the keys of a HashMap are spread across its buckets.
+type HashStats struct {
+	Entries    int
+	Buckets    int
+	Empty      int     // Buckets holding no entries
+	Longest    int     // Entries in the longest chain
+	LoadFactor float64 // Entries per bucket
+	Resizes    int     // Times the number of buckets has doubled
+	Chains     []int   // Chains[n] is the number of buckets holding n entries
+}
+
+// NewHashMap creates an empty HashMap with a given initial number of buckets, assigning keys to buckets by hash, and returns its pointer.
+func NewHashMap[K comparable, V any](buckets int, hash func(key K) uint64) *HashMap[K, V] {
+	if buckets < 1 {
+		buckets = 1
+	}
+	return &HashMap[K, V]{
+		buckets: make([]*hashEntry[K, V], buckets),
+		hash:    hash,
+	}
+}
+
+// Len returns the number of keys in the hash table. Runs in O(1).
+func (m *HashMap[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size
+}
+
+// Get returns the value stored under a key, if any.
+func (m *HashMap[K, V]) Get(key K) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for ptr := m.buckets[m.index(key)]; ptr != nil; ptr = ptr.next {
+		if ptr.key == key {
+			return ptr.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Put stores a value under a key, replacing the value already stored under it, if any. New keys are added to the front of their bucket.
+func (m *HashMap[K, V]) Put(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	index := m.index(key)
+	for ptr := m.buckets[index]; ptr != nil; ptr = ptr.next {
+		if ptr.key == key {
+			ptr.value = value
+			return
+		}
+	}
+	m.buckets[index] = &hashEntry[K, V]{key, value, m.buckets[index]}
+	m.size++
+	if float64(m.size) > MaxLoadFactor*float64(len(m.buckets)) {
+		m.grow()
+	}
+}
+
+// Update edits the value stored under a key in place: edit is passed a copy of the value, and the copy is stored if edit returns true.
+// The hash table is locked throughout, so no other change to the value can be lost in between; edit must therefore not use the hash table itself.
+// Returns the value as stored afterwards, and false if the key is not in the hash table (in which case edit is not called) or edit returned false.
+func (m *HashMap[K, V]) Update(key K, edit func(value *V) bool) (V, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ptr := m.buckets[m.index(key)]; ptr != nil; ptr = ptr.next {
+		if ptr.key == key {
+			value := ptr.value
+			if !edit(&value) {
+				return ptr.value, false
+			}
+			ptr.value = value
+			return value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// Delete removes a key and its value from the hash table. Returns false if the key is not in the hash table.
+func (m *HashMap[K, V]) Delete(key K) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	index := m.index(key)
+	var prev *hashEntry[K, V]
+	for ptr := m.buckets[index]; ptr != nil; ptr = ptr.next {
+		if ptr.key == key {
+			if prev == nil { // If first node of SLL
+				m.buckets[index] = ptr.next
+			} else {
+				prev.next = ptr.next
+			}
+			m.size--
+			return true
+		}
+		prev = ptr
+	}
+	return false
+}
+
+// All iterates over every key in the hash table and its value, bucket by bucket. The order is not meaningful.
+// Entries are copied out when iteration starts, so the loop body may modify the hash table.
+func (m *HashMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.mu.RLock()
+		entries := make([]hashEntry[K, V], 0, m.size)
+		for _, bucket := range m.buckets {
+			for ptr := bucket; ptr != nil; ptr = ptr.next {
+				entries = append(entries, hashEntry[K, V]{key: ptr.key, value: ptr.value})
+			}
+		}
+		m.mu.RUnlock()
+		for _, entry := range entries {
+			if !yield(entry.key, entry.value) {
+				return
+			}
+		}
+	}
+}
+
+// Clone returns a copy of the hash table. Keys and values are copied by assignment.
+func (m *HashMap[K, V]) Clone() *HashMap[K, V] {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	clone := &HashMap[K, V]{
+		buckets: make([]*hashEntry[K, V], len(m.buckets)),
+		hash:    m.hash,
+		size:    m.size,
+		resizes: m.resizes,
+	}
+	for i, bucket := range m.buckets {
+		tail := &clone.buckets[i]
+		for ptr := bucket; ptr != nil; ptr = ptr.next {
+			*tail = &hashEntry[K, V]{ptr.key, ptr.value, nil}
+			tail = &(*tail).next
+		}
+	}
+	return clone
+}
+
+// Stats reports the occupancy of the hash table's buckets. Runs in O(n).
+func (m *HashMap[K, V]) Stats() HashStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := HashStats{
+		Entries:    m.size,
+		Buckets:    len(m.buckets),
+		LoadFactor: float64(m.size) / float64(len(m.buckets)),
+		Resizes:    m.resizes,
+		Chains:     []int{0},
+	}
+	for _, bucket := range m.buckets {
+		length := 0
+		for ptr := bucket; ptr != nil; ptr = ptr.next {
+			length++
+		}
+		for len(stats.Chains) <= length {
+			stats.Chains = append(stats.Chains, 0)
+		}
+		stats.Chains[length]++
+		if length > stats.Longest {
+			stats.Longest = length
+		}
+	}
+	stats.Empty = stats.Chains[0]
+	return stats
+}
+
+// Utility functions
+
+// hashEntry is a SLL node in a HashMap bucket.
+type hashEntry[K comparable, V any] struct {
+	key   K
+	value V
+	next  *hashEntry[K, V]
+}
+
+// Doubles the number of buckets, moving every entry to its bucket in the new array. Assumes the lock is held.
+func (m *HashMap[K, V]) grow() {
+	old := m.buckets
+	m.buckets = make([]*hashEntry[K, V], 2*len(old))
+	for _, bucket := range old {
+		for ptr := bucket; ptr != nil; {
+			next := ptr.next
+			index := m.index(ptr.key)
+			ptr.next = m.buckets[index]
+			m.buckets[index] = ptr
+			ptr = next
+		}
+	}
+	m.resizes++
+}
+
+// Returns the index of the bucket holding a key.
+func (m *HashMap[K, V]) index(key K) int {
+	return int(m.hash(key) % uint64(len(m.buckets)))
+}
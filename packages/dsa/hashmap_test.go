@@ -0,0 +1,205 @@
+package dsa
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+const manyUsers = 100000
+
+// Fills a user hash table with n users named user0, user1, ...
+func filledHT(n int) *Userlog {
+	users := NewHT()
+	for i := 0; i < n; i++ {
+		AddUser(users, User{Name: fmt.Sprint("user", i)})
+	}
+	return users
+}
+
+func TestHashMapManyUsers(t *testing.T) {
+	users := filledHT(manyUsers)
+	if users.Len() != manyUsers {
+		t.Fatalf("Len = %d, want %d", users.Len(), manyUsers)
+	}
+	for i := 0; i < manyUsers; i++ {
+		name := fmt.Sprint("user", i)
+		if user, ok := users.Get(name); !ok || user.Name != name {
+			t.Fatalf("Get(%q) = %+v, %v", name, user, ok)
+		}
+	}
+	if _, ok := users.Get("nobody"); ok {
+		t.Error("Get found a user which was never added")
+	}
+
+	stats := users.Stats()
+	t.Logf("%d users in %d buckets: load factor %.2f, %d empty, longest chain %d, %d resizes",
+		stats.Entries, stats.Buckets, stats.LoadFactor, stats.Empty, stats.Longest, stats.Resizes)
+	if stats.LoadFactor > MaxLoadFactor {
+		t.Errorf("load factor %.2f exceeds MaxLoadFactor %.2f", stats.LoadFactor, MaxLoadFactor)
+	}
+	if stats.Buckets < manyUsers {
+		t.Errorf("%d buckets for %d users; the table did not grow", stats.Buckets, manyUsers)
+	}
+	// Grown by doubling from Hashbuckets
+	if want := int(math.Ceil(math.Log2(float64(manyUsers) / MaxLoadFactor / Hashbuckets))); stats.Resizes != want {
+		t.Errorf("%d resizes, want %d", stats.Resizes, want)
+	}
+
+	// With keys spread at random, chain lengths follow a Poisson distribution with mean equal to the load factor
+	wantEmpty := math.Exp(-stats.LoadFactor)
+	if empty := float64(stats.Empty) / float64(stats.Buckets); math.Abs(empty-wantEmpty) > 0.02 {
+		t.Errorf("%.3f of buckets empty, want about %.3f for an even spread", empty, wantEmpty)
+	}
+	if stats.Longest > 10 {
+		t.Errorf("longest chain holds %d users, want no more than 10", stats.Longest)
+	}
+
+	// A lookup of a present key visits on average (1 + entries in its chain) / 2 entries; anything near 1 is O(1)
+	visited := 0
+	for length, count := range stats.Chains {
+		visited += count * length * (length + 1) / 2
+	}
+	if cost := float64(visited) / float64(stats.Entries); cost > 1.5 {
+		t.Errorf("a lookup visits %.2f entries on average, want no more than 1.5", cost)
+	} else {
+		t.Logf("a lookup visits %.2f entries on average", cost)
+	}
+}
+
+func TestHashMapPutDelete(t *testing.T) {
+	users := filledHT(1000)
+	AddUser(users, User{Name: "user5", Email: "five@example.com"})
+	if users.Len() != 1000 {
+		t.Errorf("Len = %d after replacing a user, want 1000", users.Len())
+	}
+	if user, _ := users.Get("user5"); user.Email != "five@example.com" {
+		t.Errorf("Get returned %+v, want the replacement", user)
+	}
+
+	clone := users.Clone()
+	for i := 0; i < 1000; i += 2 {
+		if !users.Delete(fmt.Sprint("user", i)) {
+			t.Fatalf("Delete(user%d) = false", i)
+		}
+	}
+	if users.Delete("user0") {
+		t.Error("Delete of a removed user returned true")
+	}
+	if users.Len() != 500 {
+		t.Errorf("Len = %d after deleting half, want 500", users.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		_, ok := users.Get(fmt.Sprint("user", i))
+		if ok != (i%2 == 1) {
+			t.Fatalf("Get(user%d) found = %v after deleting even users", i, ok)
+		}
+	}
+	if clone.Len() != 1000 {
+		t.Errorf("clone Len = %d, want it unaffected by deletes from the original", clone.Len())
+	}
+	count := 0
+	for range users.All() {
+		count++
+	}
+	if count != 500 {
+		t.Errorf("All yielded %d users, want 500", count)
+	}
+}
+
+func TestHashMapConcurrent(t *testing.T) {
+	users := filledHT(1000)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				name := fmt.Sprint("worker", w, "-", i)
+				AddUser(users, User{Name: name})
+				users.Get(fmt.Sprint("user", i%1000))
+				if i%3 == 0 {
+					users.Delete(name)
+				}
+				if i%500 == 0 {
+					for range users.All() {
+					}
+					users.Stats()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if want := 1000 + 8*(2000-667); users.Len() != want {
+		t.Errorf("Len = %d, want %d", users.Len(), want)
+	}
+}
+
+func TestHashMapUpdate(t *testing.T) {
+	users := filledHT(100)
+	called := false
+	if _, ok := users.Update("nobody", func(user *User) bool { called = true; return true }); ok || called {
+		t.Errorf("Update of a missing key returned %v and called edit: %v", ok, called)
+	}
+	if _, ok := users.Get("nobody"); ok || users.Len() != 100 {
+		t.Error("Update of a missing key added it")
+	}
+
+	if _, ok := users.Update("user1", func(user *User) bool { user.Email = "refused@example.com"; return false }); ok {
+		t.Error("Update returned true when edit refused the change")
+	}
+	if user, _ := users.Get("user1"); user.Email != "" {
+		t.Errorf("refused edit was stored: %+v", user)
+	}
+
+	// Concurrent read-modify-writes of one user all take effect
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				users.Update("user2", func(user *User) bool { user.Notify++; return true })
+			}
+		}()
+	}
+	wg.Wait()
+	if user, _ := users.Get("user2"); user.Notify != 8000 {
+		t.Errorf("Notify = %d after 8000 concurrent increments", user.Notify)
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	users := filledHT(10)
+	// An edit made from a stale copy does not undo changes made since, nor bring back a deleted user
+	stale, _ := users.Get("user3")
+	UpdateUser(users, "user3", func(user *User) bool { user.Role = RoleAdmin; return true })
+	UpdateUser(users, "user3", func(user *User) bool { user.Pw = []byte("new hash"); return true })
+	if user, _ := users.Get("user3"); user.Role != RoleAdmin || string(user.Pw) != "new hash" || user.Name != stale.Name {
+		t.Errorf("user3 = %+v, want both edits kept", user)
+	}
+	if updated, _ := UpdateUser(users, "user3", func(user *User) bool { user.Name = "renamed"; return true }); updated.Name != "user3" {
+		t.Errorf("UpdateUser renamed the user to %q", updated.Name)
+	}
+
+	DeleteUser(users, "user4")
+	if _, ok := UpdateUser(users, "user4", func(user *User) bool { return true }); ok {
+		t.Error("UpdateUser of a deleted user returned true")
+	}
+	if found, _ := SearchUser(users, "user4"); found {
+		t.Error("UpdateUser brought back a deleted user")
+	}
+}
+
+func BenchmarkHashMapGet(b *testing.B) {
+	users := filledHT(manyUsers)
+	names := make([]string, 1024)
+	for i := range names {
+		names[i] = fmt.Sprint("user", i*97%manyUsers)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		users.Get(names[i%len(names)])
+	}
+}
@@ -1,75 +1,189 @@
 package dsa
 
-import "fmt"
+import (
+	"sync"
+)
+
+// PriorityQueue is an array-based binary min-heap of tickets, used as the submissions queue.
+// Tickets are ordered by a pluggable Comparator: the ticket which the comparator sorts first sits at the root, and is the next to be popped.
+// A map from TicketID to heap position is kept alongside the heap, so that any ticket can be found, removed or updated in O(log n) rather than by scanning the heap. Access is serialized via the inclusion of a Mutex.
+type PriorityQueue struct {
+	mu       sync.Mutex
+	heap     []Ticket
+	position map[int64]int
+	compare  Comparator
+}
+
+// NewPriorityQueue creates an empty PriorityQueue ordered by a given comparator, and returns its pointer.
+func NewPriorityQueue(compare Comparator) *PriorityQueue {
+	return &PriorityQueue{
+		position: make(map[int64]int),
+		compare:  compare,
+	}
+}
+
+// Firstinline orders tickets by priority value, lowest (most important) first. Tickets of equal priority are ordered by due date, soonest first, and then by TicketID.
+func Firstinline(a, b Ticket) int {
+	if c := ComparePriority(a, b); c != 0 {
+		return c
+	}
+	if c := CompareDueDate(a, b); c != 0 {
+		return c
+	}
+	return CompareTicketID(a, b)
+}
 
 // Heap Operations
 
-// Addsubmission inserts a new node to the priority queue.
-func Addsubmission(submissions *[]Ticket, newticket Ticket) {
-	// Insert new ticket at end of submissions
-	*submissions = append(*submissions, newticket)
+// Len returns the number of tickets in the queue.
+func (pq *PriorityQueue) Len() int {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	return len(pq.heap)
+}
 
-	// Ensure heap property is maintained
-	for index := len(*submissions) - 1; index != 0 && (*submissions)[parent(index)].Priority > (*submissions)[index].Priority; index = parent(index) {
-		swap(&((*submissions)[index]), &((*submissions)[parent(index)]))
+// Push inserts a ticket into the queue. If a ticket with the same TicketID is already queued, it is replaced.
+func (pq *PriorityQueue) Push(ticket Ticket) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if index, ok := pq.position[ticket.TicketID]; ok {
+		pq.heap[index] = ticket
+		pq.fix(index)
+		return
 	}
+	pq.heap = append(pq.heap, ticket)
+	pq.position[ticket.TicketID] = len(pq.heap) - 1
+	pq.siftup(len(pq.heap) - 1)
 }
 
-// Searchsubmissions for a given node in priority queue. Returns true if the ticket exists, alongside the target ticket ID.
-func Searchsubmissions(submissions *[]Ticket, ticketID int64) (bool, int64) {
-	for index := int64(0); index < int64(len(*submissions)); index++ {
-		if (*submissions)[index].TicketID == ticketID {
-			return true, index
-		}
+// Peek returns the ticket at the front of the queue without removing it. Returns false if the queue is empty.
+func (pq *PriorityQueue) Peek() (Ticket, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if len(pq.heap) == 0 {
+		return Ticket{}, false
 	}
-	return false, -1
+	return pq.heap[0], true
 }
 
-// Popsubmission removes the root node of the priority queue, returning the removed node.
-func Popsubmission(submissions *[]Ticket) Ticket {
-	popped := (*submissions)[0]
-	(*submissions)[0] = (*submissions)[len(*submissions)-1]
-	(*submissions) = (*submissions)[:len(*submissions)-1]
+// Pop removes the ticket at the front of the queue, returning the removed ticket. Returns false if the queue is empty.
+func (pq *PriorityQueue) Pop() (Ticket, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if len(pq.heap) == 0 {
+		return Ticket{}, false
+	}
+	return pq.removeAt(0), true
+}
 
-	Makeheap(submissions, 0)
+// Get returns the queued ticket with a given TicketID.
+func (pq *PriorityQueue) Get(ticketID int64) (Ticket, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	if index, ok := pq.position[ticketID]; ok {
+		return pq.heap[index], true
+	}
+	return Ticket{}, false
+}
 
-	return popped
+// Remove removes the ticket with a given TicketID from the queue, returning the removed ticket. Returns false if no such ticket is queued.
+func (pq *PriorityQueue) Remove(ticketID int64) (Ticket, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	index, ok := pq.position[ticketID]
+	if !ok {
+		return Ticket{}, false
+	}
+	return pq.removeAt(index), true
 }
 
-// LOtraversal implements in-order traversal of the heap.
-func LOtraversal(submissions *[]Ticket, priorities, products, statuses, categories *[]string) [][]string {
-	var s [][]string
-	if len(*submissions) == 0 {
-		fmt.Println("No submissions outstanding.")
-	} else {
-		for index := 0; index < len(*submissions); index++ {
-			s = append(s, printTicket((*submissions)[index], priorities, products, statuses, categories))
-		}
+// Update changes the queued ticket with a given TicketID by edit, which must not change the TicketID, and moves it to its new place in the queue.
+// Returns the edited ticket, or false if no such ticket is queued.
+func (pq *PriorityQueue) Update(ticketID int64, edit func(ticket *Ticket)) (Ticket, bool) {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	index, ok := pq.position[ticketID]
+	if !ok {
+		return Ticket{}, false
 	}
-	return s
+	edit(&pq.heap[index])
+	pq.heap[index].TicketID = ticketID
+	ticket := pq.heap[index]
+	pq.fix(index)
+	return ticket, true
+}
+
+// Tickets returns a copy of the queued tickets in heap (level) order. The first ticket, if any, is the front of the queue.
+func (pq *PriorityQueue) Tickets() []Ticket {
+	pq.mu.Lock()
+	defer pq.mu.Unlock()
+	return append([]Ticket(nil), pq.heap...)
 }
 
-// Utility function for swapping elements of priority queue in-place.
-func swap(x *Ticket, y *Ticket) {
-	tmp := *x
-	*x = *y
-	*y = tmp
+// Utility functions. These assume the caller holds the Mutex.
+
+// Removes and returns the ticket at a given heap position, filling the gap with the last ticket in the heap.
+func (pq *PriorityQueue) removeAt(index int) Ticket {
+	removed := pq.heap[index]
+	last := len(pq.heap) - 1
+	pq.swap(index, last)
+	pq.heap = pq.heap[:last]
+	delete(pq.position, removed.TicketID)
+	if index < last {
+		pq.fix(index)
+	}
+	return removed
 }
 
-// Utility function which returns the node with the lower priority value (more important). If both have equal priority values, the function returns the node with the sooner due date.
-func firstinline(x *Ticket, y *Ticket) *Ticket {
-	if (*x).Priority < (*y).Priority {
-		return x
-	} else if (*x).Priority > (*y).Priority {
-		return y
-	} else {
-		if ((*x).DueDate).Before((*y).DueDate) {
-			return x
+// Restores the heap property after the ticket at a given heap position has changed, by moving it up or down as needed.
+func (pq *PriorityQueue) fix(index int) {
+	if !pq.siftup(index) {
+		pq.siftdown(index)
+	}
+}
+
+// Moves the ticket at a given heap position up past any parents it should come before. Returns true if it moved.
+func (pq *PriorityQueue) siftup(index int) bool {
+	moved := false
+	for index > 0 && pq.before(index, parent(index)) {
+		pq.swap(index, parent(index))
+		index = parent(index)
+		moved = true
+	}
+	return moved
+}
+
+// Moves the ticket at a given heap position down past any children which should come before it.
+// Either child may be the first in line; a node may also have a left child only.
+func (pq *PriorityQueue) siftdown(index int) {
+	for {
+		first := index
+		if l := left(index); l < len(pq.heap) && pq.before(l, first) {
+			first = l
+		}
+		if r := right(index); r < len(pq.heap) && pq.before(r, first) {
+			first = r
 		}
-		return y
+		if first == index {
+			return
+		}
+		pq.swap(index, first)
+		index = first
 	}
 }
 
+// Returns true if the ticket at heap position x comes strictly before the ticket at heap position y.
+func (pq *PriorityQueue) before(x, y int) bool {
+	return pq.compare(pq.heap[x], pq.heap[y]) < 0
+}
+
+// Swaps the tickets at two heap positions, keeping the position map up to date.
+func (pq *PriorityQueue) swap(x, y int) {
+	pq.heap[x], pq.heap[y] = pq.heap[y], pq.heap[x]
+	pq.position[pq.heap[x].TicketID] = x
+	pq.position[pq.heap[y].TicketID] = y
+}
+
 // Utility function returning indices of parent and children nodes in heap.
 func parent(child int) int {
 	return (child - 1) / 2
@@ -82,23 +196,3 @@ func left(parent int) int {
 func right(parent int) int {
 	return (2*parent + 2)
 }
-
-// Makeheap preserves the heap property of the priority queue.
-func Makeheap(submissions *[]Ticket, root int) {
-	if right(root) < len(*submissions) {
-		toheapify := firstinline(&(*submissions)[right(root)], &(*submissions)[left(root)])
-		swapped := false
-		if firstinline(&(*submissions)[root], &(*submissions)[left(root)]) == &(*submissions)[left(root)] || firstinline(&(*submissions)[root], &(*submissions)[right(root)]) == &(*submissions)[right(root)] {
-			swap(&(*submissions)[root], toheapify)
-			swapped = true
-		}
-
-		if swapped {
-			if toheapify == &(*submissions)[left(root)] {
-				Makeheap(submissions, left(root))
-			} else {
-				Makeheap(submissions, right(root))
-			}
-		}
-	}
-}
@@ -0,0 +1,126 @@
+package dsa
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Checks the heap property and the position map of a queue against a model of its contents. Assumes no other goroutine is using the queue.
+func checkHeap(t *testing.T, pq *PriorityQueue, model map[int64]Ticket, step int) {
+	t.Helper()
+	if len(pq.heap) != len(model) || len(pq.position) != len(model) {
+		t.Fatalf("step %d: heap holds %d tickets and %d positions, want %d", step, len(pq.heap), len(pq.position), len(model))
+	}
+	for i, ticket := range pq.heap {
+		if i > 0 && pq.before(i, parent(i)) {
+			t.Fatalf("step %d: ticket %d at %d comes before its parent, ticket %d at %d", step, ticket.TicketID, i, pq.heap[parent(i)].TicketID, parent(i))
+		}
+		if pq.position[ticket.TicketID] != i {
+			t.Fatalf("step %d: position map puts ticket %d at %d, found at %d", step, ticket.TicketID, pq.position[ticket.TicketID], i)
+		}
+		if ticket != model[ticket.TicketID] {
+			t.Fatalf("step %d: heap holds %+v, want %+v", step, ticket, model[ticket.TicketID])
+		}
+	}
+}
+
+// Returns the ticket in the model which the comparator sorts first.
+func firstOf(model map[int64]Ticket, compare Comparator) (Ticket, bool) {
+	var first Ticket
+	found := false
+	for _, ticket := range model {
+		if !found || compare(ticket, first) < 0 {
+			first, found = ticket, true
+		}
+	}
+	return first, found
+}
+
+// Returns a random ticket with an ID from a small range, so that pushes often replace queued tickets.
+func randomQueued(rng *rand.Rand) Ticket {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return Ticket{
+		TicketID: int64(rng.Intn(60)),
+		Priority: rng.Intn(3),
+		DueDate:  start.AddDate(0, 0, rng.Intn(10)),
+		Creator:  []string{"alice", "bob", "carol"}[rng.Intn(3)],
+	}
+}
+
+func TestPriorityQueueRandomOperations(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		pq := NewPriorityQueue(Firstinline)
+		model := make(map[int64]Ticket)
+		for step := 0; step < 2000; step++ {
+			switch op := rng.Intn(10); {
+			case op < 4: // Push, possibly replacing
+				ticket := randomQueued(rng)
+				pq.Push(ticket)
+				model[ticket.TicketID] = ticket
+			case op < 6: // Pop
+				want, ok := firstOf(model, Firstinline)
+				got, popped := pq.Pop()
+				if popped != ok || got != want {
+					t.Fatalf("seed %d step %d: Pop = %+v, %v; want %+v, %v", seed, step, got, popped, want, ok)
+				}
+				delete(model, want.TicketID)
+			case op < 8: // Remove, possibly of a ticket not queued
+				ticketID := int64(rng.Intn(60))
+				want, ok := model[ticketID]
+				got, removed := pq.Remove(ticketID)
+				if removed != ok || got != want {
+					t.Fatalf("seed %d step %d: Remove(%d) = %+v, %v; want %+v, %v", seed, step, ticketID, got, removed, want, ok)
+				}
+				delete(model, ticketID)
+			default: // Update, possibly of a ticket not queued
+				ticketID := int64(rng.Intn(60))
+				priority, due := rng.Intn(3), rng.Intn(10)-5
+				got, updated := pq.Update(ticketID, func(ticket *Ticket) {
+					ticket.Priority = priority
+					ticket.DueDate = ticket.DueDate.AddDate(0, 0, due)
+					ticket.TicketID = -1 // Must be ignored
+				})
+				want, ok := model[ticketID]
+				if ok {
+					want.Priority = priority
+					want.DueDate = want.DueDate.AddDate(0, 0, due)
+					model[ticketID] = want
+				}
+				if updated != ok || got != want {
+					t.Fatalf("seed %d step %d: Update(%d) = %+v, %v; want %+v, %v", seed, step, ticketID, got, updated, want, ok)
+				}
+			}
+			checkHeap(t, pq, model, step)
+			if front, ok := pq.Peek(); ok {
+				if want, _ := firstOf(model, Firstinline); front != want {
+					t.Fatalf("seed %d step %d: Peek = %+v, want %+v", seed, step, front, want)
+				}
+			}
+		}
+
+		// Draining the queue yields every ticket in comparator order
+		var previous Ticket
+		for i := 0; pq.Len() > 0; i++ {
+			ticket, _ := pq.Pop()
+			if i > 0 && Firstinline(previous, ticket) > 0 {
+				t.Fatalf("seed %d: popped %+v after %+v", seed, ticket, previous)
+			}
+			previous = ticket
+		}
+	}
+}
+
+func TestPriorityQueueEmpty(t *testing.T) {
+	pq := NewPriorityQueue(Firstinline)
+	if _, ok := pq.Peek(); ok {
+		t.Error("Peek of an empty queue returned a ticket")
+	}
+	if _, ok := pq.Pop(); ok {
+		t.Error("Pop of an empty queue returned a ticket")
+	}
+	if _, ok := pq.Remove(1); ok {
+		t.Error("Remove from an empty queue returned a ticket")
+	}
+}
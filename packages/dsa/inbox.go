@@ -0,0 +1,148 @@
+package dsa
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	inboxLimit = 200 // Notifications kept per user; the oldest are discarded beyond this
+)
+
+// Notification struct logs an in-app notice to a user about an event concerning them.
+type Notification struct {
+	ID       int64
+	User     string // Recipient username
+	TicketID int64
+	Kind     string // Event which caused the notification, e.g. "submission.approved"
+	Message  string
+	Created  time.Time
+	Read     bool
+}
+
+// Inbox groups notifications by recipient. Safe for concurrent use.
+type Inbox struct {
+	mu     sync.Mutex
+	byUser map[string][]Notification // Oldest first
+	nextID int64
+}
+
+// NewInbox initializes an empty inbox.
+func NewInbox() *Inbox {
+	return &Inbox{byUser: make(map[string][]Notification)}
+}
+
+// Notify assigns a new notification its ID and adds it to its recipient's inbox. Returns the stored notification.
+func (ib *Inbox) Notify(notification Notification) Notification {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	notification.ID = ib.nextID
+	ib.nextID++
+	ib.add(notification)
+	return notification
+}
+
+// Restore adds a previously stored notification, keeping its ID. Used when loading from persistent storage.
+func (ib *Inbox) Restore(notification Notification) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if notification.ID >= ib.nextID {
+		ib.nextID = notification.ID + 1
+	}
+	ib.add(notification)
+}
+
+// Notifications returns a copy of a user's notifications, newest first.
+func (ib *Inbox) Notifications(user string) []Notification {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	stored := ib.byUser[user]
+	result := make([]Notification, len(stored))
+	for i := range stored {
+		result[i] = stored[len(stored)-1-i]
+	}
+	return result
+}
+
+// Unread returns the number of unread notifications for a user.
+func (ib *Inbox) Unread(user string) int {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	count := 0
+	for _, notification := range ib.byUser[user] {
+		if !notification.Read {
+			count++
+		}
+	}
+	return count
+}
+
+// MarkRead marks one of a user's notifications as read. Returns false if the user has no notification with that ID.
+func (ib *Inbox) MarkRead(user string, id int64) bool {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	for i := range ib.byUser[user] {
+		if ib.byUser[user][i].ID == id {
+			ib.byUser[user][i].Read = true
+			return true
+		}
+	}
+	return false
+}
+
+// MarkAllRead marks every one of a user's notifications as read, returning how many were previously unread.
+func (ib *Inbox) MarkAllRead(user string) int {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	count := 0
+	for i := range ib.byUser[user] {
+		if !ib.byUser[user][i].Read {
+			ib.byUser[user][i].Read = true
+			count++
+		}
+	}
+	return count
+}
+
+// RenameUser moves a user's notifications over to their new username.
+func (ib *Inbox) RenameUser(oldname, newname string) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	if oldname == newname {
+		return
+	}
+	for _, notification := range ib.byUser[oldname] {
+		notification.User = newname
+		ib.add(notification)
+	}
+	delete(ib.byUser, oldname)
+}
+
+// DeleteUser removes every notification addressed to a user.
+func (ib *Inbox) DeleteUser(user string) {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	delete(ib.byUser, user)
+}
+
+// AllNotifications returns every notification in the inbox, ordered by ID.
+func (ib *Inbox) AllNotifications() []Notification {
+	ib.mu.Lock()
+	defer ib.mu.Unlock()
+	result := make([]Notification, 0)
+	for _, stored := range ib.byUser {
+		result = append(result, stored...)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Appends a notification to its recipient's inbox, discarding the oldest beyond inboxLimit. Assumes the lock is held.
+func (ib *Inbox) add(notification Notification) {
+	stored := append(ib.byUser[notification.User], notification)
+	if len(stored) > inboxLimit {
+		stored = stored[len(stored)-inboxLimit:]
+	}
+	ib.byUser[notification.User] = stored
+}
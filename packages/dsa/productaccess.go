@@ -0,0 +1,178 @@
+package dsa
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Access is a level of access to a restricted product. Each level includes the ones below it.
+type Access int
+
+const (
+	NoAccess     Access = iota
+	AccessView          // View the product's tickets and submissions, comment on them and be assigned them
+	AccessSubmit        // Also submit tickets to the product
+	AccessManage        // Also decide who may access the product
+)
+
+// Accesses lists every level of access which can be granted, from least to most.
+var Accesses = []Access{AccessView, AccessSubmit, AccessManage}
+
+var accessNames = map[Access]string{
+	NoAccess:     "None",
+	AccessView:   "View",
+	AccessSubmit: "Submit",
+	AccessManage: "Manage",
+}
+
+// String returns the name of an access level, as shown on screen and saved to file.
+func (access Access) String() string {
+	return accessNames[access]
+}
+
+// ParseAccess returns the access level with a given name (case-insensitive).
+func ParseAccess(name string) (Access, bool) {
+	for access, accessName := range accessNames {
+		if strings.EqualFold(accessName, name) {
+			return access, true
+		}
+	}
+	return NoAccess, false
+}
+
+// Member struct records a user's access to a restricted product.
+type Member struct {
+	User   string
+	Access Access
+}
+
+// Productaccess holds the access lists of restricted products, keyed by product name.
+// Products without an access list are open: every user may do with them whatever their role allows. Once restricted, a product is only open to the users on its list, up to the access each was granted.
+// Safe for concurrent use.
+type Productaccess struct {
+	mu    sync.Mutex
+	lists map[string]map[string]Access // Product name -> username -> access
+}
+
+// NewProductaccess initializes a Productaccess with every product open.
+func NewProductaccess() *Productaccess {
+	return &Productaccess{lists: make(map[string]map[string]Access)}
+}
+
+// Restrict gives a product an empty access list. Returns false if the product is already restricted.
+func (pa *Productaccess) Restrict(product string) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	if _, ok := pa.lists[product]; ok {
+		return false
+	}
+	pa.lists[product] = make(map[string]Access)
+	return true
+}
+
+// Open discards a product's access list, opening it to every user. Returns false if the product is not restricted.
+func (pa *Productaccess) Open(product string) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	if _, ok := pa.lists[product]; !ok {
+		return false
+	}
+	delete(pa.lists, product)
+	return true
+}
+
+// Restricted reports whether a product has an access list.
+func (pa *Productaccess) Restricted(product string) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	_, ok := pa.lists[product]
+	return ok
+}
+
+// Grant sets a user's access to a restricted product, replacing any access they had; NoAccess removes them from the list.
+// Returns false if the product is not restricted.
+func (pa *Productaccess) Grant(product, user string, access Access) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	list, ok := pa.lists[product]
+	if !ok {
+		return false
+	}
+	if access == NoAccess {
+		delete(list, user)
+	} else {
+		list[user] = access
+	}
+	return true
+}
+
+// Allows reports whether a user has at least a given access to a product. Every user has full access to an open product.
+func (pa *Productaccess) Allows(product, user string, access Access) bool {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	list, ok := pa.lists[product]
+	return !ok || list[user] >= access
+}
+
+// Members returns the access list of a product, ordered by username. Returns an empty list if the product is not restricted.
+func (pa *Productaccess) Members(product string) []Member {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	result := make([]Member, 0, len(pa.lists[product]))
+	for user, access := range pa.lists[product] {
+		result = append(result, Member{User: user, Access: access})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].User < result[j].User })
+	return result
+}
+
+// Products returns the names of every restricted product, in order.
+func (pa *Productaccess) Products() []string {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	result := make([]string, 0, len(pa.lists))
+	for product := range pa.lists {
+		result = append(result, product)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// RenameProduct moves a product's access list over to its new name.
+func (pa *Productaccess) RenameProduct(oldname, newname string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	if list, ok := pa.lists[oldname]; ok {
+		delete(pa.lists, oldname)
+		pa.lists[newname] = list
+	}
+}
+
+// DeleteProduct discards a product's access list.
+func (pa *Productaccess) DeleteProduct(product string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	delete(pa.lists, product)
+}
+
+// RenameUser moves a user's access to every product over to their new username.
+func (pa *Productaccess) RenameUser(oldname, newname string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	for _, list := range pa.lists {
+		if access, ok := list[oldname]; ok {
+			delete(list, oldname)
+			list[newname] = access
+		}
+	}
+}
+
+// DeleteUser removes a user from every access list.
+func (pa *Productaccess) DeleteUser(user string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	for _, list := range pa.lists {
+		delete(list, user)
+	}
+}
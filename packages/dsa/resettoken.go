@@ -0,0 +1,138 @@
+package dsa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ResetToken struct records an outstanding password reset. Only the hash of the token sent to the user is kept, so a leaked store cannot be used to reset passwords.
+type ResetToken struct {
+	Hash    string // Hex-encoded SHA-256 hash of the token
+	User    string
+	Expires time.Time
+}
+
+// Resettokens holds outstanding password reset tokens, keyed by hash. Each user has at most one; issuing another replaces it.
+// Tokens are single-use: redeeming one discards it. Safe for concurrent use.
+type Resettokens struct {
+	mu     sync.Mutex
+	tokens map[string]ResetToken // Hash -> token
+}
+
+// NewResettokens initializes an empty store of reset tokens.
+func NewResettokens() *Resettokens {
+	return &Resettokens{tokens: make(map[string]ResetToken)}
+}
+
+// Issue creates a reset token for a user, valid until expires, replacing any token they had. Returns the token to send to the user.
+func (rt *Resettokens) Issue(user string, expires time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.deleteUser(user)
+	hash := HashToken(token)
+	rt.tokens[hash] = ResetToken{Hash: hash, User: user, Expires: expires}
+	return token, nil
+}
+
+// Restore adds a previously stored token. Used when loading from persistent storage.
+func (rt *Resettokens) Restore(token ResetToken) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.tokens[token.Hash] = token
+}
+
+// Check returns the user a token was issued to, if it is outstanding and unexpired at a given time. The token stays valid.
+func (rt *Resettokens) Check(token string, now time.Time) (string, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	stored, ok := rt.tokens[HashToken(token)]
+	if !ok || !now.Before(stored.Expires) {
+		return "", false
+	}
+	return stored.User, true
+}
+
+// Redeem returns the user a token was issued to, if it is outstanding and unexpired at a given time, and discards the token so that it cannot be used again.
+func (rt *Resettokens) Redeem(token string, now time.Time) (string, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	hash := HashToken(token)
+	stored, ok := rt.tokens[hash]
+	if !ok || !now.Before(stored.Expires) {
+		return "", false
+	}
+	delete(rt.tokens, hash)
+	return stored.User, true
+}
+
+// Expire discards every token expired at a given time. Returns the number of tokens discarded.
+func (rt *Resettokens) Expire(now time.Time) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	count := 0
+	for hash, token := range rt.tokens {
+		if !now.Before(token.Expires) {
+			delete(rt.tokens, hash)
+			count++
+		}
+	}
+	return count
+}
+
+// RenameUser moves a user's token over to their new username.
+func (rt *Resettokens) RenameUser(oldname, newname string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for hash, token := range rt.tokens {
+		if token.User == oldname {
+			token.User = newname
+			rt.tokens[hash] = token
+		}
+	}
+}
+
+// DeleteUser discards a user's token, if any.
+func (rt *Resettokens) DeleteUser(user string) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.deleteUser(user)
+}
+
+// AllTokens returns every outstanding token, soonest to expire first.
+func (rt *Resettokens) AllTokens() []ResetToken {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	result := make([]ResetToken, 0, len(rt.tokens))
+	for _, token := range rt.tokens {
+		result = append(result, token)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Expires.Before(result[j].Expires) })
+	return result
+}
+
+// HashToken returns the hex-encoded SHA-256 hash under which a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Utility functions
+
+// Discards a user's token. Assumes the lock is held.
+func (rt *Resettokens) deleteUser(user string) {
+	for hash, token := range rt.tokens {
+		if token.User == user {
+			delete(rt.tokens, hash)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package dsa
+
+import (
+	"strings"
+)
+
+// Role determines what a user may do in the application, through the permissions it grants.
+type Role string
+
+// Roles, from most to least trusted.
+const (
+	RoleAdmin     Role = "Admin"     // Everything, including managing users, products and the system
+	RoleTriager   Role = "Triager"   // Approves submissions, and may edit any ticket
+	RoleDeveloper Role = "Developer" // Works on the tickets assigned to them
+	RoleReporter  Role = "Reporter"  // Submits tickets and comments on them
+	RoleViewer    Role = "Viewer"    // Read-only access to tickets
+)
+
+// Roles lists every role, from most to least trusted.
+var Roles = []Role{RoleAdmin, RoleTriager, RoleDeveloper, RoleReporter, RoleViewer}
+
+// Permission names an action which only some roles may take.
+type Permission string
+
+const (
+	ViewTickets        Permission = "view tickets"        // View, search and filter tickets, submissions and comments
+	CommentTickets     Permission = "comment tickets"     // Comment on tickets and submissions
+	SubmitTickets      Permission = "submit tickets"      // Submit tickets for approval, and delete one's own tickets
+	WorkTickets        Permission = "work tickets"        // Be assigned tickets, and update or complete one's assignments
+	ApproveSubmissions Permission = "approve submissions" // Approve or reject submissions
+	EditAnyTicket      Permission = "edit any ticket"     // Update, complete or delete any ticket, not just one's own
+	ManageProducts     Permission = "manage products"     // Add, edit and delete products
+	ManageUsers        Permission = "manage users"        // Add, edit and delete users, and assign roles
+	ManageSystem       Permission = "manage system"       // Manage webhooks and view diagnostics
+)
+
+// Permissions granted by each role.
+var grants = map[Role][]Permission{
+	RoleAdmin:     {ViewTickets, CommentTickets, SubmitTickets, WorkTickets, ApproveSubmissions, EditAnyTicket, ManageProducts, ManageUsers, ManageSystem},
+	RoleTriager:   {ViewTickets, CommentTickets, SubmitTickets, WorkTickets, ApproveSubmissions, EditAnyTicket},
+	RoleDeveloper: {ViewTickets, CommentTickets, SubmitTickets, WorkTickets},
+	RoleReporter:  {ViewTickets, CommentTickets, SubmitTickets},
+	RoleViewer:    {ViewTickets},
+}
+
+// Can reports whether a role grants a given permission. Unknown roles grant nothing.
+func (role Role) Can(permission Permission) bool {
+	for _, granted := range grants[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted by a role.
+func (role Role) Permissions() []Permission {
+	return grants[role]
+}
+
+// ParseRole returns the role with a given name (case-insensitive).
+func ParseRole(name string) (Role, bool) {
+	for _, role := range Roles {
+		if strings.EqualFold(string(role), name) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// LegacyRole returns the role given to a user saved before roles were introduced, who only had an admin flag.
+// Admins become RoleAdmin, and everyone else RoleDeveloper, which keeps every permission non-admin users had.
+func LegacyRole(admin bool) Role {
+	if admin {
+		return RoleAdmin
+	}
+	return RoleDeveloper
+}
@@ -0,0 +1,194 @@
+package dsa
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session struct records a login. Only the hash of the token kept in the user's cookie is stored, and the hash also identifies the session on pages listing sessions.
+type Session struct {
+	Hash     string // Hex-encoded SHA-256 hash of the session token
+	User     string
+	Created  time.Time
+	LastSeen time.Time // Time of the latest request made with the session
+	Addr     string    // Client address at login
+	Agent    string    // Browser user agent at login
+}
+
+// SessionStore is implemented by stores of sessions: Sessions, held in memory only, and stores which also persist them so that users stay logged in across restarts.
+type SessionStore interface {
+	Start(user, addr, agent string, now time.Time) (string, error)
+	Touch(token string, now time.Time) (Session, bool)
+	Get(hash string) (Session, bool)
+	Revoke(hash string) bool
+	RevokeUser(user, except string) int
+	Expire(now time.Time) int
+	RenameUser(oldname, newname string)
+	UserSessions(user string) []Session
+	AllSessions() []Session
+	Expires(session Session) time.Time
+}
+
+// Sessions holds the sessions of logged-in users, keyed by hash. A user may have several sessions at once, e.g. on different devices.
+// A session expires once Lifetime has passed since login, or Idle has passed without a request, whichever comes first. Safe for concurrent use.
+type Sessions struct {
+	Lifetime time.Duration
+	Idle     time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]Session // Hash -> session
+}
+
+// NewSessions initializes an empty store of sessions, expiring after the given lifetime and idle time.
+func NewSessions(lifetime, idle time.Duration) *Sessions {
+	return &Sessions{Lifetime: lifetime, Idle: idle, sessions: make(map[string]Session)}
+}
+
+// Start creates a session for a user, logged in at a given time from a client address and user agent. Returns the token to set in the user's cookie.
+func (ss *Sessions) Start(user, addr, agent string, now time.Time) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	hash := HashToken(token)
+	ss.sessions[hash] = Session{Hash: hash, User: user, Created: now, LastSeen: now, Addr: addr, Agent: agent}
+	return token, nil
+}
+
+// Restore adds a previously stored session. Used when loading from persistent storage.
+func (ss *Sessions) Restore(session Session) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.sessions[session.Hash] = session
+}
+
+// Touch returns the session a token belongs to, if it is unexpired at a given time, and records a request made with it at that time.
+// An expired session is discarded.
+func (ss *Sessions) Touch(token string, now time.Time) (Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	hash := HashToken(token)
+	session, ok := ss.sessions[hash]
+	if !ok {
+		return Session{}, false
+	}
+	if ss.expired(session, now) {
+		delete(ss.sessions, hash)
+		return Session{}, false
+	}
+	session.LastSeen = now
+	ss.sessions[hash] = session
+	return session, true
+}
+
+// Get returns the session with a given hash.
+func (ss *Sessions) Get(hash string) (Session, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	session, ok := ss.sessions[hash]
+	return session, ok
+}
+
+// Revoke discards the session with a given hash, logging it out. Returns false if there was no such session.
+func (ss *Sessions) Revoke(hash string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if _, ok := ss.sessions[hash]; !ok {
+		return false
+	}
+	delete(ss.sessions, hash)
+	return true
+}
+
+// RevokeUser discards every session of a user, except the one with hash except (pass "" to keep none). Returns the number of sessions discarded.
+func (ss *Sessions) RevokeUser(user, except string) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	count := 0
+	for hash, session := range ss.sessions {
+		if session.User == user && hash != except {
+			delete(ss.sessions, hash)
+			count++
+		}
+	}
+	return count
+}
+
+// Expire discards every session expired at a given time. Returns the number of sessions discarded.
+func (ss *Sessions) Expire(now time.Time) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	count := 0
+	for hash, session := range ss.sessions {
+		if ss.expired(session, now) {
+			delete(ss.sessions, hash)
+			count++
+		}
+	}
+	return count
+}
+
+// RenameUser moves a user's sessions over to their new username, so that they stay logged in.
+func (ss *Sessions) RenameUser(oldname, newname string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for hash, session := range ss.sessions {
+		if session.User == oldname {
+			session.User = newname
+			ss.sessions[hash] = session
+		}
+	}
+}
+
+// UserSessions returns the sessions of a user, most recently used first.
+func (ss *Sessions) UserSessions(user string) []Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	result := []Session{}
+	for _, session := range ss.sessions {
+		if session.User == user {
+			result = append(result, session)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result
+}
+
+// AllSessions returns every session, sorted by username and then most recently used first.
+func (ss *Sessions) AllSessions() []Session {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	result := make([]Session, 0, len(ss.sessions))
+	for _, session := range ss.sessions {
+		result = append(result, session)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].User != result[j].User {
+			return result[i].User < result[j].User
+		}
+		return result[i].LastSeen.After(result[j].LastSeen)
+	})
+	return result
+}
+
+// Expires returns the time a session will expire if no further requests are made with it.
+func (ss *Sessions) Expires(session Session) time.Time {
+	absolute, idle := session.Created.Add(ss.Lifetime), session.LastSeen.Add(ss.Idle)
+	if idle.Before(absolute) {
+		return idle
+	}
+	return absolute
+}
+
+// Utility functions
+
+// Reports whether a session has expired at a given time.
+func (ss *Sessions) expired(session Session, now time.Time) bool {
+	return !now.Before(ss.Expires(session))
+}
@@ -0,0 +1,310 @@
+package dsa
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Aging configures how the effective priority of a queued submission differs from the priority it was submitted with.
+type Aging struct {
+	Step      time.Duration // Time spent in the queue which raises a submission by one priority level; 0 disables aging
+	FairShare int           // Priority levels a submission is lowered by for each earlier submission by the same creator still queued; 0 disables fair share
+}
+
+// Standing describes where a queued submission stands.
+type Standing struct {
+	Priority int // Effective priority; never above the highest priority (0)
+	Aged     int // Levels gained by time spent in the queue
+	Behind   int // Earlier submissions by the same creator still queued
+	Penalty  int // Levels lost to fair share, i.e. Behind * FairShare
+}
+
+// Submissionqueue is the queue of submissions awaiting approval: a PriorityQueue ordered by effective priority.
+// A submission's effective priority improves by one level for each Aging.Step it has spent in the queue (since its StartDate), so low-priority submissions cannot wait forever,
+// and worsens by Aging.FairShare levels for each earlier submission by the same creator still queued, so a single prolific creator cannot fill the front of the queue.
+// Since every submission ages at the same rate, the order between two submissions only changes with time when one of them reaches the highest priority (0), where aging stops: submissions at 0 are ordered by due date, like submissions of equal priority.
+// The queue is ordered as of the latest operation on it, and is reordered whenever a submission has reached 0 since the one before. Access is serialized via the inclusion of a Mutex.
+type Submissionqueue struct {
+	Now func() time.Time // Clock used to decide which submissions have aged to the highest priority; replaceable for deterministic checks
+
+	mu        sync.Mutex
+	queue     *PriorityQueue
+	aging     Aging
+	bycreator map[string][]Ticket // Each creator's queued submissions, oldest first
+	behind    map[int64]int       // TicketID -> earlier submissions by the same creator still queued
+	asof      time.Time           // Time the queue is ordered as of
+	next      time.Time           // Earliest time after asof at which a queued submission reaches the highest priority; zero if none will
+}
+
+// NewSubmissionqueue creates an empty Submissionqueue without aging or fair share, i.e. ordered as by Firstinline, and returns its pointer.
+func NewSubmissionqueue() *Submissionqueue {
+	sq := &Submissionqueue{
+		Now:       time.Now,
+		bycreator: make(map[string][]Ticket),
+		behind:    make(map[int64]int),
+	}
+	sq.queue = NewPriorityQueue(sq.compare)
+	return sq
+}
+
+// Aging returns the queue's current aging configuration.
+func (sq *Submissionqueue) Aging() Aging {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return sq.aging
+}
+
+// SetAging changes the queue's aging configuration, and reorders the queue to match.
+func (sq *Submissionqueue) SetAging(aging Aging) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.aging = aging
+	sq.asof = sq.Now()
+	sq.rebuild()
+}
+
+// Len returns the number of queued submissions.
+func (sq *Submissionqueue) Len() int {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return sq.queue.Len()
+}
+
+// Get returns the queued submission with a given TicketID.
+func (sq *Submissionqueue) Get(ticketID int64) (Ticket, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	return sq.queue.Get(ticketID)
+}
+
+// Push queues a submission. If a submission with the same TicketID is already queued, it is replaced.
+func (sq *Submissionqueue) Push(ticket Ticket) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	sq.remove(ticket.TicketID)
+	sq.push(ticket)
+}
+
+// Peek returns the submission at the front of the queue without removing it. Returns false if the queue is empty.
+func (sq *Submissionqueue) Peek() (Ticket, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	return sq.queue.Peek()
+}
+
+// Pop removes the submission at the front of the queue, returning the removed submission. Returns false if the queue is empty.
+func (sq *Submissionqueue) Pop() (Ticket, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	front, ok := sq.queue.Peek()
+	if !ok {
+		return Ticket{}, false
+	}
+	return sq.remove(front.TicketID)
+}
+
+// Remove removes the submission with a given TicketID from the queue, returning the removed submission. Returns false if no such submission is queued.
+func (sq *Submissionqueue) Remove(ticketID int64) (Ticket, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	return sq.remove(ticketID)
+}
+
+// Update changes the queued submission with a given TicketID by edit, which must not change the TicketID, and moves it to its new place in the queue.
+// Returns the edited submission, or false if no such submission is queued.
+func (sq *Submissionqueue) Update(ticketID int64, edit func(ticket *Ticket)) (Ticket, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	ticket, ok := sq.remove(ticketID)
+	if !ok {
+		return Ticket{}, false
+	}
+	edit(&ticket)
+	ticket.TicketID = ticketID
+	sq.push(ticket)
+	return ticket, true
+}
+
+// Tickets returns a copy of the queued submissions in queue order, i.e. in the order they would be popped.
+func (sq *Submissionqueue) Tickets() []Ticket {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.refresh()
+	tickets := sq.queue.Tickets()
+	slices.SortFunc(tickets, sq.compare)
+	return tickets
+}
+
+// Standing returns the standing of the queued submission with a given TicketID at a given time. Returns false if no such submission is queued.
+func (sq *Submissionqueue) Standing(ticketID int64, now time.Time) (Standing, bool) {
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	ticket, ok := sq.queue.Get(ticketID)
+	if !ok {
+		return Standing{}, false
+	}
+	standing := Standing{
+		Behind:  sq.behind[ticketID],
+		Penalty: sq.behind[ticketID] * sq.aging.FairShare,
+	}
+	if sq.aging.Step > 0 && now.After(ticket.StartDate) {
+		standing.Aged = int(now.Sub(ticket.StartDate) / sq.aging.Step)
+	}
+	standing.Priority = max(ticket.Priority+standing.Penalty-standing.Aged, 0)
+	return standing, true
+}
+
+// Printsubmissions returns the printed submissions in queue order, each followed by its effective priority at a given time.
+// If keep is not nil, only the submissions for which it returns true are printed.
+func Printsubmissions(submissions *Submissionqueue, now time.Time, keep func(ticket Ticket) bool, priorities, products, statuses, categories *[]string) [][]string {
+	var s [][]string
+	tickets := submissions.Tickets()
+	if len(tickets) == 0 {
+		fmt.Println("No submissions outstanding.")
+	}
+	for _, ticket := range tickets {
+		if keep != nil && !keep(ticket) {
+			continue
+		}
+		printed := printTicket(ticket, priorities, products, statuses, categories)
+		if standing, ok := submissions.Standing(ticket.TicketID, now); ok {
+			line := fmt.Sprint("Effective Priority: ", (*priorities)[min(standing.Priority, len(*priorities)-1)])
+			if standing.Aged > 0 {
+				line += fmt.Sprintf(" (+%d for time in queue)", standing.Aged)
+			}
+			if standing.Penalty > 0 {
+				line += fmt.Sprintf(" (-%d for fair share: %d earlier submissions by %s queued)", standing.Penalty, standing.Behind, ticket.Creator)
+			}
+			// Insert before the closing separator line
+			printed = slices.Insert(printed, len(printed)-1, fmt.Sprintln(line))
+		}
+		s = append(s, printed)
+	}
+	return s
+}
+
+// Utility functions. These assume the caller holds the Mutex.
+
+// Orders submissions by effective priority as of asof, then by due date, then by TicketID.
+// With aging, comparing effective priorities above 0 is the same as comparing the times at which each submission reaches 0, which do not depend on the moment. Submissions which have reached 0 stay there, and are tied on priority.
+func (sq *Submissionqueue) compare(a, b Ticket) int {
+	if sq.aging.Step > 0 {
+		topa, topb := sq.topped(a), sq.topped(b)
+		cleara, clearb := !topa.After(sq.asof), !topb.After(sq.asof)
+		switch {
+		case cleara && clearb:
+		case cleara:
+			return -1
+		case clearb:
+			return 1
+		default:
+			if c := topa.Compare(topb); c != 0 {
+				return c
+			}
+		}
+	} else if c := compareInt64(int64(sq.level(a)), int64(sq.level(b))); c != 0 {
+		return c
+	}
+	if c := CompareDueDate(a, b); c != 0 {
+		return c
+	}
+	return CompareTicketID(a, b)
+}
+
+// Returns the priority level a submission is queued at before aging, i.e. its priority plus any fair share penalty.
+func (sq *Submissionqueue) level(ticket Ticket) int {
+	return ticket.Priority + sq.aging.FairShare*sq.behind[ticket.TicketID]
+}
+
+// Returns the time at which a submission ages to the highest priority (0).
+func (sq *Submissionqueue) topped(ticket Ticket) time.Time {
+	return ticket.StartDate.Add(time.Duration(sq.level(ticket)) * sq.aging.Step)
+}
+
+// Moves the time the queue is ordered as of to now. If a submission has reached the highest priority since, or the clock has gone back, the order has changed and the queue is rebuilt.
+func (sq *Submissionqueue) refresh() {
+	now := sq.Now()
+	reached := !sq.next.IsZero() && !sq.next.After(now)
+	backwards := now.Before(sq.asof)
+	sq.asof = now
+	if reached || backwards {
+		sq.rebuild()
+	}
+}
+
+// Requeues every submission in the order as of asof.
+func (sq *Submissionqueue) rebuild() {
+	tickets := sq.queue.Tickets()
+	sq.queue = NewPriorityQueue(sq.compare)
+	sq.next = time.Time{}
+	for _, ticket := range tickets {
+		sq.queue.Push(ticket)
+		sq.watch(ticket)
+	}
+}
+
+// Records when a queued submission will reach the highest priority, if it has yet to.
+func (sq *Submissionqueue) watch(ticket Ticket) {
+	if sq.aging.Step <= 0 {
+		return
+	}
+	if top := sq.topped(ticket); top.After(sq.asof) && (sq.next.IsZero() || top.Before(sq.next)) {
+		sq.next = top
+	}
+}
+
+// Queues a submission, which must not already be queued, behind its creator's earlier submissions.
+func (sq *Submissionqueue) push(ticket Ticket) {
+	mine := sq.bycreator[ticket.Creator]
+	rank := sort.Search(len(mine), func(i int) bool { return earlier(ticket, mine[i]) })
+	sq.bycreator[ticket.Creator] = slices.Insert(mine, rank, ticket)
+	sq.behind[ticket.TicketID] = rank
+	sq.queue.Push(ticket)
+	sq.watch(ticket)
+	sq.reshare(ticket.Creator)
+}
+
+// Removes and returns a queued submission, if any, moving its creator's later submissions up.
+func (sq *Submissionqueue) remove(ticketID int64) (Ticket, bool) {
+	ticket, ok := sq.queue.Remove(ticketID)
+	if !ok {
+		return Ticket{}, false
+	}
+	mine := sq.bycreator[ticket.Creator]
+	mine = slices.Delete(mine, sq.behind[ticketID], sq.behind[ticketID]+1)
+	if len(mine) == 0 {
+		delete(sq.bycreator, ticket.Creator)
+	} else {
+		sq.bycreator[ticket.Creator] = mine
+	}
+	delete(sq.behind, ticketID)
+	sq.reshare(ticket.Creator)
+	return ticket, true
+}
+
+// Recounts the earlier submissions queued ahead of each of a creator's submissions. Each submission whose count changed is moved to its new place in the queue in turn, so that the heap is never out of order in more than one place.
+func (sq *Submissionqueue) reshare(creator string) {
+	for rank, ticket := range sq.bycreator[creator] {
+		if sq.behind[ticket.TicketID] != rank {
+			sq.behind[ticket.TicketID] = rank
+			sq.queue.Update(ticket.TicketID, func(*Ticket) {})
+			sq.watch(ticket)
+		}
+	}
+}
+
+// Returns true if submission a was queued before submission b.
+func earlier(a, b Ticket) bool {
+	if c := CompareStartDate(a, b); c != 0 {
+		return c < 0
+	}
+	return a.TicketID < b.TicketID
+}
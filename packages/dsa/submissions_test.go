@@ -0,0 +1,158 @@
+package dsa
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Returns a queue with a given aging configuration, whose clock the test moves by hand.
+func newTestQueue(aging Aging, now *time.Time) *Submissionqueue {
+	sq := NewSubmissionqueue()
+	sq.Now = func() time.Time { return *now }
+	sq.SetAging(aging)
+	return sq
+}
+
+func TestAgingStopsAtHighestPriority(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0.Add(10 * day)
+	sq := newTestQueue(Aging{Step: day}, &now)
+	// Both have aged well past the highest priority, so the one due first goes first, whichever was submitted at the lower priority
+	sq.Push(Ticket{TicketID: 1, Priority: 2, StartDate: t0, DueDate: t0.Add(20 * day)})
+	sq.Push(Ticket{TicketID: 2, Priority: 1, StartDate: t0, DueDate: t0.Add(30 * day)})
+
+	if front, _ := sq.Peek(); front.TicketID != 1 {
+		t.Errorf("front of queue is ticket %d, want ticket 1 (due first)", front.TicketID)
+	}
+	for _, ticketID := range []int64{1, 2} {
+		if standing, _ := sq.Standing(ticketID, now); standing.Priority != 0 {
+			t.Errorf("ticket %d has effective priority %d, want 0", ticketID, standing.Priority)
+		}
+	}
+}
+
+func TestQueueReordersWhenPriorityTops(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0.Add(day)
+	sq := newTestQueue(Aging{Step: day}, &now)
+	sq.Push(Ticket{TicketID: 1, Priority: 2, StartDate: t0, DueDate: t0.Add(5 * day)})  // Reaches 0 at t0+2d
+	sq.Push(Ticket{TicketID: 2, Priority: 0, StartDate: t0, DueDate: t0.Add(30 * day)}) // At 0 from the start
+
+	if front, _ := sq.Peek(); front.TicketID != 2 {
+		t.Fatalf("at t0+1d front of queue is ticket %d, want ticket 2 (higher effective priority)", front.TicketID)
+	}
+	now = t0.Add(2 * day)
+	if front, _ := sq.Peek(); front.TicketID != 1 {
+		t.Fatalf("at t0+2d front of queue is ticket %d, want ticket 1 (both at 0, due first)", front.TicketID)
+	}
+	now = t0.Add(time.Hour) // Clocks may be set back
+	if front, _ := sq.Peek(); front.TicketID != 2 {
+		t.Fatalf("at t0+1h front of queue is ticket %d, want ticket 2", front.TicketID)
+	}
+}
+
+func TestFairShareWithAging(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := t0
+	sq := newTestQueue(Aging{Step: day, FairShare: 1}, &now)
+	sq.Push(Ticket{TicketID: 1, Priority: 0, StartDate: t0, Creator: "alice", DueDate: t0.Add(9 * day)})
+	sq.Push(Ticket{TicketID: 2, Priority: 0, StartDate: t0.Add(time.Minute), Creator: "alice", DueDate: t0.Add(day)})
+	sq.Push(Ticket{TicketID: 3, Priority: 0, StartDate: t0.Add(time.Minute), Creator: "bob", DueDate: t0.Add(5 * day)})
+
+	now = t0.Add(time.Hour)
+	if standing, _ := sq.Standing(2, now); standing.Priority != 1 || standing.Penalty != 1 {
+		t.Errorf("ticket 2 standing %+v, want priority 1 after a penalty of 1", standing)
+	}
+	want := []int64{3, 1, 2} // Alice's second submission waits behind bob's, though due first
+	for i, ticket := range sq.Tickets() {
+		if ticket.TicketID != want[i] {
+			t.Fatalf("queue order %v, want %v", ids(sq.Tickets()), want)
+		}
+	}
+
+	// A day on, alice's second submission has aged back to 0, and is due first
+	now = t0.Add(day + time.Minute)
+	if front, _ := sq.Peek(); front.TicketID != 2 {
+		t.Errorf("front of queue is ticket %d, want ticket 2", front.TicketID)
+	}
+}
+
+func TestSubmissionqueueRandomOperations(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		now := t0
+		aging := Aging{Step: day, FairShare: rng.Intn(2)}
+		sq := newTestQueue(aging, &now)
+		queued := make(map[int64]bool)
+
+		// Reference order: time left until each submission reaches the highest priority (none once it has), then due date, then TicketID
+		reference := func(a, b Ticket) int {
+			left := func(ticket Ticket) time.Duration {
+				standing, _ := sq.Standing(ticket.TicketID, now)
+				top := ticket.StartDate.Add(time.Duration(ticket.Priority+aging.FairShare*standing.Behind) * aging.Step)
+				return max(top.Sub(now), 0)
+			}
+			if c := compareInt64(int64(left(a)), int64(left(b))); c != 0 {
+				return c
+			}
+			if c := CompareDueDate(a, b); c != 0 {
+				return c
+			}
+			return CompareTicketID(a, b)
+		}
+
+		for step := 0; step < 500; step++ {
+			now = now.Add(time.Duration(rng.Intn(12)) * time.Hour)
+			switch op := rng.Intn(10); {
+			case op < 5:
+				ticket := Ticket{
+					TicketID:  int64(rng.Intn(40)),
+					Priority:  rng.Intn(3),
+					StartDate: now.Add(-time.Duration(rng.Intn(72)) * time.Hour),
+					DueDate:   t0.AddDate(0, 0, rng.Intn(60)),
+					Creator:   []string{"alice", "bob", "carol"}[rng.Intn(3)],
+				}
+				sq.Push(ticket)
+				queued[ticket.TicketID] = true
+			case op < 7:
+				ticketID := int64(rng.Intn(40))
+				if _, ok := sq.Remove(ticketID); ok != queued[ticketID] {
+					t.Fatalf("seed %d step %d: Remove(%d) = %v, want %v", seed, step, ticketID, ok, queued[ticketID])
+				}
+				delete(queued, ticketID)
+			default:
+				tickets := sq.Tickets()
+				front, ok := sq.Pop()
+				if ok != (len(tickets) > 0) || (ok && front != tickets[0]) {
+					t.Fatalf("seed %d step %d: Pop = %+v, %v; want the first of Tickets", seed, step, front, ok)
+				}
+				delete(queued, front.TicketID)
+			}
+
+			tickets := sq.Tickets()
+			if len(tickets) != len(queued) {
+				t.Fatalf("seed %d step %d: %d submissions queued, want %d", seed, step, len(tickets), len(queued))
+			}
+			for i, ticket := range tickets {
+				if i > 0 && reference(tickets[i-1], ticket) > 0 {
+					t.Fatalf("seed %d step %d: ticket %d queued before ticket %d", seed, step, tickets[i-1].TicketID, ticket.TicketID)
+				}
+				if standing, _ := sq.Standing(ticket.TicketID, now); standing.Priority < 0 {
+					t.Fatalf("seed %d step %d: ticket %d has effective priority %d", seed, step, ticket.TicketID, standing.Priority)
+				}
+			}
+		}
+	}
+}
+
+func ids(tickets []Ticket) []int64 {
+	result := make([]int64, len(tickets))
+	for i, ticket := range tickets {
+		result[i] = ticket.TicketID
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+package dsa
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Team struct records a named group of users sharing a queue of tickets, which any member may claim.
+type Team struct {
+	Name    string
+	Lead    string   // May hand the team's tickets to any member; always a member, or blank
+	Members []string // Usernames, in the order they joined
+}
+
+// HasMember reports whether a user belongs to the team.
+func (team Team) HasMember(user string) bool {
+	return slices.Contains(team.Members, user)
+}
+
+// Teamroster holds every team, with names unique regardless of case. Safe for concurrent use.
+type Teamroster struct {
+	mu    sync.Mutex
+	teams map[string]Team // Lower-cased name -> team
+}
+
+// NewTeamroster initializes an empty team roster.
+func NewTeamroster() *Teamroster {
+	return &Teamroster{teams: make(map[string]Team)}
+}
+
+// AddTeam stores a new team. Returns false if a team with the same name already exists.
+func (tr *Teamroster) AddTeam(team Team) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, ok := tr.teams[strings.ToLower(team.Name)]; ok {
+		return false
+	}
+	tr.teams[strings.ToLower(team.Name)] = normalize(team)
+	return true
+}
+
+// Restore adds a previously stored team, replacing any team with the same name. Used when loading from persistent storage.
+func (tr *Teamroster) Restore(team Team) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.teams[strings.ToLower(team.Name)] = normalize(team)
+}
+
+// GetTeam returns the team with a given name (case-insensitive), if any.
+func (tr *Teamroster) GetTeam(name string) (Team, bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	team, ok := tr.teams[strings.ToLower(name)]
+	return team.clone(), ok
+}
+
+// DeleteTeam removes the team with a given name. Returns false if no such team exists.
+func (tr *Teamroster) DeleteTeam(name string) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, ok := tr.teams[strings.ToLower(name)]; !ok {
+		return false
+	}
+	delete(tr.teams, strings.ToLower(name))
+	return true
+}
+
+// AddMember adds a user to a team. Returns false if no such team exists, or the user is already a member.
+func (tr *Teamroster) AddMember(name, user string) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	team, ok := tr.teams[strings.ToLower(name)]
+	if !ok || team.HasMember(user) {
+		return false
+	}
+	team.Members = append(slices.Clip(team.Members), user)
+	tr.teams[strings.ToLower(name)] = team
+	return true
+}
+
+// RemoveMember removes a user from a team, who stops leading it if they did. Returns false if no such team exists, or the user is not a member.
+func (tr *Teamroster) RemoveMember(name, user string) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	team, ok := tr.teams[strings.ToLower(name)]
+	if !ok || !team.HasMember(user) {
+		return false
+	}
+	tr.teams[strings.ToLower(name)] = withoutMember(team, user)
+	return true
+}
+
+// SetLead makes a member the lead of a team, or leaves the team without a lead if user is blank. Returns false if no such team exists, or the user is not a member.
+func (tr *Teamroster) SetLead(name, user string) bool {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	team, ok := tr.teams[strings.ToLower(name)]
+	if !ok || (user != "" && !team.HasMember(user)) {
+		return false
+	}
+	team.Lead = user
+	tr.teams[strings.ToLower(name)] = team
+	return true
+}
+
+// MemberOf returns the teams a user belongs to, ordered by name.
+func (tr *Teamroster) MemberOf(user string) []Team {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	result := make([]Team, 0)
+	for _, team := range tr.teams {
+		if team.HasMember(user) {
+			result = append(result, team.clone())
+		}
+	}
+	sortTeams(result)
+	return result
+}
+
+// RenameUser moves a user's memberships and leads over to their new username.
+func (tr *Teamroster) RenameUser(oldname, newname string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for key, team := range tr.teams {
+		if !team.HasMember(oldname) {
+			continue
+		}
+		team = team.clone()
+		team.Members[slices.Index(team.Members, oldname)] = newname
+		if team.Lead == oldname {
+			team.Lead = newname
+		}
+		tr.teams[key] = team
+	}
+}
+
+// DeleteUser removes a user from every team.
+func (tr *Teamroster) DeleteUser(user string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	for key, team := range tr.teams {
+		if team.HasMember(user) {
+			tr.teams[key] = withoutMember(team, user)
+		}
+	}
+}
+
+// AllTeams returns every team, ordered by name.
+func (tr *Teamroster) AllTeams() []Team {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	result := make([]Team, 0, len(tr.teams))
+	for _, team := range tr.teams {
+		result = append(result, team.clone())
+	}
+	sortTeams(result)
+	return result
+}
+
+// Utility functions
+
+// Returns a copy of a team which shares no memory with it, so that callers cannot modify stored members.
+func (team Team) clone() Team {
+	team.Members = slices.Clone(team.Members)
+	return team
+}
+
+// Returns a copy of a team with repeated members dropped, and its lead cleared unless a member.
+func normalize(team Team) Team {
+	members := make([]string, 0, len(team.Members))
+	for _, member := range team.Members {
+		if member != "" && !slices.Contains(members, member) {
+			members = append(members, member)
+		}
+	}
+	team.Members = members
+	if !team.HasMember(team.Lead) {
+		team.Lead = ""
+	}
+	return team
+}
+
+// Returns a copy of a team without a given member, clearing the lead if it was them.
+func withoutMember(team Team, user string) Team {
+	team.Members = slices.DeleteFunc(slices.Clone(team.Members), func(member string) bool { return member == user })
+	if team.Lead == user {
+		team.Lead = ""
+	}
+	return team
+}
+
+// Orders teams by name, case-insensitively.
+func sortTeams(teams []Team) {
+	sort.Slice(teams, func(i, j int) bool { return strings.ToLower(teams[i].Name) < strings.ToLower(teams[j].Name) })
+}
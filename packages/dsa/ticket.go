@@ -17,19 +17,21 @@ import (
 // Creator     string     Input restricted to existing usernames
 // Title       string     Header summary for ticket
 // Description string     Elaboration for ticket
-// Assignee    string     Input restricted to existing usernames
+// Assignee    string     Input restricted to existing usernames; blank while a team's ticket is unclaimed
+// Team        string     Team whose members may claim the ticket, if any (see Teamroster)
 
 type Ticket struct {
 	TicketID                                      int64
 	Product, Status, Category, Priority, EstHours int
 	StartDate, DueDate                            time.Time
-	Creator, Title, Description, Assignee         string
+	Creator, Title, Description, Assignee, Team   string
 }
 
 // TicketNode struct specifies fields for an Ticket struct, two pointers to other Nodes within storage AVL Tree, and height for maintaining balance within AVL tree.
 type TicketNode struct {
 	Ticket Ticket
 	Height int
+	Size   int // Number of nodes in the subtree rooted at this node, including itself; maintained by AVLinsert and AVLdeleteBy
 	Left   *TicketNode
 	Right  *TicketNode
 }
@@ -246,6 +248,11 @@ func Newticket(
 // 	}
 // }
 
+// PrintTicket returns a formatted print of a single ticket, for pages displaying one ticket at a time.
+func PrintTicket(ticket Ticket, priorities, products, statuses, categories *[]string) []string {
+	return printTicket(ticket, priorities, products, statuses, categories)
+}
+
 // printTicket returns a formatted print of a ticket, with all appropriate values parsed for passing into the relevant HTML template.
 func printTicket(ticket Ticket, priorities, products, statuses, categories *[]string) []string {
 	var s []string
@@ -255,6 +262,9 @@ func printTicket(ticket Ticket, priorities, products, statuses, categories *[]st
 	s = append(s, fmt.Sprintln(""))
 	s = append(s, fmt.Sprintln("Creator:", ticket.Creator))
 	s = append(s, fmt.Sprintln("Assignee:", ticket.Assignee))
+	if ticket.Team != "" {
+		s = append(s, fmt.Sprintln("Team:", ticket.Team))
+	}
 	s = append(s, fmt.Sprintln(""))
 	s = append(s, fmt.Sprintln("Estimated Hours to Complete:", ticket.EstHours))
 	s = append(s, fmt.Sprintln("Priority:", (*priorities)[ticket.Priority]))
@@ -0,0 +1,305 @@
+package dsa
+
+import (
+	"sync"
+)
+
+// Sortfuncs maps the name of each indexed Ticket field to the sortfunc ordering tickets by it.
+// Each is the Chain of the field's ascending comparator, so that an index read in ascending order is exactly the order Chain sorts the same key into.
+var Sortfuncs = map[string]func(newticket *TicketNode, junction *TicketNode) bool{
+	"Product":     Chain(SortKey{Compare: CompareProduct}),
+	"Status":      Chain(SortKey{Compare: CompareStatus}),
+	"Category":    Chain(SortKey{Compare: CompareCategory}),
+	"Priority":    Chain(SortKey{Compare: ComparePriority}),
+	"EstHours":    Chain(SortKey{Compare: CompareEstHours}),
+	"StartDate":   Chain(SortKey{Compare: CompareStartDate}),
+	"DueDate":     Chain(SortKey{Compare: CompareDueDate}),
+	"Creator":     Chain(SortKey{Compare: CompareCreator}),
+	"Assignee":    Chain(SortKey{Compare: CompareAssignee}),
+	"Title":       Chain(SortKey{Compare: CompareTitle}),
+	"Description": Chain(SortKey{Compare: CompareDescription}),
+	"TicketID":    ByTicketID,
+}
+
+// Ticketindex holds secondary indexes over the ticket log: one AVL tree of copied tickets per field in Sortfuncs, per-user trees of the tickets each user created or is assigned, and per-team trees of the tickets assigned to each team.
+// Indexes are updated as part of each insert, edit and delete, so reading tickets in any indexed order costs a single traversal rather than a rebuild. Safe for concurrent use.
+type Ticketindex struct {
+	mu         sync.RWMutex
+	tickets    map[int64]Ticket    // Each ticket as last indexed, used to locate it in the trees when it changes
+	sorted     map[string]*AVLtree // Field name -> every ticket, sorted by that field
+	byCreator  map[string]*AVLtree // Username -> tickets created by that user, sorted by TicketID
+	byAssignee map[string]*AVLtree // Username -> tickets assigned to that user, sorted by TicketID
+	byTeam     map[string]*AVLtree // Team name -> tickets assigned to that team, claimed or not, sorted by TicketID
+}
+
+// NewTicketindex initializes an empty ticket index.
+func NewTicketindex() *Ticketindex {
+	ti := &Ticketindex{
+		tickets:    make(map[int64]Ticket),
+		sorted:     make(map[string]*AVLtree),
+		byCreator:  make(map[string]*AVLtree),
+		byAssignee: make(map[string]*AVLtree),
+		byTeam:     make(map[string]*AVLtree),
+	}
+	for field, sortfunc := range Sortfuncs {
+		ti.sorted[field] = NewAVLT(sortfunc)
+	}
+	return ti
+}
+
+// BuildTicketindex indexes every ticket in an AVL tree (at a given root node) from scratch, and returns the index's pointer.
+func BuildTicketindex(avlroot *TicketNode) *Ticketindex {
+	ti := NewTicketindex()
+	var walk func(node *TicketNode)
+	walk = func(node *TicketNode) {
+		if node == nil {
+			return
+		}
+		walk(node.Left)
+		ti.insert(node.Ticket)
+		walk(node.Right)
+	}
+	walk(avlroot)
+	return ti
+}
+
+// Insert indexes a ticket. If a ticket with the same TicketID is already indexed, it is replaced.
+func (ti *Ticketindex) Insert(ticket Ticket) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.put(ticket)
+}
+
+// Update re-indexes a ticket after it has been edited. Trees in which the ticket keeps its position are updated in place.
+func (ti *Ticketindex) Update(ticket Ticket) {
+	ti.Insert(ticket)
+}
+
+// Delete removes a ticket from every index. Returns false if no such ticket is indexed.
+func (ti *Ticketindex) Delete(ticketID int64) bool {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	return ti.remove(ticketID)
+}
+
+// Get returns the indexed ticket with a given TicketID.
+func (ti *Ticketindex) Get(ticketID int64) (Ticket, bool) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	ticket, ok := ti.tickets[ticketID]
+	return ticket, ok
+}
+
+// Len returns the number of tickets indexed.
+func (ti *Ticketindex) Len() int {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	return len(ti.tickets)
+}
+
+// Sorted returns every ticket ordered by an indexed field (with TicketID as tiebreaker), reversed if descending. Returns nil if the field is not indexed.
+func (ti *Ticketindex) Sorted(field string, descending bool) []Ticket {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	tree, ok := ti.sorted[field]
+	if !ok {
+		return nil
+	}
+	result := make([]Ticket, 0, len(ti.tickets))
+	result = collect(tree.Root, result)
+	if descending {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result
+}
+
+// Created returns the tickets created by a user, ordered by TicketID.
+func (ti *Ticketindex) Created(user string) []Ticket {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byCreator[user]; ok {
+		return collect(tree.Root, nil)
+	}
+	return []Ticket{}
+}
+
+// Assigned returns the tickets assigned to a user, ordered by TicketID.
+func (ti *Ticketindex) Assigned(user string) []Ticket {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byAssignee[user]; ok {
+		return collect(tree.Root, nil)
+	}
+	return []Ticket{}
+}
+
+// Team returns the tickets assigned to a team, claimed or not, ordered by TicketID.
+func (ti *Ticketindex) Team(team string) []Ticket {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byTeam[team]; ok {
+		return collect(tree.Root, nil)
+	}
+	return []Ticket{}
+}
+
+// SortedRange returns one page of Sorted: up to limit tickets starting from a given position (counting from 0), along with the total number of tickets.
+// Returns nil and 0 if the field is not indexed.
+func (ti *Ticketindex) SortedRange(field string, descending bool, from, limit int) ([]Ticket, int) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	tree, ok := ti.sorted[field]
+	if !ok {
+		return nil, 0
+	}
+	return pageOf(tree.Root, descending, from, limit), AVLsize(tree.Root)
+}
+
+// CreatedRange returns one page of Created, along with the total number of tickets created by the user.
+func (ti *Ticketindex) CreatedRange(user string, from, limit int) ([]Ticket, int) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byCreator[user]; ok {
+		return pageOf(tree.Root, false, from, limit), AVLsize(tree.Root)
+	}
+	return []Ticket{}, 0
+}
+
+// AssignedRange returns one page of Assigned, along with the total number of tickets assigned to the user.
+func (ti *Ticketindex) AssignedRange(user string, from, limit int) ([]Ticket, int) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byAssignee[user]; ok {
+		return pageOf(tree.Root, false, from, limit), AVLsize(tree.Root)
+	}
+	return []Ticket{}, 0
+}
+
+// TeamRange returns one page of Team, along with the total number of tickets assigned to the team.
+func (ti *Ticketindex) TeamRange(team string, from, limit int) ([]Ticket, int) {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+	if tree, ok := ti.byTeam[team]; ok {
+		return pageOf(tree.Root, false, from, limit), AVLsize(tree.Root)
+	}
+	return []Ticket{}, 0
+}
+
+// Utility functions
+
+// Indexes a ticket, replacing any indexed ticket with the same TicketID. Assumes the lock is held.
+func (ti *Ticketindex) put(ticket Ticket) {
+	if old, ok := ti.tickets[ticket.TicketID]; ok {
+		ti.update(old, ticket)
+		return
+	}
+	ti.insert(ticket)
+}
+
+// Removes a ticket from every index. Returns false if no such ticket is indexed. Assumes the lock is held.
+func (ti *Ticketindex) remove(ticketID int64) bool {
+	old, ok := ti.tickets[ticketID]
+	if !ok {
+		return false
+	}
+	target := &TicketNode{Ticket: old}
+	for _, tree := range ti.sorted {
+		tree.Root = AVLdeleteBy(tree.Root, target, tree.Sortfunc)
+	}
+	removeFromGroup(ti.byCreator, old.Creator, target)
+	removeFromGroup(ti.byAssignee, old.Assignee, target)
+	removeFromGroup(ti.byTeam, old.Team, target)
+	delete(ti.tickets, ticketID)
+	return true
+}
+
+// Adds a ticket which is not yet indexed to every index. Assumes the lock is held.
+func (ti *Ticketindex) insert(ticket Ticket) {
+	for _, tree := range ti.sorted {
+		tree.Root = AVLinsert(&TicketNode{Ticket: ticket}, tree.Sortfunc, tree.Root)
+	}
+	addToGroup(ti.byCreator, ticket.Creator, ticket)
+	addToGroup(ti.byAssignee, ticket.Assignee, ticket)
+	addToGroup(ti.byTeam, ticket.Team, ticket)
+	ti.tickets[ticket.TicketID] = ticket
+}
+
+// Replaces an indexed ticket with its edited version. Assumes the lock is held.
+func (ti *Ticketindex) update(old, ticket Ticket) {
+	target := &TicketNode{Ticket: old}
+	edited := &TicketNode{Ticket: ticket}
+	for _, tree := range ti.sorted {
+		// Unless the edit moves the ticket within this tree's order, it can be swapped in place
+		if !tree.Sortfunc(target, edited) && !tree.Sortfunc(edited, target) {
+			if node := AVLfind(tree.Root, target, tree.Sortfunc); node != nil {
+				node.Ticket = ticket
+				continue
+			}
+		}
+		tree.Root = AVLdeleteBy(tree.Root, target, tree.Sortfunc)
+		tree.Root = AVLinsert(&TicketNode{Ticket: ticket}, tree.Sortfunc, tree.Root)
+	}
+	removeFromGroup(ti.byCreator, old.Creator, target)
+	removeFromGroup(ti.byAssignee, old.Assignee, target)
+	removeFromGroup(ti.byTeam, old.Team, target)
+	addToGroup(ti.byCreator, ticket.Creator, ticket)
+	addToGroup(ti.byAssignee, ticket.Assignee, ticket)
+	addToGroup(ti.byTeam, ticket.Team, ticket)
+	ti.tickets[ticket.TicketID] = ticket
+}
+
+// Adds a ticket to the tree grouping tickets under a given username or team name, creating the tree if needed.
+func addToGroup(groups map[string]*AVLtree, user string, ticket Ticket) {
+	tree, ok := groups[user]
+	if !ok {
+		tree = NewAVLT(ByTicketID)
+		groups[user] = tree
+	}
+	tree.Root = AVLinsert(&TicketNode{Ticket: ticket}, tree.Sortfunc, tree.Root)
+}
+
+// Removes a ticket from the tree grouping tickets under a given username or team name, discarding the tree once empty.
+func removeFromGroup(groups map[string]*AVLtree, user string, target *TicketNode) {
+	tree, ok := groups[user]
+	if !ok {
+		return
+	}
+	tree.Root = AVLdeleteBy(tree.Root, target, tree.Sortfunc)
+	if tree.Root == nil {
+		delete(groups, user)
+	}
+}
+
+// Returns up to limit tickets of an AVL tree starting from a given position, counting from the end of the tree if descending.
+func pageOf(avlroot *TicketNode, descending bool, from, limit int) []Ticket {
+	if from < 0 {
+		from = 0
+	}
+	if !descending {
+		return AVLrange(avlroot, from, limit, make([]Ticket, 0))
+	}
+	// Read the same positions counted from the start of the tree, then reverse them
+	end := AVLsize(avlroot) - from
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	result := AVLrange(avlroot, start, end-start, make([]Ticket, 0))
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// Appends the tickets in an AVL tree to result, in order.
+func collect(avlroot *TicketNode, result []Ticket) []Ticket {
+	if avlroot == nil {
+		return result
+	}
+	result = collect(avlroot.Left, result)
+	result = append(result, avlroot.Ticket)
+	result = collect(avlroot.Right, result)
+	return result
+}
@@ -0,0 +1,183 @@
+package dsa
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var benchSizes = []int{1000, 10000}
+
+// Builds a ticket log (sorted by TicketID) holding n random tickets, returning its root and the tickets.
+func ticketlogOf(n int) (*TicketNode, []Ticket) {
+	tickets := randomTickets(rand.New(rand.NewSource(int64(n))), n)
+	var root *TicketNode
+	for _, ticket := range tickets {
+		root = AVLinsert(&TicketNode{Ticket: ticket}, ByTicketID, root)
+	}
+	return root, tickets
+}
+
+// Pivots the whole ticket log into one tree per sortable field, as the re-sort view's passPreload did on every request before the tickets were indexed.
+func preloadPivots(root *TicketNode) map[string]*AVLtree {
+	pivots := make(map[string]*AVLtree, len(Sortfuncs))
+	for field, sortfunc := range Sortfuncs {
+		pivoted := NewAVLT(sortfunc)
+		pivoted.Root = AVLpivot(root, pivoted.Root, pivoted.Sortfunc)
+		pivots[field] = pivoted
+	}
+	return pivots
+}
+
+// Edits a ticket so that it moves within most indexes.
+func edited(rng *rand.Rand, ticket Ticket) Ticket {
+	ticket.Priority = rng.Intn(3)
+	ticket.Status = rng.Intn(3)
+	ticket.DueDate = ticket.DueDate.AddDate(0, 0, rng.Intn(5)-2)
+	ticket.Assignee = []string{"alice", "Bob", "carol", ""}[rng.Intn(4)]
+	return ticket
+}
+
+func TestIndexMatchesRebuild(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	root, tickets := ticketlogOf(400)
+	ti := BuildTicketindex(root)
+
+	// Maintain the index through edits and deletes, applying the same changes to the ticket log
+	for i := 0; i < 300; i++ {
+		k := rng.Intn(len(tickets))
+		ticket := tickets[k]
+		if rng.Intn(4) == 0 {
+			if ti.Delete(ticket.TicketID) {
+				root = AVLdelete(root, ticket.TicketID)
+			}
+			continue
+		}
+		if _, ok := ti.Get(ticket.TicketID); !ok {
+			continue
+		}
+		ticket = edited(rng, ticket)
+		tickets[k] = ticket
+		ti.Update(ticket)
+		AVLsearch(root, ticket.TicketID).Ticket = ticket
+	}
+
+	rebuilt := preloadPivots(root)
+	for field, tree := range rebuilt {
+		want := collect(tree.Root, nil)
+		got := ti.Sorted(field, false)
+		if len(got) != len(want) {
+			t.Fatalf("%s: index holds %d tickets, rebuild holds %d", field, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: position %d holds %+v, rebuild has %+v", field, i, got[i], want[i])
+				break
+			}
+		}
+	}
+}
+
+// The per-request cost of the re-sort view before indexing: every field pivoted from the ticket log, then one read.
+func BenchmarkResortRebuild(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			root, _ := ticketlogOf(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pivots := preloadPivots(root)
+				collect(pivots["Priority"].Root, nil)
+			}
+		})
+	}
+}
+
+// The per-request cost of the re-sort view reading a whole ordering from the index.
+func BenchmarkResortIndexed(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			root, _ := ticketlogOf(n)
+			ti := BuildTicketindex(root)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ti.Sorted("Priority", false)
+			}
+		})
+	}
+}
+
+// The per-request cost of the re-sort view reading one page of an ordering from the index.
+func BenchmarkResortIndexedPage(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			root, _ := ticketlogOf(n)
+			ti := BuildTicketindex(root)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ti.SortedRange("Priority", false, n/2, 25)
+			}
+		})
+	}
+}
+
+// The per-request cost of the main menu before indexing: the user's tickets and assignments filtered out of the whole ticket log.
+func BenchmarkMyTicketsRebuild(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			root, _ := ticketlogOf(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				collect(Mytickets(root, nil, ByTicketID, "alice"), nil)
+				collect(Myassigns(root, nil, ByTicketID, "alice"), nil)
+			}
+		})
+	}
+}
+
+// The per-request cost of the main menu reading the user's tickets and assignments from the index.
+func BenchmarkMyTicketsIndexed(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			root, _ := ticketlogOf(n)
+			ti := BuildTicketindex(root)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ti.Created("alice")
+				ti.Assigned("alice")
+			}
+		})
+	}
+}
+
+// The cost indexing adds to each edit: the ticket moved within every index it changes position in.
+func BenchmarkIndexUpdate(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(4))
+			root, tickets := ticketlogOf(n)
+			ti := BuildTicketindex(root)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ti.Update(edited(rng, tickets[rng.Intn(n)]))
+			}
+		})
+	}
+}
+
+// The cost indexing adds to each approval and delete: a ticket added to and removed from every index.
+func BenchmarkIndexInsertDelete(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("tickets=%d", n), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(5))
+			root, tickets := ticketlogOf(n)
+			ti := BuildTicketindex(root)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ticket := tickets[rng.Intn(n)]
+				ticket.TicketID = int64(n + i)
+				ti.Insert(ticket)
+				ti.Delete(ticket.TicketID)
+			}
+		})
+	}
+}
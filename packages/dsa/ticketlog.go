@@ -0,0 +1,97 @@
+package dsa
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Ticketlog is the log of approved tickets: an AVL tree sorted by TicketID, written copy-on-write.
+// Each write builds a new version of the tree with AVLinsertCopy, AVLdeleteCopy or AVLreplaceCopy, and publishes its root through an atomic pointer; the nodes of a published tree are never modified again.
+// Readers take a Snapshot, which they may walk for as long as they like without locking, and which stays consistent while later writes go on. Writers are serialized via the inclusion of a Mutex.
+// The log also keeps the Ticketindex over its tickets, which it updates as part of each write. The log is authoritative: the index is only ever written by the log, in the same order, and readers of the index are held off while a write publishes its root, so that anyone who has seen a version of the tree through Snapshot finds the index updated to match.
+type Ticketlog struct {
+	mu    sync.Mutex
+	root  atomic.Pointer[TicketNode]
+	index *Ticketindex
+}
+
+// NewTicketlog creates a Ticketlog holding the tree at a given root node (which may be nil), and returns its pointer.
+// The tree is treated as immutable from then on, so it must not be modified by anything else.
+func NewTicketlog(avlroot *TicketNode) *Ticketlog {
+	tl := &Ticketlog{index: BuildTicketindex(avlroot)}
+	tl.root.Store(avlroot)
+	return tl
+}
+
+// Index returns the secondary indexes over the log's tickets. They are kept up to date by Insert, Update and Delete, and must not be written to by anything else.
+func (tl *Ticketlog) Index() *Ticketindex {
+	return tl.index
+}
+
+// Snapshot returns the root of the current version of the tree. The tree must not be modified.
+func (tl *Ticketlog) Snapshot() *TicketNode {
+	return tl.root.Load()
+}
+
+// Len returns the number of tickets in the current version of the tree.
+func (tl *Ticketlog) Len() int {
+	return AVLsize(tl.Snapshot())
+}
+
+// Get returns the ticket with a given TicketID.
+func (tl *Ticketlog) Get(ticketID int64) (Ticket, bool) {
+	if node := AVLsearch(tl.Snapshot(), ticketID); node != nil {
+		return node.Ticket, true
+	}
+	return Ticket{}, false
+}
+
+// Insert publishes a version of the tree with a ticket added.
+func (tl *Ticketlog) Insert(ticket Ticket) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.publish(AVLinsertCopy(&TicketNode{Ticket: ticket}, ByTicketID, tl.root.Load()), func(ti *Ticketindex) {
+		ti.put(ticket)
+	})
+}
+
+// Update publishes a version of the tree in which the ticket with a given TicketID has been changed by edit, which must not change the TicketID.
+// Returns the edited ticket, or false if no such ticket exists.
+func (tl *Ticketlog) Update(ticketID int64, edit func(ticket *Ticket)) (Ticket, bool) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	node := AVLsearch(tl.root.Load(), ticketID)
+	if node == nil {
+		return Ticket{}, false
+	}
+	ticket := node.Ticket
+	edit(&ticket)
+	ticket.TicketID = ticketID
+	tl.publish(AVLreplaceCopy(tl.root.Load(), ticket), func(ti *Ticketindex) {
+		ti.put(ticket)
+	})
+	return ticket, true
+}
+
+// Delete publishes a version of the tree with the ticket with a given TicketID removed. Returns false if no such ticket exists.
+func (tl *Ticketlog) Delete(ticketID int64) bool {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if AVLsearch(tl.root.Load(), ticketID) == nil {
+		return false
+	}
+	tl.publish(AVLdeleteCopy(tl.root.Load(), ticketID), func(ti *Ticketindex) {
+		ti.remove(ticketID)
+	})
+	return true
+}
+
+// Utility functions
+
+// Publishes a new version of the tree along with the change reindex makes to the index, holding the index's lock across both. Assumes the log's lock is held.
+func (tl *Ticketlog) publish(avlroot *TicketNode, reindex func(ti *Ticketindex)) {
+	tl.index.mu.Lock()
+	defer tl.index.mu.Unlock()
+	tl.root.Store(avlroot)
+	reindex(tl.index)
+}
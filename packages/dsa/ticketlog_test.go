@@ -0,0 +1,106 @@
+package dsa
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Checks that a log's index holds exactly the tickets of its current snapshot, in every indexed order.
+func checkIndexMatchesLog(t *testing.T, tl *Ticketlog) {
+	t.Helper()
+	rebuilt := BuildTicketindex(tl.Snapshot())
+	for field := range Sortfuncs {
+		want := rebuilt.Sorted(field, false)
+		got := tl.Index().Sorted(field, false)
+		if len(got) != len(want) {
+			t.Fatalf("%s: index holds %d tickets, ticket log holds %d", field, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: index holds %+v at position %d, ticket log has %+v", field, got[i], i, want[i])
+			}
+		}
+	}
+	for _, user := range []string{"alice", "Bob", "carol", "", "ALICE"} {
+		if got, want := tl.Index().Assigned(user), rebuilt.Assigned(user); len(got) != len(want) {
+			t.Fatalf("index holds %d tickets assigned to %q, ticket log holds %d", len(got), user, len(want))
+		}
+	}
+}
+
+func TestTicketlogConcurrentUpdatesKeepIndex(t *testing.T) {
+	root, _ := ticketlogOf(50)
+	tl := NewTicketlog(root)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 500; i++ {
+				// Every writer edits the same ticket, so that index updates from different writers race on it
+				tl.Update(7, func(ticket *Ticket) {
+					*ticket = edited(rng, *ticket)
+				})
+			}
+		}(w)
+	}
+	wg.Wait()
+	checkIndexMatchesLog(t, tl)
+}
+
+func TestTicketlogConcurrentWritesKeepIndex(t *testing.T) {
+	root, tickets := ticketlogOf(200)
+	tl := NewTicketlog(root)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 300; i++ {
+				ticket := tickets[rng.Intn(len(tickets))]
+				switch rng.Intn(3) {
+				case 0:
+					tl.Delete(ticket.TicketID)
+				case 1:
+					// Approved submissions are given fresh TicketIDs
+					ticket.TicketID = int64(len(tickets) + w*1000 + i)
+					tl.Insert(edited(rng, ticket))
+				default:
+					tl.Update(ticket.TicketID, func(ticket *Ticket) {
+						*ticket = edited(rng, *ticket)
+					})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	checkIndexMatchesLog(t, tl)
+}
+
+func TestTicketlogIndexNotBehindSnapshot(t *testing.T) {
+	tl := NewTicketlog(nil)
+	tl.Insert(Ticket{TicketID: 1})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 5000; i++ {
+			tl.Update(1, func(ticket *Ticket) { ticket.EstHours = i })
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// Whatever version of the ticket a reader has seen in the log, the index holds that version or a later one
+		seen, _ := tl.Get(1)
+		indexed, _ := tl.Index().Get(1)
+		if indexed.EstHours < seen.EstHours {
+			t.Fatalf("index holds version %d of the ticket after the log published version %d", indexed.EstHours, seen.EstHours)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package dsa
+
+import (
+	"iter"
+)
+
+// avlnode is implemented by the node types of each AVL tree in this package, so that they all share the one implementation of the AVL algorithms below.
+// Node methods are called on nil nodes only where noted.
+type avlnode[N any] interface {
+	comparable
+	left() N
+	right() N
+	setLeft(N)
+	setRight(N)
+	dims() (height, size int) // Safe to call on a nil node, which has height and size 0
+	setDims(height, size int)
+	copyFrom(N)   // Replaces the node's payload (but not its links) with another node's
+	duplicate() N // Returns a copy of the node, sharing its children
+}
+
+// AVLTree is a generic ordered map, kept balanced as an AVL tree and ordered by a comparator over its keys.
+// Every node records the size of its subtree, so lookups by rank are O(log n) as well as lookups by key.
+type AVLTree[K, V any] struct {
+	root    *treeNode[K, V]
+	compare func(a, b K) int
+}
+
+// NewAVLTree creates an empty AVLTree ordered by compare, which returns a negative number if a sorts before b, zero if they are equal, and a positive number if a sorts after b.
+func NewAVLTree[K, V any](compare func(a, b K) int) *AVLTree[K, V] {
+	return &AVLTree[K, V]{compare: compare}
+}
+
+// Len returns the number of keys in the tree. Runs in O(1).
+func (t *AVLTree[K, V]) Len() int {
+	_, size := t.root.dims()
+	return size
+}
+
+// Get returns the value stored under a key, if any.
+func (t *AVLTree[K, V]) Get(key K) (V, bool) {
+	if node := t.find(key); node != nil {
+		return node.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Put stores a value under a key, replacing the value already stored under it, if any.
+func (t *AVLTree[K, V]) Put(key K, value V) {
+	if node := t.find(key); node != nil {
+		node.value = value
+		return
+	}
+	t.root = avlInsert(&treeNode[K, V]{key: key, value: value}, t.less, t.root, inplace[*treeNode[K, V]])
+}
+
+// Delete removes a key and its value from the tree. Returns false if the key is not in the tree.
+func (t *AVLTree[K, V]) Delete(key K) bool {
+	if t.find(key) == nil {
+		return false
+	}
+	t.root = avlDelete(t.root, &treeNode[K, V]{key: key}, t.less, inplace[*treeNode[K, V]])
+	return true
+}
+
+// Min returns the smallest key in the tree and its value. Returns false if the tree is empty.
+func (t *AVLTree[K, V]) Min() (K, V, bool) {
+	return t.Select(0)
+}
+
+// Max returns the largest key in the tree and its value. Returns false if the tree is empty.
+func (t *AVLTree[K, V]) Max() (K, V, bool) {
+	return t.Select(t.Len() - 1)
+}
+
+// Select returns the key at a given rank (counting from 0) and its value. Returns false if the rank is out of range.
+func (t *AVLTree[K, V]) Select(rank int) (K, V, bool) {
+	if node := avlSelect(t.root, rank); node != nil {
+		return node.key, node.value, true
+	}
+	var key K
+	var value V
+	return key, value, false
+}
+
+// Rank returns the number of keys in the tree which sort before a given key.
+func (t *AVLTree[K, V]) Rank(key K) int {
+	return avlRank(t.root, &treeNode[K, V]{key: key}, t.less)
+}
+
+// All iterates over every key in the tree and its value, in order.
+func (t *AVLTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		avlAscend(t.root, 0, func(node *treeNode[K, V]) bool {
+			return yield(node.key, node.value)
+		})
+	}
+}
+
+// Range iterates, in order, over the keys from (inclusive) to (exclusive) another key, and their values.
+// Subtrees wholly before the first key are skipped, so starting the iteration costs O(log n).
+func (t *AVLTree[K, V]) Range(from, to K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		avlAscend(t.root, t.Rank(from), func(node *treeNode[K, V]) bool {
+			return t.compare(node.key, to) < 0 && yield(node.key, node.value)
+		})
+	}
+}
+
+// Clone returns a copy of the tree. Keys and values are copied by assignment.
+func (t *AVLTree[K, V]) Clone() *AVLTree[K, V] {
+	return &AVLTree[K, V]{root: t.root.clone(), compare: t.compare}
+}
+
+// Utility functions
+
+// treeNode is the node type of AVLTree.
+type treeNode[K, V any] struct {
+	key          K
+	value        V
+	height, size int
+	l, r         *treeNode[K, V]
+}
+
+func (n *treeNode[K, V]) left() *treeNode[K, V]          { return n.l }
+func (n *treeNode[K, V]) right() *treeNode[K, V]         { return n.r }
+func (n *treeNode[K, V]) setLeft(child *treeNode[K, V])  { n.l = child }
+func (n *treeNode[K, V]) setRight(child *treeNode[K, V]) { n.r = child }
+func (n *treeNode[K, V]) setDims(height, size int)       { n.height, n.size = height, size }
+func (n *treeNode[K, V]) copyFrom(other *treeNode[K, V]) { n.key, n.value = other.key, other.value }
+
+func (n *treeNode[K, V]) duplicate() *treeNode[K, V] {
+	copied := *n
+	return &copied
+}
+
+func (n *treeNode[K, V]) dims() (int, int) {
+	if n == nil {
+		return 0, 0
+	}
+	return n.height, n.size
+}
+
+// Copies the subtree rooted at a node.
+func (n *treeNode[K, V]) clone() *treeNode[K, V] {
+	if n == nil {
+		return nil
+	}
+	copied := *n
+	copied.l = n.l.clone()
+	copied.r = n.r.clone()
+	return &copied
+}
+
+func (t *AVLTree[K, V]) less(a, b *treeNode[K, V]) bool {
+	return t.compare(a.key, b.key) < 0
+}
+
+func (t *AVLTree[K, V]) find(key K) *treeNode[K, V] {
+	return avlFind(t.root, &treeNode[K, V]{key: key}, t.less)
+}
+
+// AVL algorithms shared by every tree in this package. Trees are ordered by less, which reports whether one node sorts before another.
+// Algorithms which modify a tree take an own function, called on each existing node before it is modified:
+// inplace modifies the tree's nodes directly, whereas pathcopy modifies copies of them, leaving the original tree intact (see AVLinsertCopy).
+
+// Returns the node itself, so that the tree is modified in place.
+func inplace[N any](node N) N {
+	return node
+}
+
+// Returns a copy of the node, so that the tree it belongs to is left unmodified.
+func pathcopy[N avlnode[N]](node N) N {
+	return node.duplicate()
+}
+
+// Inserts a node into a subtree, does required rotations. Returns new root of the subtree.
+func avlInsert[N avlnode[N]](newnode N, less func(a, b N) bool, subtree N, own func(N) N) N {
+	var null N
+	// BST Insertion
+	if subtree == null {
+		newnode.setLeft(null)
+		newnode.setRight(null)
+		newnode.setDims(1, 1)
+		return newnode
+	}
+
+	subtree = own(subtree)
+	if less(newnode, subtree) {
+		subtree.setLeft(avlInsert(newnode, less, subtree.left(), own))
+	} else {
+		subtree.setRight(avlInsert(newnode, less, subtree.right(), own))
+	}
+	return rebalance(subtree, own)
+}
+
+// Deletes the node equal to a target (i.e. neither sorts before the other) from a subtree, does required rotations. Returns new root of the subtree.
+func avlDelete[N avlnode[N]](subtree, target N, less func(a, b N) bool, own func(N) N) N {
+	var null N
+	if subtree == null {
+		return subtree
+	}
+
+	// Does root node contain key to be deleted? If not,
+	// Does key to be deleted lie to the left or right subtree?
+	if less(target, subtree) {
+		subtree = own(subtree)
+		subtree.setLeft(avlDelete(subtree.left(), target, less, own))
+	} else if less(subtree, target) {
+		subtree = own(subtree)
+		subtree.setRight(avlDelete(subtree.right(), target, less, own))
+	} else if subtree.left() == null { // Node with one subtree or less; replace it with that subtree
+		return subtree.right()
+	} else if subtree.right() == null {
+		return subtree.left()
+	} else {
+		// Node with two subtrees (get inorder successor, smallest in right subtree)
+		successor := subtree.right()
+		for successor.left() != null {
+			successor = successor.left()
+		}
+
+		// Copy inorder successor's data to this node, then delete inorder successor
+		subtree = own(subtree)
+		subtree.copyFrom(successor)
+		subtree.setRight(avlDelete(subtree.right(), successor, less, own))
+	}
+	return rebalance(subtree, own)
+}
+
+// Replaces the payload of the node equal to a target with the target's. Returns new root of the subtree.
+// The target must sort exactly where the node it replaces does, so no rotations are needed.
+func avlReplace[N avlnode[N]](subtree, target N, less func(a, b N) bool, own func(N) N) N {
+	var null N
+	if subtree == null {
+		return subtree
+	}
+
+	subtree = own(subtree)
+	if less(target, subtree) {
+		subtree.setLeft(avlReplace(subtree.left(), target, less, own))
+	} else if less(subtree, target) {
+		subtree.setRight(avlReplace(subtree.right(), target, less, own))
+	} else {
+		subtree.copyFrom(target)
+	}
+	return subtree
+}
+
+// Returns the node in a subtree equal to a target, or the zero (nil) node if there is none.
+func avlFind[N avlnode[N]](subtree, target N, less func(a, b N) bool) N {
+	var null N
+	for subtree != null {
+		if less(target, subtree) {
+			subtree = subtree.left()
+		} else if less(subtree, target) {
+			subtree = subtree.right()
+		} else {
+			return subtree
+		}
+	}
+	return null
+}
+
+// Returns the node at a given rank (counting from 0) in a subtree, or the zero (nil) node if the rank is out of range.
+func avlSelect[N avlnode[N]](subtree N, rank int) N {
+	var null N
+	for subtree != null {
+		_, leftsize := subtree.left().dims()
+		if rank < leftsize {
+			subtree = subtree.left()
+		} else if rank > leftsize {
+			rank -= leftsize + 1
+			subtree = subtree.right()
+		} else {
+			return subtree
+		}
+	}
+	return null
+}
+
+// Returns the number of nodes in a subtree which sort before a target.
+func avlRank[N avlnode[N]](subtree, target N, less func(a, b N) bool) int {
+	var null N
+	rank := 0
+	for subtree != null {
+		if less(subtree, target) {
+			_, leftsize := subtree.left().dims()
+			rank += leftsize + 1
+			subtree = subtree.right()
+		} else {
+			subtree = subtree.left()
+		}
+	}
+	return rank
+}
+
+// Visits the nodes of a subtree in order, starting from a given rank (counting from 0), until visit returns false.
+// Subtrees lying wholly before the starting rank are skipped using their sizes. Returns false if the visit was stopped early.
+func avlAscend[N avlnode[N]](subtree N, from int, visit func(N) bool) bool {
+	var null N
+	if subtree == null {
+		return true
+	}
+	_, leftsize := subtree.left().dims()
+	if from < leftsize && !avlAscend(subtree.left(), from, visit) {
+		return false
+	}
+	if from <= leftsize && !visit(subtree) {
+		return false
+	}
+	return avlAscend(subtree.right(), from-leftsize-1, visit)
+}
+
+// Recomputes the height and size of a node from those of its children.
+func resize[N avlnode[N]](node N) {
+	lheight, lsize := node.left().dims()
+	rheight, rsize := node.right().dims()
+	node.setDims(1+max(lheight, rheight), 1+lsize+rsize)
+}
+
+// Calculate balance factor for the root of a given subtree
+func balance[N avlnode[N]](subtree N) int {
+	var null N
+	if subtree == null {
+		return 0
+	}
+	lheight, _ := subtree.left().dims()
+	rheight, _ := subtree.right().dims()
+	return lheight - rheight
+}
+
+// Updates the height and size of a node whose children have changed, then does required rotations. Returns new root of the subtree.
+// Assumes the node itself has already been passed to own.
+func rebalance[N avlnode[N]](subtree N, own func(N) N) N {
+	resize(subtree)
+	bf := balance(subtree)
+
+	// Left Left, or Left Right
+	if bf > 1 {
+		if balance(subtree.left()) < 0 {
+			subtree.setLeft(leftrotate(own(subtree.left()), own))
+		}
+		return rightrotate(subtree, own)
+	}
+
+	// Right Right, or Right Left
+	if bf < -1 {
+		if balance(subtree.right()) > 0 {
+			subtree.setRight(rightrotate(own(subtree.right()), own))
+		}
+		return leftrotate(subtree, own)
+	}
+
+	// No change needed because balanced
+	return subtree
+}
+
+// Rotates subtree at a given root right. Assumes the root has already been passed to own.
+func rightrotate[N avlnode[N]](subtree N, own func(N) N) N {
+	leftsub := own(subtree.left())
+	orphan := leftsub.right()
+
+	leftsub.setRight(subtree)
+	subtree.setLeft(orphan)
+
+	resize(subtree)
+	resize(leftsub)
+
+	return leftsub
+}
+
+// Rotates subtree at a given root left. Assumes the root has already been passed to own.
+func leftrotate[N avlnode[N]](subtree N, own func(N) N) N {
+	rightsub := own(subtree.right())
+	orphan := rightsub.left()
+
+	rightsub.setLeft(subtree)
+	subtree.setRight(orphan)
+
+	resize(subtree)
+	resize(rightsub)
+
+	return rightsub
+}
@@ -0,0 +1,218 @@
+package dsa
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Checks the AVL height and balance, and the recorded subtree sizes, of every node in a tree, and that its keys are in order. Returns the tree's height and size.
+func checkTree[K, V any](t *testing.T, tree *AVLTree[K, V], node *treeNode[K, V]) (int, int) {
+	t.Helper()
+	if node == nil {
+		return 0, 0
+	}
+	if node.l != nil && tree.compare(node.l.key, node.key) >= 0 {
+		t.Fatalf("key %v is left of key %v", node.l.key, node.key)
+	}
+	if node.r != nil && tree.compare(node.r.key, node.key) <= 0 {
+		t.Fatalf("key %v is right of key %v", node.r.key, node.key)
+	}
+	lheight, lsize := checkTree(t, tree, node.l)
+	rheight, rsize := checkTree(t, tree, node.r)
+	if lheight-rheight > 1 || rheight-lheight > 1 {
+		t.Fatalf("node %v is out of balance: left height %d, right height %d", node.key, lheight, rheight)
+	}
+	if height := 1 + max(lheight, rheight); node.height != height {
+		t.Fatalf("node %v records height %d, want %d", node.key, node.height, height)
+	}
+	if size := 1 + lsize + rsize; node.size != size {
+		t.Fatalf("node %v records size %d, want %d", node.key, node.size, size)
+	}
+	return node.height, node.size
+}
+
+// A sorted slice of keys with their values, against which a tree is checked.
+type treeModel struct {
+	keys   []int
+	values []string
+}
+
+func (m *treeModel) put(key int, value string) {
+	i, found := slices.BinarySearch(m.keys, key)
+	if found {
+		m.values[i] = value
+		return
+	}
+	m.keys = slices.Insert(m.keys, i, key)
+	m.values = slices.Insert(m.values, i, value)
+}
+
+func (m *treeModel) delete(key int) bool {
+	i, found := slices.BinarySearch(m.keys, key)
+	if found {
+		m.keys = slices.Delete(m.keys, i, i+1)
+		m.values = slices.Delete(m.values, i, i+1)
+	}
+	return found
+}
+
+// Checks every read operation of a tree against the model.
+func checkAgainstModel(t *testing.T, tree *AVLTree[int, string], model *treeModel, rng *rand.Rand) {
+	t.Helper()
+	if _, size := checkTree(t, tree, tree.root); size != len(model.keys) || tree.Len() != size {
+		t.Fatalf("Len = %d and root size %d, want %d", tree.Len(), size, len(model.keys))
+	}
+
+	i := 0
+	for key, value := range tree.All() {
+		if i >= len(model.keys) || key != model.keys[i] || value != model.values[i] {
+			t.Fatalf("All yielded %d: %q at position %d, want the model's %v", key, value, i, model.keys)
+		}
+		i++
+	}
+
+	minKey, _, ok := tree.Min()
+	maxKey, _, _ := tree.Max()
+	if ok != (len(model.keys) > 0) || (ok && (minKey != model.keys[0] || maxKey != model.keys[len(model.keys)-1])) {
+		t.Fatalf("Min, Max = %d, %d (%v), want the ends of %v", minKey, maxKey, ok, model.keys)
+	}
+
+	for rank := -1; rank <= len(model.keys); rank++ {
+		key, value, ok := tree.Select(rank)
+		if inRange := rank >= 0 && rank < len(model.keys); ok != inRange || (ok && (key != model.keys[rank] || value != model.values[rank])) {
+			t.Fatalf("Select(%d) = %d, %q, %v", rank, key, value, ok)
+		}
+	}
+
+	for probe := 0; probe < 10; probe++ {
+		key := rng.Intn(120) - 10
+		want, found := slices.BinarySearch(model.keys, key)
+		if rank := tree.Rank(key); rank != want {
+			t.Fatalf("Rank(%d) = %d, want %d", key, rank, want)
+		}
+		if value, ok := tree.Get(key); ok != found || (found && value != model.values[want]) {
+			t.Fatalf("Get(%d) = %q, %v", key, value, ok)
+		}
+
+		// Range includes its first key and excludes its last
+		to := key + rng.Intn(30)
+		end, _ := slices.BinarySearch(model.keys, to)
+		var got []int
+		for key := range tree.Range(key, to) {
+			got = append(got, key)
+		}
+		if wantKeys := model.keys[want:end]; !slices.Equal(got, wantKeys) {
+			t.Fatalf("Range(%d, %d) = %v, want %v", key, to, got, wantKeys)
+		}
+	}
+}
+
+func TestAVLTreeRandomOperations(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		tree := NewAVLTree[int, string](cmp.Compare[int])
+		model := &treeModel{}
+		for step := 0; step < 400; step++ {
+			key := rng.Intn(100)
+			if rng.Intn(3) == 0 {
+				if deleted := tree.Delete(key); deleted != model.delete(key) {
+					t.Fatalf("seed %d step %d: Delete(%d) = %v", seed, step, key, deleted)
+				}
+			} else {
+				value := string(rune('a' + rng.Intn(26)))
+				tree.Put(key, value)
+				model.put(key, value)
+			}
+			checkAgainstModel(t, tree, model, rng)
+		}
+	}
+}
+
+func TestAVLTreeDelete(t *testing.T) {
+	// Builds the tree
+	//        4
+	//      /   \
+	//     2     6
+	//    / \   / \
+	//   1   3 5   7
+	//              \
+	//               8
+	build := func() *AVLTree[int, string] {
+		tree := NewAVLTree[int, string](cmp.Compare[int])
+		for _, key := range []int{4, 2, 6, 1, 3, 5, 7, 8} {
+			tree.Put(key, "v")
+		}
+		return tree
+	}
+	tests := []struct {
+		name string
+		key  int
+	}{
+		{"leaf", 1},
+		{"one child", 7},
+		{"two children", 6},
+		{"root", 4},
+	}
+	for _, test := range tests {
+		tree := build()
+		if !tree.Delete(test.key) {
+			t.Fatalf("%s: Delete(%d) = false", test.name, test.key)
+		}
+		if tree.Delete(test.key) {
+			t.Errorf("%s: second Delete(%d) = true", test.name, test.key)
+		}
+		checkTree(t, tree, tree.root)
+		var keys []int
+		for key := range tree.All() {
+			keys = append(keys, key)
+		}
+		want := slices.DeleteFunc([]int{1, 2, 3, 4, 5, 6, 7, 8}, func(key int) bool { return key == test.key })
+		if !slices.Equal(keys, want) {
+			t.Errorf("%s: keys after Delete(%d) = %v, want %v", test.name, test.key, keys, want)
+		}
+	}
+}
+
+func TestAVLTreePutOverwrites(t *testing.T) {
+	tree := NewAVLTree[string, int](cmp.Compare[string])
+	tree.Put("b", 1)
+	tree.Put("a", 2)
+	tree.Put("b", 3)
+	if tree.Len() != 2 {
+		t.Errorf("Len = %d after overwriting a key, want 2", tree.Len())
+	}
+	if value, _ := tree.Get("b"); value != 3 {
+		t.Errorf("Get(b) = %d, want the overwritten value 3", value)
+	}
+}
+
+func TestAVLTreeClone(t *testing.T) {
+	tree := NewAVLTree[int, string](cmp.Compare[int])
+	for key := 0; key < 50; key++ {
+		tree.Put(key, "original")
+	}
+	clone := tree.Clone()
+	for key := 0; key < 50; key += 2 {
+		tree.Delete(key)
+	}
+	tree.Put(1, "changed")
+	tree.Put(100, "added")
+
+	if clone.Len() != 50 {
+		t.Errorf("clone Len = %d, want 50", clone.Len())
+	}
+	for key, value := range clone.All() {
+		if value != "original" || key >= 50 {
+			t.Fatalf("clone holds %d: %q after the original was changed", key, value)
+		}
+	}
+	checkTree(t, clone, clone.root)
+	checkTree(t, tree, tree.root)
+
+	clone.Put(3, "changed in clone")
+	if value, _ := tree.Get(3); value != "original" {
+		t.Errorf("original holds %q after the clone was changed", value)
+	}
+}
@@ -1,157 +1,193 @@
 package dsa
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"hash/maphash"
+	"strings"
 )
 
 const (
-	Hashbuckets = 50 // Length of index array in hash table
+	Hashbuckets = 64 // Initial length of index array in hash table; grows as users are added
 )
 
-// UserNode specifies a SLL node in the Userlog hash table.
+// Seeds the hash of usernames. Chosen at random each time the application starts, so that which usernames collide cannot be predicted.
+var userseed = maphash.MakeSeed()
+
+// Notification preferences, combined as bit flags in User.Notify.
+const (
+	NotifyAssigned = 1 << iota // Email when assigned a ticket
+	NotifyApproval             // Email when a submission is approved or rejected
+	NotifyDue                  // Email when a ticket is due soon or overdue
+
+	NotifyAll = NotifyAssigned | NotifyApproval | NotifyDue
+)
+
+// Userlog is the hash table of user accounts, keyed by username.
+type Userlog = HashMap[string, User]
+
+// UserNode wraps a User looked up from the Userlog, and is passed to the print functions taken by PrintHT.
 type UserNode struct {
 	User User
-	next *UserNode
 }
 
-// User struct logs fields for managing login user/admin accounts.
+// User struct logs fields for managing login user accounts.
 type User struct {
-	Name  string
-	Pw    []byte
-	Admin bool
+	Name   string
+	Pw     []byte
+	Role   Role // Determines what the user may do, see Role.Can
+	Email  string
+	Notify int   // Notification preferences, see NotifyAssigned etc.
+	Home   int64 // ID of the saved filter shown on the main menu; 0 for none
+
+	// Second factor
+	TOTP       string   // TOTP secret, sealed with the application's key; blank if not enrolled
+	TOTPStep   int64    // Time step of the last code accepted, so that no code is accepted twice
+	Recovery   []string // Hashes of the unused one-time recovery codes
+	Require2FA bool     // Set by an admin: the user must enroll a second factor to log in
+
+	// Inbound email
+	MailKey string // Random key carried by the user's personal inbound addresses (e.g. saucer+KEY@...); mail is only attributed to the user if sent to one
+}
+
+// Enrolled reports whether a user has a second factor.
+func (user User) Enrolled() bool {
+	return user.TOTP != ""
 }
 
 // EmptyUser is a placeholder variable for functions to return a nil result.
 var EmptyUser = User{
-	Name:  "",
-	Pw:    []byte{},
-	Admin: false,
+	Name:   "",
+	Pw:     []byte{},
+	Role:   "",
+	Email:  "",
+	Notify: 0,
+}
+
+// Can reports whether a user's role grants a given permission.
+func (user User) Can(permission Permission) bool {
+	return user.Role.Can(permission)
+}
+
+// Wants reports whether a user has opted in to a given kind of notification.
+func (user User) Wants(notification int) bool {
+	return user.Email != "" && user.Notify&notification != 0
 }
 
 // Hash table operations
 
 // NewHT initializes the hash table.
-func NewHT() *[]*UserNode {
-	var Userlog = make([]*UserNode, Hashbuckets)
-	return &Userlog
+func NewHT() *Userlog {
+	return NewHashMap[string, User](Hashbuckets, hash)
 }
 
-// PrintHT returns a slice of slices of strings to be passed into the relevant HTML template for printing in the client. Reflects all users currently recorded in hash table.
-func PrintHT(hashtable *[]*UserNode, printfunc func(SLL *UserNode) []string) [][]string {
-	empty := true
+// PrintHT returns a slice of slices of strings to be passed into the relevant HTML template for printing in the client. Reflects all users currently recorded in hash table, one user per slice.
+func PrintHT(hashtable *Userlog, printfunc func(SLL *UserNode) []string) [][]string {
 	str := [][]string{}
-	for i := 0; i < Hashbuckets; i++ {
-		if (*hashtable)[i] != nil {
-			empty = false
-			if ls := printfunc((*hashtable)[i]); len(ls) > 0 {
-				str = append(str, ls)
-			}
+	for _, user := range hashtable.All() {
+		if ls := printfunc(&UserNode{user}); len(ls) > 0 {
+			str = append(str, ls)
 		}
 	}
 
-	if empty {
+	if hashtable.Len() == 0 {
 		fmt.Println("No logged users!")
 	}
 	return str
 }
 
-// AddUser adds UserNode to SLL (hash bucket). Appends to front of the SLL for O(1) addition.
-func AddUser(hashtable *[]*UserNode, newuser User) {
-	hashindex := hash(newuser.Name)
-	hashbucket := (*hashtable)[hashindex]
-
-	if hashbucket == nil {
-		(*hashtable)[hashindex] = &UserNode{newuser, nil}
-	} else {
-		newnode := &UserNode{newuser, hashbucket}
-		(*hashtable)[hashindex] = newnode
+// AddUser adds a user to the hash table, keyed by username.
+// A user without a mail key is given a new one.
+func AddUser(hashtable *Userlog, newuser User) {
+	if newuser.MailKey == "" {
+		newuser.MailKey = NewMailKey()
 	}
+	hashtable.Put(newuser.Name, newuser)
 }
 
 // EditUser modifies an existing user.
-func EditUser(hashtable *[]*UserNode, retrieved, edited User) {
-	DeleteUser(hashtable, retrieved.Name)
+// The edited user is added before the old username is removed, so that the user is never missing from the hash table.
+func EditUser(hashtable *Userlog, retrieved, edited User) {
 	AddUser(hashtable, edited)
+	if retrieved.Name != edited.Name {
+		DeleteUser(hashtable, retrieved.Name)
+	}
 }
 
-// DeleteUser deletes UserNode with corresponding username from SLL(hash bucket). Assumes username is already verified to exist.
-func DeleteUser(hashtable *[]*UserNode, username string) {
-	hashindex := hash(username)
-
-	var prev *UserNode
-	for ptr := (*hashtable)[hashindex]; ptr != nil; ptr = ptr.next {
-		if ptr.User.Name == username {
-			if ptr == (*hashtable)[hashindex] { // If first node of SLL
-				(*hashtable)[hashindex] = nil
-			} else {
-				prev.next = ptr.next
-			}
+// UpdateUser edits the user with a given username in place (see HashMap.Update), so that changes made to the user since it was looked up are kept.
+// The username cannot be changed this way; use EditUser to rename a user. Returns the user as stored afterwards, and false if the user does not exist or edit returned false.
+func UpdateUser(hashtable *Userlog, username string, edit func(user *User) bool) (User, bool) {
+	return hashtable.Update(username, func(user *User) bool {
+		if !edit(user) {
+			return false
 		}
-		prev = ptr
+		user.Name = username
+		return true
+	})
+}
+
+// DeleteUser deletes the user with a given username from the hash table.
+func DeleteUser(hashtable *Userlog, username string) {
+	if hashtable.Delete(username) {
 		fmt.Println(username, "deleted from user log.")
 	}
 }
 
 // SearchUser looks up particular value from hash table: checks for presence of a particular username.
-func SearchUser(hashtable *[]*UserNode, username string) (bool, *UserNode) {
-	hashindex := hash(username)
+func SearchUser(hashtable *Userlog, username string) (bool, *UserNode) {
+	if user, ok := hashtable.Get(username); ok {
+		return true, &UserNode{user}
+	}
+	return false, nil
+}
 
-	for ptr := (*hashtable)[hashindex]; ptr != nil; ptr = ptr.next {
-		if ptr.User.Name == username {
-			return true, ptr
+// SearchEmail looks up the user with a particular email address (case-insensitive). Unlike SearchUser, requires a scan of the whole hash table.
+func SearchEmail(hashtable *Userlog, email string) (bool, *UserNode) {
+	if email == "" {
+		return false, nil
+	}
+	for _, user := range hashtable.All() {
+		if strings.EqualFold(user.Email, email) {
+			return true, &UserNode{user}
 		}
 	}
 	return false, nil
 }
 
+// NewMailKey returns a random key for a user's personal inbound email addresses. Lower-case hex, since the local parts of addresses are compared case-insensitively.
+func NewMailKey() string {
+	raw := make([]byte, 10)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
 // Utility Functions
 
-// Hash function will take username as input and will be of type string --> int.
+// Hash function will take username as input and will be of type string --> uint64; the hash table reduces it modulo its number of buckets.
 // Username will be used as search value while password will be checked for authentication.
-// Implements Paul Larson's simple hash function for strings:
-// https://stackoverflow.com/questions/98153/whats-the-best-hashing-algorithm-to-use-on-a-stl-string-when-using-hash-map/107657#107657
-
-func hash(user string) int {
-	hash := 0
-
-	for key := range user {
-		hash = hash*101 + int(user[key])
-	}
-
-	hash = hash % Hashbuckets
-
-	return hash
+// Uses the runtime's seeded string hash (as for Go maps), which is well-distributed and, being unsigned, cannot produce negative indices.
+func hash(user string) uint64 {
+	return maphash.String(userseed, user)
 }
 
-// PrintSLLnoadmin function taken as argument for PrintHT(); prints username of non-admin users only (for non-admin users to set ticket assignee)
-func PrintSLLnoadmin(SLL *UserNode) []string {
+// PrintSLLassignable function taken as argument for PrintHT(); prints username of users who may be assigned tickets only (for users to set ticket assignee)
+func PrintSLLassignable(SLL *UserNode) []string {
 	result := []string{}
-	if SLL == nil {
-	} else {
-		for ptr := SLL; ptr != nil; ptr = ptr.next {
-			if !ptr.User.Admin {
-				result = append(result, "Username: "+ptr.User.Name)
-				result = append(result, "------------------------------")
-			}
-		}
+	if SLL != nil && SLL.User.Can(WorkTickets) {
+		result = append(result, "Username: "+SLL.User.Name)
+		result = append(result, "------------------------------")
 	}
 	return result
 }
 
-// PrintSLLusername function taken as argument for PrintHT(); prints usernames of admin and non-admin users (login screen ref)
+// PrintSLLusername function taken as argument for PrintHT(); prints usernames and roles of all users (login screen ref)
 func PrintSLLusername(SLL *UserNode) []string {
 	result := []string{}
-	if SLL == nil {
-	} else {
-		for ptr := SLL; ptr != nil; ptr = ptr.next {
-			result = append(result, "Username: "+ptr.User.Name)
-			if ptr.User.Admin {
-				result = append(result, "Admin")
-			} else {
-				result = append(result, "Non-Admin")
-			}
-			result = append(result, "------------------------------")
-		}
+	if SLL != nil {
+		result = append(result, "Username: "+SLL.User.Name)
+		result = append(result, "Role: "+string(SLL.User.Role))
+		result = append(result, "------------------------------")
 	}
 	return result
 }
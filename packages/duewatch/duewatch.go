@@ -0,0 +1,204 @@
+// Implements a scheduler which watches ticket due dates, used to remind users of tickets falling due and to escalate tickets left overdue.
+// On every interval the scheduler scans the tickets it is given, flagging each as on track, due soon or overdue; an Alert is raised whenever a ticket moves into the due soon or overdue state, and whenever an overdue ticket is escalated.
+// Escalation is optional: when enabled, an overdue ticket is raised one priority level for every further EscalateAfter it remains overdue, until it reaches the highest priority.
+// The current time is read through a replaceable Now function, so a scan can be run deterministically against a fixed clock.
+// Schedulers are safe for concurrent use via the inclusion of a Mutex with each struct.
+package duewatch
+
+import (
+	"goInAction2/assignment/packages/dsa"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = time.Hour // Used by Run if no positive Interval is set
+)
+
+// State is the due date status of a ticket.
+type State int
+
+// States a ticket may be flagged with.
+const (
+	OnTrack State = iota
+	DueSoon
+	Overdue
+)
+
+// String returns the display name of a state.
+func (state State) String() string {
+	switch state {
+	case DueSoon:
+		return "due soon"
+	case Overdue:
+		return "overdue"
+	default:
+		return "on track"
+	}
+}
+
+// Alert is raised when a ticket becomes due soon or overdue, or is escalated.
+type Alert struct {
+	Ticket    dsa.Ticket // Ticket as it stood after any escalation
+	State     State
+	Escalated bool // True if the ticket's priority was raised by this scan
+	Previous  int  // Priority before escalation; equal to Ticket.Priority if not escalated
+}
+
+// Flag is the state recorded for a single ticket by the most recent scan.
+type Flag struct {
+	TicketID    int64
+	State       State
+	DueDate     time.Time
+	Escalations int // Number of times the ticket has been escalated while overdue
+}
+
+// Scheduler scans tickets on an interval and raises alerts about their due dates.
+type Scheduler struct {
+	Interval      time.Duration                           // Time between scans
+	DueSoon       time.Duration                           // Tickets due within this window are flagged due soon
+	EscalateAfter time.Duration                           // Overdue tickets are raised one priority level per EscalateAfter overdue; zero disables escalation
+	Now           func() time.Time                        // Clock used by scans; replaceable for deterministic scans
+	Tickets       func() []dsa.Ticket                     // Returns the tickets to scan
+	Escalate      func(ticketID int64, priority int) bool // Applies an escalated priority, returning false if the ticket no longer exists
+	Notify        func(alert Alert)                       // Optional; called with every alert raised
+
+	mu    sync.Mutex
+	flags map[int64]Flag
+	stop  chan struct{}
+}
+
+// New creates a Scheduler which scans the given tickets, and returns its pointer. Escalation is disabled until EscalateAfter and Escalate are set.
+func New(tickets func() []dsa.Ticket, interval, dueSoon time.Duration) *Scheduler {
+	return &Scheduler{
+		Interval: interval,
+		DueSoon:  dueSoon,
+		Now:      time.Now,
+		Tickets:  tickets,
+		flags:    make(map[int64]Flag),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Run scans immediately and then on every interval, until Stop is called.
+func (s *Scheduler) Run() {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.Scan()
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run after any scan in progress.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// Scan checks every ticket once against the clock, updating flags, applying escalations and returning the alerts raised.
+func (s *Scheduler) Scan() []Alert {
+	now := s.Now()
+	tickets := s.Tickets()
+	var alerts []Alert
+
+	s.mu.Lock()
+	seen := make(map[int64]bool, len(tickets))
+	for _, ticket := range tickets {
+		seen[ticket.TicketID] = true
+		previous, flagged := s.flags[ticket.TicketID]
+		flag := Flag{
+			TicketID: ticket.TicketID,
+			State:    s.stateOf(ticket, now),
+			DueDate:  ticket.DueDate,
+		}
+		if flagged && flag.State == Overdue && previous.State == Overdue {
+			flag.Escalations = previous.Escalations
+		}
+
+		alert := Alert{Ticket: ticket, State: flag.State, Previous: ticket.Priority}
+		raise := flag.State != OnTrack && (!flagged || previous.State != flag.State)
+		if flag.State == Overdue && s.EscalateAfter > 0 && s.Escalate != nil {
+			wanted := int(now.Sub(ticket.DueDate) / s.EscalateAfter)
+			if flag.Escalations < wanted && ticket.Priority > 0 {
+				if s.Escalate(ticket.TicketID, ticket.Priority-1) {
+					alert.Ticket.Priority--
+					alert.Escalated = true
+					raise = true
+				}
+				flag.Escalations = wanted
+			}
+		}
+		s.flags[ticket.TicketID] = flag
+		if raise {
+			alerts = append(alerts, alert)
+		}
+	}
+	// Forget tickets which have since been deleted
+	for ticketID := range s.flags {
+		if !seen[ticketID] {
+			delete(s.flags, ticketID)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.Notify != nil {
+		for _, alert := range alerts {
+			s.Notify(alert)
+		}
+	}
+	return alerts
+}
+
+// State returns the state a ticket was flagged with by the most recent scan.
+func (s *Scheduler) State(ticketID int64) State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flags[ticketID].State
+}
+
+// Flagged returns every ticket flagged due soon or overdue by the most recent scan, soonest due first.
+func (s *Scheduler) Flagged() []Flag {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Flag, 0)
+	for _, flag := range s.flags {
+		if flag.State != OnTrack {
+			result = append(result, flag)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DueDate.Equal(result[j].DueDate) {
+			return result[i].TicketID < result[j].TicketID
+		}
+		return result[i].DueDate.Before(result[j].DueDate)
+	})
+	return result
+}
+
+// Utility functions
+
+// Determines the state of a ticket at a given time.
+func (s *Scheduler) stateOf(ticket dsa.Ticket, now time.Time) State {
+	if ticket.DueDate.Before(now) {
+		return Overdue
+	}
+	if ticket.DueDate.Before(now.Add(s.DueSoon)) {
+		return DueSoon
+	}
+	return OnTrack
+}
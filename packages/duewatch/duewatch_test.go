@@ -0,0 +1,146 @@
+package duewatch
+
+import (
+	"goInAction2/assignment/packages/dsa"
+	"testing"
+	"time"
+)
+
+// Builds a scheduler over a mutable set of tickets, with a clock the test moves by hand.
+func newFixture(tickets map[int64]*dsa.Ticket, now *time.Time) *Scheduler {
+	s := New(func() []dsa.Ticket {
+		result := []dsa.Ticket{}
+		for _, ticket := range tickets {
+			result = append(result, *ticket)
+		}
+		return result
+	}, time.Hour, 24*time.Hour)
+	s.Now = func() time.Time { return *now }
+	return s
+}
+
+func TestTransitions(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	tickets := map[int64]*dsa.Ticket{
+		1: {TicketID: 1, Priority: 2, DueDate: start.Add(72 * time.Hour)},
+	}
+	s := newFixture(tickets, &now)
+	s.EscalateAfter = 24 * time.Hour
+	escalations := []int{}
+	s.Escalate = func(ticketID int64, priority int) bool {
+		escalations = append(escalations, priority)
+		tickets[ticketID].Priority = priority
+		return true
+	}
+	notified := 0
+	s.Notify = func(Alert) { notified++ }
+
+	steps := []struct {
+		at        time.Duration // Since start
+		state     State
+		alert     bool
+		escalated bool
+		priority  int
+	}{
+		{0, OnTrack, false, false, 2},
+		{49 * time.Hour, DueSoon, true, false, 2},             // Within a day of the due date
+		{60 * time.Hour, DueSoon, false, false, 2},            // Still due soon: no repeat alert
+		{72*time.Hour + time.Minute, Overdue, true, false, 2}, // Just overdue, not yet escalated
+		{90 * time.Hour, Overdue, false, false, 2},            // Overdue for less than EscalateAfter
+		{96 * time.Hour, Overdue, true, true, 1},              // Overdue a day: raised one level
+		{100 * time.Hour, Overdue, false, false, 1},           // Already escalated for this day
+		{120 * time.Hour, Overdue, true, true, 0},             // Overdue two days: raised to the highest level
+		{200 * time.Hour, Overdue, false, false, 0},           // Cannot go above the highest level
+	}
+	for _, step := range steps {
+		now = start.Add(step.at)
+		alerts := s.Scan()
+		if got := s.State(1); got != step.state {
+			t.Errorf("at +%v: state %v, want %v", step.at, got, step.state)
+		}
+		if (len(alerts) == 1) != step.alert || len(alerts) > 1 {
+			t.Fatalf("at +%v: %d alerts, want alert=%v", step.at, len(alerts), step.alert)
+		}
+		if step.alert {
+			alert := alerts[0]
+			if alert.State != step.state || alert.Escalated != step.escalated || alert.Ticket.Priority != step.priority {
+				t.Errorf("at +%v: alert %+v, want state %v, escalated %v, priority %d", step.at, alert, step.state, step.escalated, step.priority)
+			}
+			if step.escalated && alert.Previous != step.priority+1 {
+				t.Errorf("at +%v: previous priority %d, want %d", step.at, alert.Previous, step.priority+1)
+			}
+		}
+		if tickets[1].Priority != step.priority {
+			t.Errorf("at +%v: ticket priority %d, want %d", step.at, tickets[1].Priority, step.priority)
+		}
+	}
+	if want := []int{1, 0}; len(escalations) != len(want) || escalations[0] != want[0] || escalations[1] != want[1] {
+		t.Errorf("escalated to %v, want %v", escalations, want)
+	}
+	if notified != 4 {
+		t.Errorf("Notify called %d times, want 4", notified)
+	}
+}
+
+func TestEscalationDisabled(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start.Add(30 * 24 * time.Hour)
+	tickets := map[int64]*dsa.Ticket{
+		1: {TicketID: 1, Priority: 2, DueDate: start},
+	}
+	s := newFixture(tickets, &now)
+	s.Escalate = func(int64, int) bool {
+		t.Error("Escalate called with EscalateAfter unset")
+		return true
+	}
+	alerts := s.Scan()
+	if len(alerts) != 1 || alerts[0].State != Overdue || alerts[0].Escalated {
+		t.Errorf("alerts %+v, want one unescalated overdue alert", alerts)
+	}
+}
+
+func TestOverdueAfterDueDateMoved(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	tickets := map[int64]*dsa.Ticket{
+		1: {TicketID: 1, Priority: 1, DueDate: start.Add(-time.Hour)},
+	}
+	s := newFixture(tickets, &now)
+	if alerts := s.Scan(); len(alerts) != 1 || alerts[0].State != Overdue {
+		t.Fatalf("alerts %+v, want one overdue alert", alerts)
+	}
+
+	// Moving the due date out puts the ticket back on track; falling due again alerts again
+	tickets[1].DueDate = start.Add(48 * time.Hour)
+	if alerts := s.Scan(); len(alerts) != 0 || s.State(1) != OnTrack {
+		t.Fatalf("alerts %+v, state %v; want none and on track", alerts, s.State(1))
+	}
+	now = start.Add(30 * time.Hour)
+	if alerts := s.Scan(); len(alerts) != 1 || alerts[0].State != DueSoon {
+		t.Errorf("alerts %+v, want one due soon alert", alerts)
+	}
+}
+
+func TestFlaggedAndForgotten(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	tickets := map[int64]*dsa.Ticket{
+		1: {TicketID: 1, DueDate: start.Add(12 * time.Hour)},
+		2: {TicketID: 2, DueDate: start.Add(-time.Hour)},
+		3: {TicketID: 3, DueDate: start.Add(30 * 24 * time.Hour)},
+	}
+	s := newFixture(tickets, &now)
+	s.Scan()
+
+	flagged := s.Flagged()
+	if len(flagged) != 2 || flagged[0].TicketID != 2 || flagged[1].TicketID != 1 {
+		t.Fatalf("Flagged = %+v, want tickets 2 then 1, soonest due first", flagged)
+	}
+
+	delete(tickets, 2)
+	s.Scan()
+	if flagged := s.Flagged(); len(flagged) != 1 || flagged[0].TicketID != 1 {
+		t.Errorf("Flagged = %+v, want only ticket 1 after ticket 2 is deleted", flagged)
+	}
+}
@@ -1,7 +1,7 @@
 // Implements funtions to initialize and read to / write from csv files using the csv package, with additional checks and error handling against an SHA256 checksum to detect file tampering.
 // HashCSVs are safe for concurrent use via the inclusion of a Mutex with each struct.
 // Also includes a file to track the last saved time and date of each CSV file.
-// Functions to update the CSV save files are called whenever a user logs out of their session.
+// Functions to update the CSV save files are called whenever a user logs out of their session. Sessions themselves are the exception: a SessionStore saves them as they change.
 package hashcsv
 
 import (
@@ -10,10 +10,12 @@ import (
 	"errors"
 	"fmt"
 	"goInAction2/assignment/packages/dsa"
+	"goInAction2/assignment/packages/webhook"
 	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -89,7 +91,7 @@ func Init(name string) *HashCSV {
 }
 
 // SaveSubmissions saves an existing submissions heap (implemented in the dsa package) to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
-func (hcsv *HashCSV) SaveSubmissions(submissions *[]dsa.Ticket) {
+func (hcsv *HashCSV) SaveSubmissions(submissions *dsa.Submissionqueue) {
 	hcsv.mu.Lock()
 	defer hcsv.mu.Unlock()
 	// Check the hash
@@ -112,7 +114,7 @@ func (hcsv *HashCSV) SaveSubmissions(submissions *[]dsa.Ticket) {
 
 	// Write to updatedCSV
 	var records [][]string
-	for _, ticket := range *submissions {
+	for _, ticket := range submissions.Tickets() {
 		records = append(records, []string{
 			fmt.Sprint(ticket.TicketID),
 			fmt.Sprint(ticket.Product),
@@ -126,6 +128,7 @@ func (hcsv *HashCSV) SaveSubmissions(submissions *[]dsa.Ticket) {
 			ticket.Title,
 			ticket.Description,
 			ticket.Assignee,
+			ticket.Team,
 		})
 	}
 	err = (hcsv.Writer).WriteAll(records)
@@ -145,7 +148,7 @@ func (hcsv *HashCSV) SaveSubmissions(submissions *[]dsa.Ticket) {
 }
 
 // LoadSubmissions loads a submissions heap (implemented in the dsa package) from an existing csv file, and returns that newly-loaded heap's address.
-func (hcsv *HashCSV) LoadSubmissions() *[]dsa.Ticket {
+func (hcsv *HashCSV) LoadSubmissions() *dsa.Submissionqueue {
 	hcsv.mu.Lock()
 	defer hcsv.mu.Unlock()
 	// Check the hash
@@ -159,16 +162,15 @@ func (hcsv *HashCSV) LoadSubmissions() *[]dsa.Ticket {
 		log.Fatal("Failed to read csv file: ", err, hcsv.Name)
 	}
 
-	submissions := make([]dsa.Ticket, 0)
+	submissions := dsa.NewSubmissionqueue()
 	for _, ticket := range records {
-		rebuilt := rebuildTicket(ticket)
-		dsa.Addsubmission(&submissions, rebuilt)
+		submissions.Push(rebuildTicket(ticket))
 	}
-	return &submissions
+	return submissions
 }
 
-// SaveTickets saves an existing ticket AVL tree (implemented in the dsa package) to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
-func (hcsv *HashCSV) SaveTickets(Tickets *dsa.AVLtree) {
+// SaveTickets saves a snapshot of the ticket log (implemented in the dsa package) to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveTickets(Tickets *dsa.Ticketlog) {
 	hcsv.mu.Lock()
 	defer hcsv.mu.Unlock()
 	// Check the hash
@@ -188,7 +190,8 @@ func (hcsv *HashCSV) SaveTickets(Tickets *dsa.AVLtree) {
 	hcsv.Writer = csv.NewWriter(updatedCSV)
 
 	// Write to updatedCSV
-	records := saveAVLTree(Tickets.Root, [][]string{})
+	// Tickets approved or edited while saving go into later versions of the tree, so this snapshot is written out consistently without locking the ticket log
+	records := saveAVLTree(Tickets.Snapshot(), [][]string{})
 	err = (hcsv.Writer).WriteAll(records)
 	if err != nil {
 		log.Fatal("Failed to write record to csv file: ", err, hcsv.Name)
@@ -297,7 +300,7 @@ func (hcsv *HashCSV) LoadProducts() *[]string {
 }
 
 // SaveUsers saves a users hash table to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
-func (hcsv *HashCSV) SaveUsers(users *[]*dsa.UserNode) {
+func (hcsv *HashCSV) SaveUsers(users *dsa.Userlog) {
 	hcsv.mu.Lock()
 	defer hcsv.mu.Unlock()
 	// Check the hash
@@ -321,7 +324,15 @@ func (hcsv *HashCSV) SaveUsers(users *[]*dsa.UserNode) {
 		result := make([]string, 0)
 		result = append(result, SLL.User.Name)
 		result = append(result, string(SLL.User.Pw))
-		result = append(result, strconv.FormatBool(SLL.User.Admin))
+		result = append(result, string(SLL.User.Role))
+		result = append(result, SLL.User.Email)
+		result = append(result, strconv.Itoa(SLL.User.Notify))
+		result = append(result, fmt.Sprint(SLL.User.Home))
+		result = append(result, SLL.User.TOTP)
+		result = append(result, fmt.Sprint(SLL.User.TOTPStep))
+		result = append(result, strings.Join(SLL.User.Recovery, " "))
+		result = append(result, strconv.FormatBool(SLL.User.Require2FA))
+		result = append(result, SLL.User.MailKey)
 		return result
 	}
 	records := dsa.PrintHT(users, printfunc)
@@ -343,7 +354,7 @@ func (hcsv *HashCSV) SaveUsers(users *[]*dsa.UserNode) {
 }
 
 // LoadUsers loads a users hash table (implemented in the dsa package) from an existing csv file, and returns that newly-loaded users hash table's address.
-func (hcsv *HashCSV) LoadUsers() *[]*dsa.UserNode {
+func (hcsv *HashCSV) LoadUsers() *dsa.Userlog {
 	hcsv.mu.Lock()
 	defer hcsv.mu.Unlock()
 	// Check the hash
@@ -357,17 +368,341 @@ func (hcsv *HashCSV) LoadUsers() *[]*dsa.UserNode {
 		log.Fatal("Failed to read csv file: ", err, hcsv.Name)
 	}
 
-	users := make([]*dsa.UserNode, dsa.Hashbuckets)
+	users := dsa.NewHT()
 	for _, record := range records {
-		admin, _ := strconv.ParseBool(record[2])
+		role, ok := dsa.ParseRole(record[2])
+		if !ok { // Files saved before roles were introduced record an admin flag instead; migrate it
+			admin, _ := strconv.ParseBool(record[2])
+			role = dsa.LegacyRole(admin)
+		}
 		user := dsa.User{
-			Name:  record[0],
-			Pw:    []byte(record[1]),
-			Admin: admin,
+			Name: record[0],
+			Pw:   []byte(record[1]),
+			Role: role,
+		}
+		if len(record) > 3 { // Files saved before email addresses were recorded only have 3 columns
+			user.Email = record[3]
+		}
+		user.Notify = dsa.NotifyAll
+		if len(record) > 4 { // Files saved before notification preferences were recorded default to all notifications
+			user.Notify, _ = strconv.Atoi(record[4])
+		}
+		if len(record) > 5 {
+			user.Home, _ = strconv.ParseInt(record[5], 10, 64)
+		}
+		if len(record) > 9 { // Files saved before second factors were introduced have no second factor columns
+			user.TOTP = record[6]
+			user.TOTPStep, _ = strconv.ParseInt(record[7], 10, 64)
+			user.Recovery = strings.Fields(record[8])
+			user.Require2FA, _ = strconv.ParseBool(record[9])
+		}
+		if len(record) > 10 { // Files saved before mail keys were introduced have none; AddUser gives each user a new one
+			user.MailKey = record[10]
+		}
+		dsa.AddUser(users, user)
+	}
+	return users
+}
+
+// SaveWebhooks saves the registered webhooks to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveWebhooks(hooks []webhook.Hook) {
+	records := make([][]string, 0)
+	for _, hook := range hooks {
+		records = append(records, []string{
+			fmt.Sprint(hook.ID),
+			hook.URL,
+			hook.Secret,
+			strings.Join(hook.Events, " "),
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadWebhooks loads the registered webhooks from an existing csv file.
+func (hcsv *HashCSV) LoadWebhooks() []webhook.Hook {
+	hooks := make([]webhook.Hook, 0)
+	for _, record := range hcsv.loadRecords() {
+		id, _ := strconv.ParseInt(record[0], 10, 64)
+		hooks = append(hooks, webhook.Hook{
+			ID:     id,
+			URL:    record[1],
+			Secret: record[2],
+			Events: strings.Fields(record[3]),
+		})
+	}
+	return hooks
+}
+
+// SaveComments saves every comment in a comment log to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveComments(commentlog *dsa.Commentlog) {
+	records := make([][]string, 0)
+	for _, comment := range commentlog.AllComments() {
+		records = append(records, []string{
+			fmt.Sprint(comment.TicketID),
+			comment.Author,
+			comment.Posted.Format(time.RFC3339),
+			comment.Body,
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadComments loads a comment log from an existing csv file, and returns that newly-loaded comment log's address.
+func (hcsv *HashCSV) LoadComments() *dsa.Commentlog {
+	commentlog := dsa.NewCommentlog()
+	for _, record := range hcsv.loadRecords() {
+		ticketID, _ := strconv.ParseInt(record[0], 10, 64)
+		posted, _ := time.Parse(time.RFC3339, record[2])
+		commentlog.AddComment(dsa.Comment{
+			TicketID: ticketID,
+			Author:   record[1],
+			Posted:   posted,
+			Body:     record[3],
+		})
+	}
+	return commentlog
+}
+
+// SaveInbox saves every notification in an inbox to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveInbox(inbox *dsa.Inbox) {
+	records := make([][]string, 0)
+	for _, notification := range inbox.AllNotifications() {
+		records = append(records, []string{
+			fmt.Sprint(notification.ID),
+			notification.User,
+			fmt.Sprint(notification.TicketID),
+			notification.Kind,
+			notification.Created.Format(time.RFC3339),
+			strconv.FormatBool(notification.Read),
+			notification.Message,
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadInbox loads an inbox from an existing csv file, and returns that newly-loaded inbox's address.
+func (hcsv *HashCSV) LoadInbox() *dsa.Inbox {
+	inbox := dsa.NewInbox()
+	for _, record := range hcsv.loadRecords() {
+		id, _ := strconv.ParseInt(record[0], 10, 64)
+		ticketID, _ := strconv.ParseInt(record[2], 10, 64)
+		created, _ := time.Parse(time.RFC3339, record[4])
+		read, _ := strconv.ParseBool(record[5])
+		inbox.Restore(dsa.Notification{
+			ID:       id,
+			User:     record[1],
+			TicketID: ticketID,
+			Kind:     record[3],
+			Created:  created,
+			Read:     read,
+			Message:  record[6],
+		})
+	}
+	return inbox
+}
+
+// SaveFilters saves every filter in a filterbook to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveFilters(filters *dsa.Filterbook) {
+	records := make([][]string, 0)
+	for _, filter := range filters.AllFilters() {
+		records = append(records, []string{
+			fmt.Sprint(filter.ID),
+			filter.Owner,
+			filter.Name,
+			strconv.FormatBool(filter.Shared),
+			filter.Query,
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadFilters loads a filterbook from an existing csv file, and returns that newly-loaded filterbook's address.
+func (hcsv *HashCSV) LoadFilters() *dsa.Filterbook {
+	filters := dsa.NewFilterbook()
+	for _, record := range hcsv.loadRecords() {
+		id, _ := strconv.ParseInt(record[0], 10, 64)
+		shared, _ := strconv.ParseBool(record[3])
+		filters.Restore(dsa.Filter{
+			ID:     id,
+			Owner:  record[1],
+			Name:   record[2],
+			Shared: shared,
+			Query:  record[4],
+		})
+	}
+	return filters
+}
+
+// SaveTeams saves every team in a team roster to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+func (hcsv *HashCSV) SaveTeams(teams *dsa.Teamroster) {
+	records := make([][]string, 0)
+	for _, team := range teams.AllTeams() {
+		records = append(records, []string{
+			team.Name,
+			team.Lead,
+			strings.Join(team.Members, " "),
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadTeams loads a team roster from an existing csv file, and returns that newly-loaded team roster's address.
+func (hcsv *HashCSV) LoadTeams() *dsa.Teamroster {
+	teams := dsa.NewTeamroster()
+	for _, record := range hcsv.loadRecords() {
+		teams.Restore(dsa.Team{
+			Name:    record[0],
+			Lead:    record[1],
+			Members: strings.Fields(record[2]),
+		})
+	}
+	return teams
+}
+
+// SaveProductAccess saves the access lists of restricted products to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+// Each member is saved as a row of product, username and access; a restricted product with no members is saved as a row with a blank username.
+func (hcsv *HashCSV) SaveProductAccess(access *dsa.Productaccess) {
+	records := make([][]string, 0)
+	for _, product := range access.Products() {
+		members := access.Members(product)
+		if len(members) == 0 {
+			records = append(records, []string{product, "", ""})
+		}
+		for _, member := range members {
+			records = append(records, []string{product, member.User, member.Access.String()})
+		}
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadProductAccess loads the access lists of restricted products from an existing csv file, and returns the newly-loaded Productaccess's address.
+func (hcsv *HashCSV) LoadProductAccess() *dsa.Productaccess {
+	access := dsa.NewProductaccess()
+	for _, record := range hcsv.loadRecords() {
+		access.Restrict(record[0])
+		if level, ok := dsa.ParseAccess(record[2]); ok && record[1] != "" {
+			access.Grant(record[0], record[1], level)
 		}
-		dsa.AddUser(&users, user)
 	}
-	return &users
+	return access
+}
+
+// SaveResetTokens saves every outstanding password reset token to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+// Tokens are saved by hash only, as held in memory.
+func (hcsv *HashCSV) SaveResetTokens(tokens *dsa.Resettokens) {
+	records := make([][]string, 0)
+	for _, token := range tokens.AllTokens() {
+		records = append(records, []string{
+			token.Hash,
+			token.User,
+			token.Expires.Format(time.RFC3339),
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadResetTokens loads outstanding password reset tokens from an existing csv file, and returns the newly-loaded Resettokens's address.
+func (hcsv *HashCSV) LoadResetTokens() *dsa.Resettokens {
+	tokens := dsa.NewResettokens()
+	for _, record := range hcsv.loadRecords() {
+		expires, _ := time.Parse(time.RFC3339, record[2])
+		tokens.Restore(dsa.ResetToken{
+			Hash:    record[0],
+			User:    record[1],
+			Expires: expires,
+		})
+	}
+	return tokens
+}
+
+// SaveSessions saves every session in a store to an existing csv file, overwriting any existing data in the file, and updates the associated hash.
+// Sessions are saved by hash only, as held in memory, so that the file cannot be used to log in as anyone.
+func (hcsv *HashCSV) SaveSessions(sessions dsa.SessionStore) {
+	records := make([][]string, 0)
+	for _, session := range sessions.AllSessions() {
+		records = append(records, []string{
+			session.Hash,
+			session.User,
+			session.Created.Format(time.RFC3339),
+			session.LastSeen.Format(time.RFC3339),
+			session.Addr,
+			session.Agent,
+		})
+	}
+	hcsv.saveRecords(records)
+}
+
+// LoadSessions loads sessions from an existing csv file into a new in-memory store with the given lifetime and idle time, and returns the store's address.
+// Sessions which expired while the application was not running are discarded.
+func (hcsv *HashCSV) LoadSessions(lifetime, idle time.Duration) *dsa.Sessions {
+	sessions := dsa.NewSessions(lifetime, idle)
+	for _, record := range hcsv.loadRecords() {
+		created, _ := time.Parse(time.RFC3339, record[2])
+		lastSeen, _ := time.Parse(time.RFC3339, record[3])
+		sessions.Restore(dsa.Session{
+			Hash:     record[0],
+			User:     record[1],
+			Created:  created,
+			LastSeen: lastSeen,
+			Addr:     record[4],
+			Agent:    record[5],
+		})
+	}
+	sessions.Expire(time.Now())
+	return sessions
+}
+
+// Overwrites the csv file with records, after checking the existing file against its hash. Updates the hash and last saved time afterwards.
+func (hcsv *HashCSV) saveRecords(records [][]string) {
+	hcsv.mu.Lock()
+	defer hcsv.mu.Unlock()
+	// Check the hash
+	err := hcsv.checkHash()
+	if err != nil {
+		log.Fatal("Checkhash failed: ", err, hcsv.Name)
+	}
+	// Remove existing version of the log and update HashCSV fields
+	os.Remove(hcsv.FilePath)
+	updatedCSV, err := os.OpenFile(hcsv.FilePath,
+		os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		log.Fatal("Failed to open csv file: ", err, hcsv.Name)
+	}
+	hcsv.Reader = csv.NewReader(updatedCSV)
+	hcsv.Writer = csv.NewWriter(updatedCSV)
+
+	// Write to updatedCSV
+	err = (hcsv.Writer).WriteAll(records)
+	if err != nil {
+		log.Fatal("Failed to write record to csv file: ", err, hcsv.Name)
+	}
+
+	// Update hash checksum and last saved
+	err = hcsv.updateHash()
+	if err != nil {
+		log.Fatal("Failed to update hash: ", err, hcsv.Name)
+	}
+	err = hcsv.updateLastSaved()
+	if err != nil {
+		log.Fatal("Failed to update last saved: ", err, hcsv.Name)
+	}
+}
+
+// Reads every record from the csv file, after checking it against its hash.
+func (hcsv *HashCSV) loadRecords() [][]string {
+	hcsv.mu.Lock()
+	defer hcsv.mu.Unlock()
+	// Check the hash
+	err := hcsv.checkHash()
+	if err != nil {
+		log.Fatal("Checkhash failed: ", err, hcsv.Name)
+	}
+	// Read from the file
+	records, err := (hcsv.Reader).ReadAll()
+	if err != nil {
+		log.Fatal("Failed to read csv file: ", err, hcsv.Name)
+	}
+	return records
 }
 
 // Check the SHA256 hash of a CSV file against its associated checksum file.
@@ -449,6 +784,7 @@ func saveAVLTree(avlroot *dsa.TicketNode, result [][]string) [][]string {
 		avlroot.Ticket.Title,
 		avlroot.Ticket.Description,
 		avlroot.Ticket.Assignee,
+		avlroot.Ticket.Team,
 	})
 	result = saveAVLTree(avlroot.Right, result)
 	return result
@@ -468,6 +804,10 @@ func rebuildTicket(ticket []string) dsa.Ticket {
 	title := ticket[9]
 	desc := ticket[10]
 	assignee := ticket[11]
+	var team string
+	if len(ticket) > 12 { // Files saved before teams were introduced only have 12 columns
+		team = ticket[12]
+	}
 
 	return dsa.Ticket{
 		TicketID:    ticketid,
@@ -481,5 +821,6 @@ func rebuildTicket(ticket []string) dsa.Ticket {
 		Creator:     creator,
 		Title:       title,
 		Description: desc,
-		Assignee:    assignee}
+		Assignee:    assignee,
+		Team:        team}
 }
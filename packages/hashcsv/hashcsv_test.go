@@ -0,0 +1,56 @@
+package hashcsv
+
+import (
+	"crypto/sha256"
+	"goInAction2/assignment/packages/dsa"
+	"os"
+	"testing"
+)
+
+// Writes a csv file along with a matching checksum, as if saved by an earlier version of the application.
+func writeLegacy(t *testing.T, name, contents string) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(contents))
+	if err := os.WriteFile(csvpath+name+".csv", []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(csvpath+name+"checksum.txt", sum[:], 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadUsersMigratesAdminFlag(t *testing.T) {
+	inTempDir(t)
+	writeLegacy(t, "users", "alice,pw1,true\nbob,pw2,false\ncarol,pw3,Triager\n")
+
+	tests := []struct {
+		name string
+		role dsa.Role
+	}{
+		{"alice", dsa.RoleAdmin},
+		{"bob", dsa.RoleDeveloper},
+		{"carol", dsa.RoleTriager}, // Saved after roles were introduced, before email addresses were
+	}
+	check := func(users *dsa.Userlog, when string) {
+		t.Helper()
+		for _, test := range tests {
+			found, node := dsa.SearchUser(users, test.name)
+			if !found {
+				t.Errorf("%s: user %s missing", when, test.name)
+				continue
+			}
+			user := node.User
+			if user.Role != test.role || user.Notify != dsa.NotifyAll || user.MailKey == "" {
+				t.Errorf("%s: user %s = %+v, want role %s, every notification and a mail key", when, test.name, user, test.role)
+			}
+		}
+	}
+
+	file := Init("users")
+	users := file.LoadUsers()
+	check(users, "loaded")
+
+	// Saving writes role names in place of the flag, and they load back the same
+	file.SaveUsers(users)
+	check(Init("users").LoadUsers(), "saved and reloaded")
+}
@@ -0,0 +1,95 @@
+package hashcsv
+
+import (
+	"goInAction2/assignment/packages/dsa"
+	"sync"
+	"time"
+)
+
+// SessionStore is a dsa.SessionStore which persists its sessions to a csv file, so that users stay logged in across restarts.
+// Logging a session in or out, and every other change to which sessions exist, is saved at once, so that a revoked session cannot come back after a restart.
+// The last-used times recorded by Touch are only saved by the next such change or call to Expire, since saving on every request would be wasteful; after a crash, sessions may therefore go idle up to one garbage collection interval early.
+type SessionStore struct {
+	*dsa.Sessions
+
+	file  *HashCSV
+	mu    sync.Mutex // Serializes saves, so that the file is always left with the latest state
+	dirty bool       // Set when a last-used time has changed since the last save; guard with mu
+}
+
+// NewSessionStore loads the sessions saved in a csv file, and returns a store which saves to the same file.
+// The file is saved again at once, so that sessions which expired while the application was not running are discarded from it too.
+func NewSessionStore(file *HashCSV, lifetime, idle time.Duration) *SessionStore {
+	store := &SessionStore{Sessions: file.LoadSessions(lifetime, idle), file: file}
+	store.save()
+	return store
+}
+
+// Start creates a session for a user and saves it. See dsa.Sessions.Start.
+func (store *SessionStore) Start(user, addr, agent string, now time.Time) (string, error) {
+	token, err := store.Sessions.Start(user, addr, agent, now)
+	if err == nil {
+		store.save()
+	}
+	return token, err
+}
+
+// Touch returns the session a token belongs to, recording its use in memory until the next save. See dsa.Sessions.Touch.
+func (store *SessionStore) Touch(token string, now time.Time) (dsa.Session, bool) {
+	session, ok := store.Sessions.Touch(token, now)
+	if ok {
+		store.mu.Lock()
+		store.dirty = true
+		store.mu.Unlock()
+	}
+	return session, ok
+}
+
+// Revoke discards a session and saves the change. See dsa.Sessions.Revoke.
+func (store *SessionStore) Revoke(hash string) bool {
+	if !store.Sessions.Revoke(hash) {
+		return false
+	}
+	store.save()
+	return true
+}
+
+// RevokeUser discards a user's sessions and saves the change. See dsa.Sessions.RevokeUser.
+func (store *SessionStore) RevokeUser(user, except string) int {
+	count := store.Sessions.RevokeUser(user, except)
+	if count > 0 {
+		store.save()
+	}
+	return count
+}
+
+// Expire discards expired sessions, and saves the change along with any last-used times recorded since the last save. See dsa.Sessions.Expire.
+func (store *SessionStore) Expire(now time.Time) int {
+	count := store.Sessions.Expire(now)
+	store.mu.Lock()
+	dirty := store.dirty
+	store.mu.Unlock()
+	if count > 0 || dirty {
+		store.save()
+	}
+	return count
+}
+
+// RenameUser moves a user's sessions over to their new username, and saves the change.
+func (store *SessionStore) RenameUser(oldname, newname string) {
+	if oldname == newname {
+		return
+	}
+	store.Sessions.RenameUser(oldname, newname)
+	store.save()
+}
+
+// Utility functions
+
+// Saves every session to the file. The sessions are read after taking the lock, so that of two concurrent saves, the last to write has the latest state.
+func (store *SessionStore) save() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.dirty = false
+	store.file.SaveSessions(store.Sessions)
+}
@@ -0,0 +1,78 @@
+package hashcsv
+
+import (
+	"goInAction2/assignment/packages/dsa"
+	"os"
+	"testing"
+	"time"
+)
+
+// Runs the rest of a test in an empty temporary directory with a csv folder, as Init expects.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(dir+"/csv", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestSessionStoreRoundTrip(t *testing.T) {
+	inTempDir(t)
+	now := time.Now()
+	store := NewSessionStore(Init("sessions"), time.Hour, 30*time.Minute)
+
+	alice, err := store.Start("alice", "10.0.0.1", "Firefox", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _ := store.Start("bob", "10.0.0.2", "Safari", now)
+	if !store.Revoke(dsa.HashToken(bob)) {
+		t.Fatalf("Revoke of a live session = false")
+	}
+
+	// A request 20 minutes in is saved by the next Expire, so the session is not idle 40 minutes in
+	if _, ok := store.Touch(alice, now.Add(20*time.Minute)); !ok {
+		t.Fatalf("Touch of a live session = false")
+	}
+	store.Expire(now.Add(20 * time.Minute))
+
+	// Restart: load the sessions saved to the file
+	reloaded := NewSessionStore(Init("sessions"), time.Hour, 30*time.Minute)
+	session, ok := reloaded.Touch(alice, now.Add(40*time.Minute))
+	if !ok {
+		t.Fatalf("session lost on reload, or its last request was not saved")
+	}
+	if session.User != "alice" || session.Addr != "10.0.0.1" || session.Agent != "Firefox" || !session.Created.Equal(now.Truncate(time.Second)) {
+		t.Errorf("reloaded session = %+v", session)
+	}
+	if _, ok := reloaded.Touch(bob, now.Add(40*time.Minute)); ok {
+		t.Errorf("revoked session came back after reload")
+	}
+}
+
+func TestSessionStoreDropsExpired(t *testing.T) {
+	inTempDir(t)
+	now := time.Now()
+	store := NewSessionStore(Init("sessions"), time.Hour, 30*time.Minute)
+	store.Start("alice", "10.0.0.1", "Firefox", now)
+	carol, _ := store.Start("carol", "10.0.0.3", "Chrome", now.Add(-2*time.Hour)) // Expires while the application is not running
+
+	reloaded := NewSessionStore(Init("sessions"), time.Hour, 30*time.Minute)
+	if _, ok := reloaded.Get(dsa.HashToken(carol)); ok {
+		t.Errorf("expired session kept on reload")
+	}
+
+	// Loading saves again, so the expired session is gone from the file too
+	sessions := Init("sessions").LoadSessions(24*time.Hour, 24*time.Hour)
+	if all := sessions.AllSessions(); len(all) != 1 || all[0].User != "alice" {
+		t.Errorf("file holds %+v after reload, want alice's session only", all)
+	}
+}
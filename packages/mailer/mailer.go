@@ -0,0 +1,150 @@
+// Implements an outbound mailer, used to send notification emails through an SMTP relay.
+// Mail is queued by callers (i.e. handlers) and sent by a fixed pool of background workers, so a slow or unreachable relay never blocks a request.
+// The relay is reached through a replaceable Send function, which defaults to smtp.SendMail; pointing Addr at a local SMTP server is enough to capture outgoing mail while testing.
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the backlog of unsent mail is at capacity.
+	ErrQueueFull = errors.New("mail queue full")
+	// ErrDisabled is returned by Enqueue when no relay is configured.
+	ErrDisabled = errors.New("no smtp relay configured")
+	// ErrClosed is returned by Enqueue after Close has been called.
+	ErrClosed = errors.New("mailer closed")
+)
+
+// Mail is a single plain text email to one recipient.
+type Mail struct {
+	To      string
+	ReplyTo string // Optional address replies should be sent to, instead of From
+	Subject string
+	Body    string
+}
+
+// Mailer queues mail and sends it from background workers.
+type Mailer struct {
+	Addr string    // Relay address, e.g. "localhost:25"; blank disables sending
+	From string    // Sender address used for the envelope and From header
+	Auth smtp.Auth // Optional relay authentication
+	Log  func(string) error
+	Send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+	mu     sync.Mutex
+	queue  chan Mail
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// New creates a Mailer and starts its workers, returning its pointer.
+func New(addr, from string, auth smtp.Auth, workers, backlog int) *Mailer {
+	m := &Mailer{
+		Addr:  addr,
+		From:  from,
+		Auth:  auth,
+		Send:  smtp.SendMail,
+		queue: make(chan Mail, backlog),
+	}
+	for i := 0; i < workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Enabled reports whether a relay has been configured.
+func (m *Mailer) Enabled() bool {
+	return m.Addr != ""
+}
+
+// Enqueue adds a mail to the send queue without blocking.
+func (m *Mailer) Enqueue(mail Mail) error {
+	if !m.Enabled() {
+		return ErrDisabled
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	select {
+	case m.queue <- mail:
+		return nil
+	default:
+		m.log(fmt.Sprintf("Dropped mail to %s (%q): %s.", mail.To, mail.Subject, ErrQueueFull))
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting mail and waits for the workers to send everything already queued.
+func (m *Mailer) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.queue)
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// Compose renders a mail as an RFC 5322 message.
+func Compose(from string, mail Mail, date time.Time) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + mail.To + "\r\n")
+	if mail.ReplyTo != "" {
+		sb.WriteString("Reply-To: " + mail.ReplyTo + "\r\n")
+	}
+	sb.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", mail.Subject) + "\r\n")
+	sb.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	sb.WriteString("Message-ID: <" + uuid.NewV4().String() + "@" + domain(from) + ">\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	sb.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	sb.WriteString("\r\n")
+	for _, line := range strings.Split(mail.Body, "\n") {
+		sb.WriteString(strings.TrimRight(line, "\r") + "\r\n")
+	}
+	return []byte(sb.String())
+}
+
+// Utility functions
+
+// Sends queued mail until the queue is closed.
+func (m *Mailer) work() {
+	defer m.wg.Done()
+	for mail := range m.queue {
+		err := m.Send(m.Addr, m.Auth, m.From, []string{mail.To}, Compose(m.From, mail, time.Now()))
+		if err != nil {
+			m.log(fmt.Sprintf("Failed to send mail to %s (%q): %s.", mail.To, mail.Subject, err))
+		} else {
+			m.log(fmt.Sprintf("Sent mail to %s (%q).", mail.To, mail.Subject))
+		}
+	}
+}
+
+func (m *Mailer) log(message string) {
+	if m.Log != nil {
+		m.Log(message)
+	}
+}
+
+// Returns the domain of an email address, for use in Message-IDs.
+func domain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.Trim(address[at+1:], "> ")
+	}
+	return "localhost"
+}
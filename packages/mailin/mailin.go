@@ -0,0 +1,287 @@
+// Implements a minimal SMTP listener, used to turn incoming email into ticket submissions and comments.
+// Supports the subset of RFC 5321 needed by ordinary mail clients and relays (HELO/EHLO, MAIL, RCPT, DATA, RSET, NOOP, QUIT); no authentication or TLS is offered, so it should only listen on an address reachable by a trusted relay.
+// Each accepted message is parsed and passed to the Server's Handler; if the Handler returns an error, the message is rejected and the error reported back to the sender.
+package mailin
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize = 1 << 20 // Largest message body accepted, in bytes
+	idleTimeout    = 5 * time.Minute
+)
+
+var (
+	// ErrServerClosed is returned by Serve once Close has been called.
+	ErrServerClosed = errors.New("mailin: server closed")
+	errTooLarge     = errors.New("message exceeds maximum size")
+)
+
+// Message is an incoming email, reduced to the fields used by the application.
+type Message struct {
+	From     string   // Envelope sender (MAIL FROM), e.g. "user1@example.com"; not the From header, which a client may set to anything
+	To       []string // Envelope recipients, e.g. "saucer@bugs.example.com"
+	Subject  string
+	Body     string // Plain text body
+	Received time.Time
+}
+
+// Server is an SMTP listener which passes every accepted Message to Handler.
+type Server struct {
+	Addr     string // TCP address to listen on, e.g. "localhost:2525"
+	Hostname string // Name announced in the greeting
+	MaxSize  int    // Largest message accepted, in bytes; defaults to 1MB
+	Handler  func(msg Message) error
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// ListenAndServe listens on s.Addr and serves SMTP sessions until Close is called.
+func (s *Server) ListenAndServe() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on a listener, handling each SMTP session on its own goroutine.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.session(conn)
+	}
+}
+
+// Close stops the listener. Sessions already in progress are allowed to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// Utility functions
+
+// Runs one SMTP session over a connection.
+func (s *Server) session(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+
+	var from string
+	var to []string
+	reply := func(code int, msg string) {
+		text.PrintfLine("%d %s", code, msg)
+	}
+
+	reply(220, hostname+" ESMTP ready")
+	for {
+		conn.SetDeadline(time.Now().Add(idleTimeout))
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := splitCommand(line)
+
+		switch verb {
+		case "HELO":
+			reply(250, hostname)
+		case "EHLO":
+			text.PrintfLine("250-%s", hostname)
+			text.PrintfLine("250-SIZE %d", maxSize)
+			reply(250, "8BITMIME")
+		case "MAIL":
+			addr, ok := pathArg(arg, "FROM:")
+			if !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			from, to = addr, nil
+			reply(250, "OK")
+		case "RCPT":
+			if from == "" {
+				reply(503, "Need MAIL before RCPT")
+				continue
+			}
+			addr, ok := pathArg(arg, "TO:")
+			if !ok || addr == "" {
+				reply(501, "Syntax: RCPT TO:<address>")
+				continue
+			}
+			to = append(to, addr)
+			reply(250, "OK")
+		case "DATA":
+			if from == "" || len(to) == 0 {
+				reply(503, "Need MAIL and RCPT before DATA")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			raw, err := ioutil.ReadAll(io.LimitReader(text.DotReader(), int64(maxSize)+1))
+			if err != nil {
+				return
+			}
+			if len(raw) > maxSize {
+				// Discard the remainder so the session stays in sync.
+				io.Copy(ioutil.Discard, text.DotReader())
+				reply(552, errTooLarge.Error())
+			} else if msg, err := parse(raw, from, to); err != nil {
+				reply(550, "Could not parse message: "+err.Error())
+			} else if err := s.handle(msg); err != nil {
+				reply(550, "Rejected: "+err.Error())
+			} else {
+				reply(250, "OK: queued")
+			}
+			from, to = "", nil
+		case "RSET":
+			from, to = "", nil
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// Calls the Handler, treating a missing handler as rejecting everything.
+func (s *Server) handle(msg Message) error {
+	if s.Handler == nil {
+		return errors.New("no handler configured")
+	}
+	return s.Handler(msg)
+}
+
+// Splits an SMTP command line into its upper-cased verb and its argument.
+func splitCommand(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return strings.ToUpper(line[:i]), strings.TrimSpace(line[i+1:])
+	}
+	return strings.ToUpper(line), ""
+}
+
+// Extracts the address from a "FROM:<addr>" or "TO:<addr>" argument, ignoring any trailing ESMTP parameters.
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if fields := strings.Fields(path); len(fields) > 0 {
+		path = fields[0]
+	}
+	if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+		return "", false
+	}
+	return strings.ToLower(path[1 : len(path)-1]), true
+}
+
+// Parses a raw RFC 5322 message into a Message. The sender is always the envelope sender: the From header is written by the client and proves nothing, so it is ignored.
+func parse(raw []byte, envelopeFrom string, to []string) (Message, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		return Message{}, err
+	}
+
+	result := Message{
+		From:     envelopeFrom,
+		To:       to,
+		Received: time.Now(),
+	}
+	decoder := new(mime.WordDecoder)
+	result.Subject = msg.Header.Get("Subject")
+	if decoded, err := decoder.DecodeHeader(result.Subject); err == nil {
+		result.Subject = decoded
+	}
+	body, err := plainText(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return Message{}, err
+	}
+	result.Body = strings.TrimSpace(body)
+	return result, nil
+}
+
+// Returns the text/plain content of a message part, descending into multipart bodies and undoing transfer encodings.
+func plainText(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediatype, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediatype = "text/plain"
+	}
+
+	if strings.HasPrefix(mediatype, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", nil
+			} else if err != nil {
+				return "", err
+			}
+			text, err := plainText(part.Header, part)
+			if err != nil {
+				return "", err
+			}
+			if text != "" {
+				return text, nil
+			}
+		}
+	}
+	if mediatype != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	b, err := ioutil.ReadAll(bufio.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("reading body: %v", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,159 @@
+package mailin
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestParseUsesEnvelopeSender(t *testing.T) {
+	raw := "From: Admin <admin@example.com>\r\n" +
+		"To: saucer@bugs.example.com\r\n" +
+		"Subject: Forged\r\n" +
+		"\r\n" +
+		"Body\r\n"
+	msg, err := parse([]byte(raw), "user1@example.com", []string{"saucer@bugs.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.From != "user1@example.com" {
+		t.Errorf("From = %q, want the envelope sender %q", msg.From, "user1@example.com")
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "plain",
+			raw:         "Subject: Crash on start\r\n\r\nIt crashes.\r\n",
+			wantSubject: "Crash on start",
+			wantBody:    "It crashes.",
+		},
+		{
+			name:        "encoded subject",
+			raw:         "Subject: =?utf-8?q?Caf=C3=A9_menu?=\r\n\r\nText\r\n",
+			wantSubject: "Café menu",
+			wantBody:    "Text",
+		},
+		{
+			name: "quoted-printable",
+			raw: "Subject: QP\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"A long line which is=\r\n wrapped, and caf=C3=A9.\r\n",
+			wantSubject: "QP",
+			wantBody:    "A long line which is wrapped, and café.",
+		},
+		{
+			name: "base64",
+			raw: "Subject: B64\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Content-Transfer-Encoding: base64\r\n" +
+				"\r\n" +
+				"SGVsbG8sIHdvcmxkIQ==\r\n",
+			wantSubject: "B64",
+			wantBody:    "Hello, world!",
+		},
+		{
+			name: "multipart prefers text/plain",
+			raw: "Subject: Multi\r\n" +
+				"MIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/alternative; boundary=XYZ\r\n" +
+				"\r\n" +
+				"--XYZ\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>HTML version</p>\r\n" +
+				"--XYZ\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"Plain version\r\n" +
+				"--XYZ--\r\n",
+			wantSubject: "Multi",
+			wantBody:    "Plain version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parse([]byte(tt.raw), "user1@example.com", []string{"saucer@bugs.example.com"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", msg.Subject, tt.wantSubject)
+			}
+			if msg.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", msg.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPathArg(t *testing.T) {
+	tests := []struct {
+		arg    string
+		want   string
+		wantOK bool
+	}{
+		{"FROM:<User1@Example.com>", "user1@example.com", true},
+		{"from: <user1@example.com> SIZE=1024", "user1@example.com", true},
+		{"FROM:<>", "", true},
+		{"FROM:user1@example.com", "", false},
+		{"TO:<user1@example.com>", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := pathArg(tt.arg, "FROM:")
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("pathArg(%q) = %q, %v; want %q, %v", tt.arg, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestServerSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	received := make(chan Message, 1)
+	server := &Server{
+		Hostname: "bugs.example.com",
+		Handler: func(msg Message) error {
+			if strings.Contains(msg.Subject, "reject") {
+				return errors.New("not wanted")
+			}
+			received <- msg
+			return nil
+		},
+	}
+	go server.Serve(ln)
+	defer server.Close()
+
+	raw := []byte("From: admin@example.com\r\nSubject: Hello\r\n\r\nBody text\r\n")
+	if err := smtp.SendMail(ln.Addr().String(), nil, "User1@example.com", []string{"Saucer+KEY@bugs.example.com"}, raw); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-received
+	if msg.From != "user1@example.com" {
+		t.Errorf("From = %q, want the lower-cased envelope sender", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "saucer+key@bugs.example.com" {
+		t.Errorf("To = %q, want the lower-cased envelope recipient", msg.To)
+	}
+	if msg.Subject != "Hello" || msg.Body != "Body text" {
+		t.Errorf("got subject %q and body %q", msg.Subject, msg.Body)
+	}
+
+	raw = []byte("Subject: Please reject\r\n\r\nBody\r\n")
+	err = smtp.SendMail(ln.Addr().String(), nil, "user1@example.com", []string{"saucer@bugs.example.com"}, raw)
+	if err == nil || !strings.Contains(err.Error(), "not wanted") {
+		t.Errorf("SendMail error = %v, want the handler's rejection", err)
+	}
+}
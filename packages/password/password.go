@@ -0,0 +1,102 @@
+// Implements the password policy applied whenever a user chooses a password, and the bcrypt hashing of passwords.
+// A password must be at least MinLength characters long, must not contain the username, and must not be on a blocklist of breached passwords, read from a local file of one password per line.
+// Passwords are hashed with a configurable bcrypt cost. NeedsRehash reports stored hashes made with a lower cost, so that they can be upgraded the next time the user logs in, when their password is known.
+// A Policy is not modified once its blocklist is loaded, and is then safe for concurrent use.
+package password
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrTooShort is returned by Check for passwords shorter than the policy's MinLength.
+	ErrTooShort = errors.New("password is too short")
+	// ErrContainsUsername is returned by Check for passwords containing the username.
+	ErrContainsUsername = errors.New("password must not contain the username")
+	// ErrBreached is returned by Check for passwords on the blocklist.
+	ErrBreached = errors.New("password is known from a data breach; choose another")
+)
+
+// Policy holds the rules a new password must satisfy, and the bcrypt cost of new hashes.
+type Policy struct {
+	MinLength int // Minimum length, in characters
+	Cost      int // bcrypt cost of new hashes
+
+	blocklist map[string]bool // Lower-cased breached passwords
+}
+
+// New creates a Policy with an empty blocklist, returning its pointer. The cost is clamped to the range bcrypt accepts.
+func New(minLength, cost int) *Policy {
+	return &Policy{
+		MinLength: minLength,
+		Cost:      min(max(cost, bcrypt.MinCost), bcrypt.MaxCost),
+		blocklist: make(map[string]bool),
+	}
+}
+
+// LoadBlocklist adds the passwords listed in a file, one per line, to the blocklist. Blank lines and lines starting with # are skipped.
+// Returns the number of passwords added.
+func (p *Policy) LoadBlocklist(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if word := strings.ToLower(line); !p.blocklist[word] {
+			p.blocklist[word] = true
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
+
+// Check returns an error describing the first rule a password breaks for a given user, or nil if it satisfies the policy.
+// Usernames and blocklisted passwords are matched regardless of case.
+func (p *Policy) Check(username, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w (at least %d characters)", ErrTooShort, p.MinLength)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return ErrContainsUsername
+	}
+	if p.blocklist[strings.ToLower(password)] {
+		return ErrBreached
+	}
+	return nil
+}
+
+// Describe returns the policy's rules as a sentence, for display next to password fields.
+func (p *Policy) Describe() string {
+	rules := fmt.Sprintf("At least %d characters, not containing the username", p.MinLength)
+	if len(p.blocklist) > 0 {
+		rules += ", and not a commonly breached password"
+	}
+	return rules + "."
+}
+
+// Hash returns the bcrypt hash of a password, at the policy's cost.
+func (p *Policy) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), p.Cost)
+}
+
+// NeedsRehash reports whether a stored hash was made with a lower cost than the policy's, and should be replaced once the password is known.
+// Hashes which cannot be read are left alone.
+func (p *Policy) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err == nil && cost < p.Cost
+}
@@ -0,0 +1,106 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheck(t *testing.T) {
+	p := New(8, bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	list := "# Breached passwords\n\nPassword1\n  letmein123  \npassword1\nqwertyuiop\n"
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+	count, err := p.LoadBlocklist(path)
+	if err != nil || count != 3 {
+		t.Fatalf("LoadBlocklist = %d, %v, want 3 passwords", count, err)
+	}
+	if _, err := p.LoadBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("LoadBlocklist of a missing file succeeded")
+	}
+
+	tests := []struct {
+		username, password string
+		err                error
+	}{
+		{"alice", "correct horse", nil},
+		{"alice", "1234567", ErrTooShort},
+		{"alice", "12345678", nil},
+		{"alice", "éééééééé", nil}, // Length counts characters, not bytes
+		{"alice", "ééééééé", ErrTooShort},
+		{"alice", "my alice pw", ErrContainsUsername},
+		{"alice", "myALICEpw", ErrContainsUsername},
+		{"Alice", "xxalicexx", ErrContainsUsername},
+		{"", "anything long", nil},
+		{"bob", "password1", ErrBreached},
+		{"bob", "PASSWORD1", ErrBreached},
+		{"bob", "letmein123", ErrBreached},
+		{"bob", "  letmein123  ", nil}, // Passwords themselves are not trimmed
+		{"bob", "# Breached passwords", nil},
+		{"bob", "qwertyuiop!", nil},
+		{"qwerty", "qwertyuiop", ErrContainsUsername}, // Rules are checked in order
+		{"bob", "pw1", ErrTooShort},
+	}
+	for _, test := range tests {
+		if err := p.Check(test.username, test.password); !errors.Is(err, test.err) {
+			t.Errorf("Check(%q, %q) = %v, want %v", test.username, test.password, err, test.err)
+		}
+	}
+	if err := p.Check("alice", "short"); err == nil || err.Error() != "password is too short (at least 8 characters)" {
+		t.Errorf("Check of a short password: error %v", err)
+	}
+
+	if got := p.Describe(); got != "At least 8 characters, not containing the username, and not a commonly breached password." {
+		t.Errorf("Describe = %q", got)
+	}
+	if got := New(10, bcrypt.MinCost).Describe(); got != "At least 10 characters, not containing the username." {
+		t.Errorf("Describe without a blocklist = %q", got)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	low := New(8, bcrypt.MinCost)
+	high := New(8, bcrypt.MinCost+1)
+	hash, err := low.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	highHash, err := high.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte("correct horse")) != nil {
+		t.Errorf("Hash does not verify against its password")
+	}
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		hash   []byte
+		want   bool
+	}{
+		{"same cost", low, hash, false},
+		{"lower cost", high, hash, true},
+		{"higher cost", low, highHash, false},
+		{"unreadable hash", high, []byte("not a hash"), false},
+		{"no hash", high, nil, false},
+	}
+	for _, test := range tests {
+		if got := test.policy.NeedsRehash(test.hash); got != test.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Costs are clamped to the range bcrypt accepts
+	if p := New(8, 1); p.Cost != bcrypt.MinCost {
+		t.Errorf("New with cost 1: Cost = %d, want %d", p.Cost, bcrypt.MinCost)
+	}
+	if p := New(8, 99); p.Cost != bcrypt.MaxCost {
+		t.Errorf("New with cost 99: Cost = %d, want %d", p.Cost, bcrypt.MaxCost)
+	}
+}
@@ -0,0 +1,465 @@
+// Implements a QR code encoder (ISO/IEC 18004), used to show authenticator apps the otpauth:// URI of a new TOTP secret.
+// Text is encoded in byte mode at error correction level M, in the smallest version from 1 to 9 which can hold it; that is, up to 180 bytes.
+// The mask is chosen by the penalty rules of the standard. Codes can be rendered as PNG images, with the quiet zone included.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const (
+	maxVersion = 9 // From version 10, byte counts take 16 bits; not supported
+	quietZone  = 4 // Light modules around the code, in modules
+)
+
+// ErrTooLong is returned by Encode for text which does not fit in the largest supported version.
+var ErrTooLong = errors.New("text too long for a qr code")
+
+// Error correction codewords per block, and number of blocks, at level M for each version (index 0 unused).
+var (
+	eccPerBlock = [maxVersion + 1]int{0, 10, 16, 26, 18, 24, 16, 18, 22, 22}
+	numBlocks   = [maxVersion + 1]int{0, 1, 1, 1, 2, 2, 4, 4, 4, 5}
+)
+
+// Code is an encoded QR code: a square of dark and light modules.
+type Code struct {
+	Size    int // Modules per side, excluding the quiet zone
+	modules [][]bool
+	reserve [][]bool // Function modules, which data and masks never touch
+}
+
+// Encode returns the QR code of a text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+8+8*len(data) <= dataCodewords(v)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	// Mode indicator, byte count and data, then a terminator and padding up to capacity
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), 8)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := dataCodewords(version) * 8
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	code := newCode(version)
+	code.drawFunctionPatterns(version)
+	code.drawCodewords(interleave(version, bits.bytes()))
+
+	// Keep the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		code.applyMask(mask) // Masks are XORs, so applying one again undoes it
+	}
+	code.applyMask(best)
+	code.drawFormatBits(best)
+	return code, nil
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (code *Code) Dark(x, y int) bool {
+	return code.modules[y][x]
+}
+
+// PNG renders a code as a black-on-white PNG image, with each module scale pixels wide.
+func (code *Code) PNG(scale int) ([]byte, error) {
+	side := (code.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+			shade := color.Gray{Y: 255}
+			if mx >= 0 && my >= 0 && mx < code.Size && my < code.Size && code.modules[my][mx] {
+				shade = color.Gray{Y: 0}
+			}
+			img.SetGray(x, y, shade)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Utility functions
+
+// Returns an all-light code of a given version.
+func newCode(version int) *Code {
+	size := 17 + 4*version
+	code := &Code{Size: size, modules: make([][]bool, size), reserve: make([][]bool, size)}
+	for i := range code.modules {
+		code.modules[i] = make([]bool, size)
+		code.reserve[i] = make([]bool, size)
+	}
+	return code
+}
+
+// Sets a function module at column x and row y.
+func (code *Code) set(x, y int, dark bool) {
+	code.modules[y][x] = dark
+	code.reserve[y][x] = true
+}
+
+// Draws the finder, timing and alignment patterns, and version information, and reserves the format information areas.
+func (code *Code) drawFunctionPatterns(version int) {
+	size := code.Size
+	for i := 0; i < size; i++ {
+		code.set(6, i, i%2 == 0)
+		code.set(i, 6, i%2 == 0)
+	}
+
+	// Finder patterns with their separators
+	for _, corner := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := corner[0]+dx, corner[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					dist := max(abs(dx), abs(dy))
+					code.set(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+
+	// Alignment patterns, except where they would overlap a finder pattern
+	positions := alignmentPositions(version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					code.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	code.drawFormatBits(0) // Reserves the area; drawn again once the mask is chosen
+
+	// Version information, from version 7
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := size-11+i%3, i/3
+			code.set(a, b, dark)
+			code.set(b, a, dark)
+		}
+	}
+}
+
+// Draws both copies of the format information for level M and a given mask, and the dark module beside them.
+func (code *Code) drawFormatBits(mask int) {
+	data := 0<<3 | mask // Level M is encoded as 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	size := code.Size
+	for i := 0; i <= 5; i++ {
+		code.set(8, i, bit(i))
+	}
+	code.set(8, 7, bit(6))
+	code.set(8, 8, bit(7))
+	code.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		code.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		code.set(size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		code.set(8, size-15+i, bit(i))
+	}
+	code.set(8, size-8, true)
+}
+
+// Places codewords in the non-function modules, in the standard zigzag of two-module columns from the bottom right.
+func (code *Code) drawCodewords(data []byte) {
+	size := code.Size
+	i := 0
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 { // Skips the vertical timing pattern
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if upward {
+				y = size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if !code.reserve[y][x] && i < len(data)*8 {
+					code.modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// Inverts every non-function module selected by a mask pattern.
+func (code *Code) applyMask(mask int) {
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !code.reserve[y][x] {
+				code.modules[y][x] = !code.modules[y][x]
+			}
+		}
+	}
+}
+
+// Scores how hard a code is to scan: long runs, 2x2 blocks, finder-like patterns and an imbalance of dark and light modules all add to the penalty.
+func (code *Code) penalty() int {
+	size := code.Size
+	result := 0
+	line := make([]bool, size)
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < size; a++ {
+			for b := 0; b < size; b++ {
+				if vertical {
+					line[b] = code.modules[b][a]
+				} else {
+					line[b] = code.modules[a][b]
+				}
+			}
+			// Runs of five or more modules of the same color
+			run := 1
+			for b := 1; b <= size; b++ {
+				if b < size && line[b] == line[b-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += 3 + run - 5
+				}
+				run = 1
+			}
+			// Dark-light-dark-dark-dark-light-dark, with four light modules on either side
+			for b := 0; b+11 <= size; b++ {
+				if matches(line[b:b+11], "10111010000") || matches(line[b:b+11], "00001011101") {
+					result += 40
+				}
+			}
+		}
+	}
+	dark := 0
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if code.modules[y][x] {
+				dark++
+			}
+			if x+1 < size && y+1 < size {
+				c := code.modules[y][x]
+				if c == code.modules[y][x+1] && c == code.modules[y+1][x] && c == code.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+	total := size * size
+	result += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+	return result
+}
+
+// Reports whether a line of modules matches a pattern of 1s (dark) and 0s (light).
+func matches(line []bool, pattern string) bool {
+	for i := range pattern {
+		if line[i] != (pattern[i] == '1') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the centre coordinates of the alignment patterns of a version, in both directions.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	count := version/7 + 2
+	step := (version*4 + count*2 + 1) / (count*2 - 2) * 2
+	result := make([]int, count)
+	result[0] = 6
+	for i, pos := count-1, 17+4*version-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// Returns the number of modules of a version available for codewords, after function patterns.
+func rawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		count := version/7 + 2
+		result -= (25*count-10)*count - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// Returns the number of data codewords of a version at level M.
+func dataCodewords(version int) int {
+	return rawModules(version)/8 - eccPerBlock[version]*numBlocks[version]
+}
+
+// Splits data codewords into blocks, appends each block's error correction codewords, and interleaves the blocks.
+func interleave(version int, data []byte) []byte {
+	blocks := numBlocks[version]
+	eccLen := eccPerBlock[version]
+	raw := rawModules(version) / 8
+	shortBlocks := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	divisor := rsDivisor(eccLen)
+	result := make([][]byte, 0, blocks)
+	k := 0
+	for i := 0; i < blocks; i++ {
+		dataLen := shortLen - eccLen
+		if i >= shortBlocks {
+			dataLen++
+		}
+		block := append([]byte{}, data[k:k+dataLen]...)
+		k += dataLen
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks { // Pads short blocks to the same length, so they can be interleaved column by column
+			block = append(block, 0)
+		}
+		result = append(result, append(block, ecc...))
+	}
+
+	interleaved := make([]byte, 0, raw)
+	for i := range result[0] {
+		for j, block := range result {
+			if i != shortLen-eccLen || j >= shortBlocks {
+				interleaved = append(interleaved, block[i])
+			}
+		}
+	}
+	return interleaved
+}
+
+// Returns the Reed-Solomon generator polynomial of a given degree, without its leading term, highest power first.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := 0; j < degree; j++ {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// Returns the Reed-Solomon error correction codewords of data: the remainder of its division by the generator polynomial.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// Multiplies two elements of GF(2^8), modulo the QR code polynomial x^8 + x^4 + x^3 + x^2 + 1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Accumulates bits, most significant first.
+type bitBuffer []bool
+
+// Appends the lowest n bits of value.
+func (bits *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bits = append(*bits, (value>>i)&1 != 0)
+	}
+}
+
+// Packs the bits into bytes; the length must be a multiple of 8.
+func (bits bitBuffer) bytes() []byte {
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			result[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return result
+}
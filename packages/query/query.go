@@ -0,0 +1,469 @@
+// Implements a small query language for filtering tickets, e.g. `status:"In Progress" assignee:me product:"Magic Wand" due<2w priority:High`.
+// A query is a whitespace-separated list of terms, all of which must hold for a ticket to match. Each term is either a bare word, matched against the title and description, or a field, an operator and a value:
+//   - title, description: ":" (contains), "=" and "!=" (whole text); case-insensitive
+//   - creator, assignee: ":", "=" and "!="; "me" stands for the current user and "none" for a blank assignee
+//   - team: ":", "=" and "!=", against the name of the team the ticket is assigned to; "none" stands for no team
+//   - status, product, category, priority: ":", "=" and "!=", against the names shown on screen; case-insensitive
+//   - id, hours: ":", "=", "!=", "<", "<=", ">" and ">="
+//   - due, start: as for id, against a date ("2021-06-30"), "today", or a time relative to now ("2w", "-3d"; units h, d, w, mo and y)
+//
+// Values containing spaces are double-quoted; several values separated by commas (e.g. `status:Paused,"Not Started"`) match any of them. A term preceded by "-" matches tickets for which it does not hold.
+// Parsing is separate from evaluation so that saved queries can be checked when saved, and evaluated later on behalf of whoever runs them.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"goInAction2/assignment/packages/dsa"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSyntax signals a query which could not be parsed.
+	ErrSyntax = errors.New("query syntax error")
+	// ErrUnknownField signals a term naming a field which does not exist.
+	ErrUnknownField = errors.New("unknown query field")
+	// ErrOperator signals a term using an operator its field does not support.
+	ErrOperator = errors.New("operator not supported by field")
+	// ErrValue signals a term with a value its field could not interpret, e.g. an unknown status.
+	ErrValue = errors.New("invalid value for field")
+)
+
+// Term is a single parsed condition of a query.
+type Term struct {
+	Negated bool
+	Field   string   // Blank for bare words
+	Op      string   // One of ":", "=", "!=", "<", "<=", ">" and ">="
+	Values  []string // Alternatives, any of which may match
+}
+
+// String renders a term back into query syntax.
+func (term Term) String() string {
+	values := make([]string, len(term.Values))
+	for i, value := range term.Values {
+		if value == "" || strings.ContainsAny(value, " \t,\"") {
+			value = strconv.Quote(value)
+		}
+		values[i] = value
+	}
+	s := strings.Join(values, ",")
+	if term.Field != "" {
+		s = term.Field + term.Op + s
+	}
+	if term.Negated {
+		s = "-" + s
+	}
+	return s
+}
+
+// Env holds what is needed to evaluate a query: who is running it, the current time, and the names of indexed ticket fields.
+type Env struct {
+	User       string
+	Now        time.Time
+	Products   []string
+	Statuses   []string
+	Categories []string
+	Priorities []string
+}
+
+// Filter reports whether a ticket matches a compiled query.
+type Filter func(ticket dsa.Ticket) bool
+
+type kind int
+
+const (
+	textField kind = iota
+	userField
+	enumField
+	numberField
+	dateField
+)
+
+var fields = map[string]kind{
+	"title":       textField,
+	"description": textField,
+	"creator":     userField,
+	"assignee":    userField,
+	"team":        userField,
+	"status":      enumField,
+	"product":     enumField,
+	"category":    enumField,
+	"priority":    enumField,
+	"id":          numberField,
+	"hours":       numberField,
+	"due":         dateField,
+	"start":       dateField,
+}
+
+// Operators, longest first so that "<=" is not read as "<".
+var operators = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+// Parse splits a query into terms, checking its syntax, fields and operators. Values are checked by Compile.
+func Parse(input string) ([]Term, error) {
+	var terms []Term
+	i := 0
+	for {
+		for i < len(input) && isSpace(input[i]) {
+			i++
+		}
+		if i >= len(input) {
+			return terms, nil
+		}
+
+		var term Term
+		if input[i] == '-' {
+			term.Negated = true
+			i++
+		}
+		// A field name is a run of letters followed directly by an operator; anything else is a bare word
+		j := i
+		for j < len(input) && isLetter(input[j]) {
+			j++
+		}
+		if op := operatorAt(input, j); j > i && op != "" {
+			term.Field = strings.ToLower(input[i:j])
+			term.Op = op
+			i = j + len(op)
+			k, ok := fields[term.Field]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownField, term.Field)
+			}
+			if (k == textField || k == userField || k == enumField) && strings.ContainsAny(op, "<>") {
+				return nil, fmt.Errorf("%w: %s%s", ErrOperator, term.Field, op)
+			}
+		}
+
+		values, next, err := parseValues(input, i, term.Field == "")
+		if err != nil {
+			return nil, err
+		}
+		if len(values) > 1 && strings.ContainsAny(term.Op, "<>") {
+			return nil, fmt.Errorf("%w: %s%s takes a single value", ErrOperator, term.Field, term.Op)
+		}
+		term.Values = values
+		terms = append(terms, term)
+		i = next
+	}
+}
+
+// Compile parses a query and resolves its values against an Env, returning a Filter matching tickets which satisfy every term.
+func Compile(input string, env Env) (Filter, error) {
+	terms, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]Filter, 0, len(terms))
+	for _, term := range terms {
+		filter, err := compileTerm(term, env)
+		if err != nil {
+			return nil, err
+		}
+		if term.Negated {
+			filter = negate(filter)
+		}
+		filters = append(filters, filter)
+	}
+	return func(ticket dsa.Ticket) bool {
+		for _, filter := range filters {
+			if !filter(ticket) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// Utility functions
+
+// Builds the filter for a single term, ignoring negation.
+func compileTerm(term Term, env Env) (Filter, error) {
+	var alternatives []Filter
+	for _, value := range term.Values {
+		var filter Filter
+		var err error
+		switch fields[term.Field] {
+		case textField:
+			filter = compileText(term.Field, term.Op, value)
+		case userField:
+			filter = compileUser(term.Field, term.Op, value, env)
+		case enumField:
+			filter, err = compileEnum(term.Field, term.Op, value, env)
+		case numberField:
+			filter, err = compileNumber(term.Field, term.Op, value)
+		case dateField:
+			filter, err = compileDate(term.Field, term.Op, value, env)
+		}
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, filter)
+	}
+
+	// "!=" with several values excludes all of them, rather than matching anything not equal to at least one
+	if term.Op == "!=" {
+		return func(ticket dsa.Ticket) bool {
+			for _, filter := range alternatives {
+				if !filter(ticket) {
+					return false
+				}
+			}
+			return true
+		}, nil
+	}
+	return func(ticket dsa.Ticket) bool {
+		for _, filter := range alternatives {
+			if filter(ticket) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileText(field, op, value string) Filter {
+	value = strings.ToLower(value)
+	get := func(ticket dsa.Ticket) []string {
+		switch field {
+		case "title":
+			return []string{ticket.Title}
+		case "description":
+			return []string{ticket.Description}
+		}
+		return []string{ticket.Title, ticket.Description}
+	}
+	return func(ticket dsa.Ticket) bool {
+		for _, text := range get(ticket) {
+			text = strings.ToLower(text)
+			if (op == "" || op == ":") && strings.Contains(text, value) {
+				return true
+			}
+			if op == "=" && text == value {
+				return true
+			}
+			if op == "!=" && text != value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func compileUser(field, op, value string, env Env) Filter {
+	switch strings.ToLower(value) {
+	case "me":
+		if field != "team" {
+			value = env.User
+		}
+	case "none":
+		value = ""
+	}
+	return func(ticket dsa.Ticket) bool {
+		name := ticket.Creator
+		switch field {
+		case "assignee":
+			name = ticket.Assignee
+		case "team":
+			name = ticket.Team
+		}
+		return strings.EqualFold(name, value) == (op != "!=")
+	}
+}
+
+func compileEnum(field, op, value string, env Env) (Filter, error) {
+	names := map[string][]string{
+		"status":   env.Statuses,
+		"product":  env.Products,
+		"category": env.Categories,
+		"priority": env.Priorities,
+	}[field]
+	index := -1
+	for i, name := range names {
+		if strings.EqualFold(name, value) {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: %s %q", ErrValue, field, value)
+	}
+	return func(ticket dsa.Ticket) bool {
+		got := map[string]int{
+			"status":   ticket.Status,
+			"product":  ticket.Product,
+			"category": ticket.Category,
+			"priority": ticket.Priority,
+		}[field]
+		return (got == index) == (op != "!=")
+	}, nil
+}
+
+func compileNumber(field, op, value string) (Filter, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %q", ErrValue, field, value)
+	}
+	return func(ticket dsa.Ticket) bool {
+		got := ticket.TicketID
+		if field == "hours" {
+			got = int64(ticket.EstHours)
+		}
+		return compare(op, compareInts(got, n))
+	}, nil
+}
+
+func compileDate(field, op, value string, env Env) (Filter, error) {
+	at, day, err := parseDate(value, env.Now)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %q", ErrValue, field, value)
+	}
+	return func(ticket dsa.Ticket) bool {
+		got := ticket.DueDate
+		if field == "start" {
+			got = ticket.StartDate
+		}
+		// Equality on a date compares calendar days; times relative to now are compared exactly
+		if day && (op == ":" || op == "=" || op == "!=") {
+			y1, m1, d1 := got.In(at.Location()).Date()
+			y2, m2, d2 := at.Date()
+			return (y1 == y2 && m1 == m2 && d1 == d2) == (op != "!=")
+		}
+		c := 0
+		if got.Before(at) {
+			c = -1
+		} else if got.After(at) {
+			c = 1
+		}
+		return compare(op, c)
+	}, nil
+}
+
+// Parses a date value, reporting whether it names a whole day (as opposed to a time relative to now).
+func parseDate(value string, now time.Time) (time.Time, bool, error) {
+	switch strings.ToLower(value) {
+	case "now":
+		return now, false, nil
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), true, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, true, nil
+	}
+
+	units := []struct {
+		suffix string
+		apply  func(n int) time.Time
+	}{
+		{"mo", func(n int) time.Time { return now.AddDate(0, n, 0) }},
+		{"h", func(n int) time.Time { return now.Add(time.Duration(n) * time.Hour) }},
+		{"d", func(n int) time.Time { return now.AddDate(0, 0, n) }},
+		{"w", func(n int) time.Time { return now.AddDate(0, 0, 7*n) }},
+		{"y", func(n int) time.Time { return now.AddDate(n, 0, 0) }},
+	}
+	lower := strings.ToLower(value)
+	for _, unit := range units {
+		if !strings.HasSuffix(lower, unit.suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(lower[:len(lower)-len(unit.suffix)], "+"))
+		if err != nil {
+			break
+		}
+		return unit.apply(n), false, nil
+	}
+	return time.Time{}, false, ErrValue
+}
+
+// Reads one or more comma-separated values starting at i, returning them and the index just past them.
+// Bare words (those not following a field) may not contain commas, so that ordinary punctuation is searched for as typed.
+func parseValues(input string, i int, bare bool) ([]string, int, error) {
+	var values []string
+	for {
+		var value string
+		if i < len(input) && input[i] == '"' {
+			j := i + 1
+			var sb strings.Builder
+			for j < len(input) && input[j] != '"' {
+				if input[j] == '\\' && j+1 < len(input) {
+					j++
+				}
+				sb.WriteByte(input[j])
+				j++
+			}
+			if j >= len(input) {
+				return nil, 0, fmt.Errorf("%w: unterminated quote at position %d", ErrSyntax, i+1)
+			}
+			value, i = sb.String(), j+1
+		} else {
+			j := i
+			for j < len(input) && !isSpace(input[j]) && (bare || input[j] != ',') {
+				j++
+			}
+			value, i = input[i:j], j
+		}
+		if value == "" && !bare {
+			return nil, 0, fmt.Errorf("%w: missing value at position %d", ErrSyntax, i+1)
+		}
+		values = append(values, value)
+		if bare || i >= len(input) || input[i] != ',' {
+			break
+		}
+		i++
+	}
+	if i < len(input) && !isSpace(input[i]) {
+		return nil, 0, fmt.Errorf("%w: unexpected %q at position %d", ErrSyntax, input[i], i+1)
+	}
+	return values, i, nil
+}
+
+// Returns the operator starting at position i, if any.
+func operatorAt(input string, i int) string {
+	for _, op := range operators {
+		if strings.HasPrefix(input[i:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// Applies a comparison operator to the result of comparing a ticket's value with the query's (-1, 0 or 1).
+func compare(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "!=":
+		return c != 0
+	}
+	return c == 0
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func negate(filter Filter) Filter {
+	return func(ticket dsa.Ticket) bool {
+		return !filter(ticket)
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,203 @@
+package query
+
+import (
+	"errors"
+	"goInAction2/assignment/packages/dsa"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+var env = Env{
+	User:       "alice",
+	Now:        time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	Products:   []string{"Magic Wand", "Broom"},
+	Statuses:   []string{"Not Started", "In Progress", "Paused", "Done"},
+	Categories: []string{"Bug", "Feature"},
+	Priorities: []string{"High", "Medium", "Low"},
+}
+
+var tickets = []dsa.Ticket{
+	{
+		TicketID: 1, Product: 0, Status: 1, Category: 0, Priority: 0, EstHours: 4,
+		StartDate: date(2024, 2, 20, 9), DueDate: date(2024, 3, 5, 17),
+		Creator: "bob", Assignee: "alice", Team: "Wizards",
+		Title: "Wand sparks", Description: "Sparks fly when it is waved",
+	},
+	{
+		TicketID: 2, Product: 1, Status: 0, Category: 0, Priority: 1, EstHours: 10,
+		StartDate: date(2024, 3, 1, 9), DueDate: date(2024, 3, 20, 17),
+		Creator: "alice", Assignee: "", Team: "",
+		Title: "Broom drifts left", Description: "Pulls to the left in a crosswind",
+	},
+	{
+		TicketID: 3, Product: 1, Status: 2, Category: 1, Priority: 2, EstHours: 20,
+		StartDate: date(2024, 1, 10, 9), DueDate: date(2024, 2, 25, 17),
+		Creator: "carol", Assignee: "bob", Team: "Fliers",
+		Title: `Add "turbo" mode`, Description: "Faster brooms",
+	},
+	{
+		TicketID: 4, Product: 0, Status: 3, Category: 1, Priority: 2, EstHours: 1,
+		StartDate: date(2024, 2, 28, 9), DueDate: date(2024, 3, 1, 12),
+		Creator: "alice", Assignee: "alice", Team: "Wizards",
+		Title: "In Progress docs", Description: "Document the progress bar",
+	},
+}
+
+func date(year int, month time.Month, day, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		terms []Term
+	}{
+		{"", nil},
+		{"sparks", []Term{{Values: []string{"sparks"}}}},
+		{"-sparks", []Term{{Negated: true, Values: []string{"sparks"}}}},
+		{`  bug   -status:"In Progress" `, []Term{
+			{Values: []string{"bug"}},
+			{Negated: true, Field: "status", Op: ":", Values: []string{"In Progress"}},
+		}},
+		{`Status:Paused,"Not Started"`, []Term{{Field: "status", Op: ":", Values: []string{"Paused", "Not Started"}}}},
+		{`title:"say \"hi\""`, []Term{{Field: "title", Op: ":", Values: []string{`say "hi"`}}}},
+		{"a,b", []Term{{Values: []string{"a,b"}}}}, // Bare words keep their commas
+		{`"in progress"`, []Term{{Values: []string{"in progress"}}}},
+		{"due<=-3d hours>5 id!=7", []Term{
+			{Field: "due", Op: "<=", Values: []string{"-3d"}},
+			{Field: "hours", Op: ">", Values: []string{"5"}},
+			{Field: "id", Op: "!=", Values: []string{"7"}},
+		}},
+		{"assignee=me", []Term{{Field: "assignee", Op: "=", Values: []string{"me"}}}},
+		{"wand-sparks 2.5", []Term{{Values: []string{"wand-sparks"}}, {Values: []string{"2.5"}}}},
+	}
+	for _, test := range tests {
+		terms, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.input, terms, test.terms)
+		}
+
+		// Terms render back into a query which parses the same
+		for _, term := range terms {
+			again, err := Parse(term.String())
+			if err != nil || len(again) != 1 || !reflect.DeepEqual(again[0], term) {
+				t.Errorf("Parse(%q) = %+v, %v, want %+v", term.String(), again, err, term)
+			}
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []int64
+	}{
+		{"", []int64{1, 2, 3, 4}},
+
+		// Bare words, quoting and negation
+		{"sparks", []int64{1}},
+		{"BROOM", []int64{2, 3}},
+		{`"in progress"`, []int64{4}},
+		{"-broom", []int64{1, 4}},
+		{`turbo`, []int64{3}},
+		{`title:"\"turbo\""`, []int64{3}},
+		{`title="wand sparks"`, []int64{1}},
+		{`description!="faster brooms"`, []int64{1, 2, 4}},
+		{"title:wand sparks", []int64{1}},
+
+		// Enums, by name shown on screen
+		{`status:"In Progress"`, []int64{1}},
+		{`status:paused,"not started"`, []int64{2, 3}},
+		{"-status:done", []int64{1, 2, 3}},
+		{"status!=done,paused", []int64{1, 2}},
+		{"priority=high", []int64{1}},
+		{`product:"magic wand" category:feature`, []int64{4}},
+
+		// Users and teams
+		{"assignee:me", []int64{1, 4}},
+		{"-assignee:me", []int64{2, 3}},
+		{"assignee:none", []int64{2}},
+		{"creator:ALICE", []int64{2, 4}},
+		{"creator!=alice", []int64{1, 3}},
+		{"team:wizards", []int64{1, 4}},
+		{"team:none", []int64{2}},
+		{"team:me", nil}, // "me" is a user, not a team
+
+		// Numbers
+		{"id>2", []int64{3, 4}},
+		{"id<=2", []int64{1, 2}},
+		{"id!=3", []int64{1, 2, 4}},
+		{"id:1,3", []int64{1, 3}},
+		{"hours>=10", []int64{2, 3}},
+		{"hours<4", []int64{4}},
+		{"-hours>4", []int64{1, 4}},
+
+		// Dates, absolute and relative to now
+		{"due<2w", []int64{1, 3, 4}},
+		{"due<now", []int64{3}},
+		{"due>=-3d", []int64{1, 2, 4}},
+		{"due<+5d", []int64{1, 3, 4}},
+		{"due<72h", []int64{3, 4}},
+		{"due>1mo", nil},
+		{"start<-1y", nil},
+		{"due:today", []int64{4}},
+		{"due:2024-03-05", []int64{1}},
+		{"due!=2024-03-05", []int64{2, 3, 4}},
+		{"start<2024-02-01", []int64{3}},
+		{"start>=today", []int64{2}},
+	}
+	for _, test := range tests {
+		filter, err := Compile(test.input, env)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", test.input, err)
+			continue
+		}
+		var got []int64
+		for _, ticket := range tickets {
+			if filter(ticket) {
+				got = append(got, ticket.TicketID)
+			}
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%q matched tickets %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		err     error
+		message string
+	}{
+		{`status:"In Progress`, ErrSyntax, "query syntax error: unterminated quote at position 8"},
+		{"status:", ErrSyntax, "query syntax error: missing value at position 8"},
+		{"status:Paused,", ErrSyntax, "query syntax error: missing value at position 15"},
+		{`status:"Done"x`, ErrSyntax, `query syntax error: unexpected 'x' at position 14`},
+		{"colour:red", ErrUnknownField, `unknown query field: "colour"`},
+		{"http://example.com", ErrUnknownField, `unknown query field: "http"`},
+		{"status<Done", ErrOperator, "operator not supported by field: status<"},
+		{"assignee>=me", ErrOperator, "operator not supported by field: assignee>="},
+		{"title<b", ErrOperator, "operator not supported by field: title<"},
+		{"id<1,2", ErrOperator, "operator not supported by field: id< takes a single value"},
+		{"status:Closed", ErrValue, `invalid value for field: status "Closed"`},
+		{`product:Wand`, ErrValue, `invalid value for field: product "Wand"`},
+		{"id:abc", ErrValue, `invalid value for field: id "abc"`},
+		{"hours>1.5", ErrValue, `invalid value for field: hours "1.5"`},
+		{"due<2x", ErrValue, `invalid value for field: due "2x"`},
+		{"due<w", ErrValue, `invalid value for field: due "w"`},
+		{"start:2024-13-01", ErrValue, `invalid value for field: start "2024-13-01"`},
+	}
+	for _, test := range tests {
+		_, err := Compile(test.input, env)
+		if !errors.Is(err, test.err) || err.Error() != test.message {
+			t.Errorf("Compile(%q): error %v, want %q", test.input, err, test.message)
+		}
+	}
+}
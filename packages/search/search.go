@@ -0,0 +1,167 @@
+// Implements an inverted index for full-text search over tickets and submissions.
+// Each indexed Document is split into tokens, which are lower-cased, stripped of common stop words and reduced to their stems (so that "crashes", "crashed" and "crashing" all match "crash").
+// The index maps every stem to the documents containing it, and is updated one document at a time as tickets change, rather than rebuilt for each search.
+// Results are ranked by TF-IDF, with terms found in a document's title weighted above those in its body.
+// Indexes are safe for concurrent use via the inclusion of a Mutex with each struct.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	titleWeight = 3 // Occurrences of a term in a title count this many times over one in the body
+	bodyWeight  = 1
+)
+
+// Document is the searchable text of a single ticket or submission.
+type Document struct {
+	Title string
+	Body  []string // Description, comments etc.
+}
+
+// Result is a single ranked search hit.
+type Result struct {
+	ID    int64
+	Score float64
+}
+
+// Index is an inverted index from stemmed terms to the documents containing them.
+type Index struct {
+	mu       sync.Mutex
+	postings map[string]map[int64]int // term -> document ID -> weighted term frequency
+	docs     map[int64]map[string]int // document ID -> term -> weighted term frequency, used to unindex a document
+	lengths  map[int64]int            // document ID -> total weighted terms
+}
+
+// NewIndex creates an empty Index, and returns its pointer.
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[int64]int),
+		docs:     make(map[int64]map[string]int),
+		lengths:  make(map[int64]int),
+	}
+}
+
+// Update indexes a document under the given ID, replacing anything previously indexed under it.
+func (ix *Index) Update(id int64, doc Document) {
+	terms := make(map[string]int)
+	length := 0
+	for _, term := range Tokenize(doc.Title) {
+		terms[term] += titleWeight
+		length += titleWeight
+	}
+	for _, text := range doc.Body {
+		for _, term := range Tokenize(text) {
+			terms[term] += bodyWeight
+			length += bodyWeight
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+	if len(terms) == 0 {
+		return
+	}
+	for term, freq := range terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[int64]int)
+		}
+		ix.postings[term][id] = freq
+	}
+	ix.docs[id] = terms
+	ix.lengths[id] = length
+}
+
+// Remove unindexes the document with the given ID, if any.
+func (ix *Index) Remove(id int64) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+// Len returns the number of documents indexed.
+func (ix *Index) Len() int {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return len(ix.docs)
+}
+
+// Search returns the documents matching any term of the query, best match first.
+// Documents are scored by the sum over matching terms of term frequency (normalized by document length) times inverse document frequency, so documents matching more, and rarer, terms rank higher.
+func (ix *Index) Search(query string) []Result {
+	terms := Tokenize(query)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	total := float64(len(ix.docs))
+	scores := make(map[int64]float64)
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		posting := ix.postings[term]
+		if len(posting) == 0 {
+			continue
+		}
+		idf := math.Log(1 + total/float64(len(posting)))
+		for id, freq := range posting {
+			scores[id] += float64(freq) / math.Sqrt(float64(ix.lengths[id])) * idf
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
+
+// Tokenize splits text into lower-cased, stemmed terms, dropping stop words.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		terms = append(terms, Stem(word))
+	}
+	return terms
+}
+
+// Utility functions
+
+// Unindexes a document. Assumes the lock is held.
+func (ix *Index) remove(id int64) {
+	for term := range ix.docs[id] {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+	delete(ix.docs, id)
+	delete(ix.lengths, id)
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "he": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"were": true, "will": true, "with": true,
+}
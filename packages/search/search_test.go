@@ -0,0 +1,109 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+// Returns the IDs of a list of results, in order.
+func ids(results []Result) []int64 {
+	result := []int64{}
+	for _, r := range results {
+		result = append(result, r.ID)
+	}
+	return result
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("The wand CRASHES, and crashed; it's crashing in v2!")
+	want := []string{"wand", "crash", "crash", "s", "crash", "v2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateReplacesPostings(t *testing.T) {
+	ix := NewIndex()
+	ix.Update(1, Document{Title: "Wand sparks", Body: []string{"Sparks fly when waved"}})
+	ix.Update(2, Document{Title: "Broom drifts"})
+
+	ix.Update(1, Document{Title: "Wand hums", Body: []string{"A low hum"}})
+	if got := ids(ix.Search("sparks")); len(got) != 0 {
+		t.Errorf("search for a term no longer in the document = %v, want none", got)
+	}
+	if got := ids(ix.Search("humming")); !slices.Equal(got, []int64{1}) {
+		t.Errorf("search for a term added by Update = %v, want [1]", got)
+	}
+	if ix.Len() != 2 {
+		t.Errorf("Len = %d after updating a document, want 2", ix.Len())
+	}
+	if _, ok := ix.postings[Stem("sparks")]; ok {
+		t.Errorf("a term found only in the old version of a document still has postings")
+	}
+
+	// A document left with no terms is unindexed
+	ix.Update(2, Document{Title: "the and of"})
+	if ix.Len() != 1 || len(ix.Search("broom")) != 0 {
+		t.Errorf("document updated to stop words only is still indexed")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	ix := NewIndex()
+	ix.Update(1, Document{Title: "Wand sparks"})
+	ix.Update(2, Document{Title: "Wand hums"})
+
+	ix.Remove(1)
+	if got := ids(ix.Search("wand sparks")); !slices.Equal(got, []int64{2}) {
+		t.Errorf("search after Remove = %v, want [2]", got)
+	}
+	if ix.Len() != 1 {
+		t.Errorf("Len = %d after Remove, want 1", ix.Len())
+	}
+	if _, ok := ix.postings["spark"]; ok {
+		t.Errorf("a term found only in a removed document still has postings")
+	}
+	ix.Remove(1)
+	ix.Remove(99)
+	if ix.Len() != 1 {
+		t.Errorf("Len = %d after removing documents not indexed, want 1", ix.Len())
+	}
+}
+
+func TestSearchOrder(t *testing.T) {
+	ix := NewIndex()
+	ix.Update(1, Document{Title: "Broom drifts left", Body: []string{"The wand is fine"}})
+	ix.Update(2, Document{Title: "Wand sparks", Body: []string{"Sparks fly from the wand"}})
+	ix.Update(3, Document{Title: "Wand sparks when cold"})
+	ix.Update(4, Document{Title: "Cauldron leaks", Body: []string{"Nothing to do with any wand", "or with sparks"}})
+	ix.Update(5, Document{Title: "Hat too small"})
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"sparks", []int64{2, 3, 4}},  // Title above body; more occurrences above fewer
+		{"wand", []int64{2, 3, 1, 4}}, // 1 and 4 score the same, and are ordered by ID
+		{"sparking wands", []int64{2, 3, 4, 1}},
+		{"hat", []int64{5}},
+		{"the", []int64{}}, // Stop words match nothing
+		{"dragon", []int64{}},
+	}
+	for _, test := range tests {
+		results := ix.Search(test.query)
+		if got := ids(results); !slices.Equal(got, test.want) {
+			t.Errorf("Search(%q) = %v, want %v", test.query, got, test.want)
+		}
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Errorf("Search(%q): result %d scores %v, above %v before it", test.query, i, results[i].Score, results[i-1].Score)
+			}
+		}
+	}
+
+	// Ties are broken by ID
+	ix.Update(6, Document{Title: "Hat too small"})
+	if got := ids(ix.Search("hat")); !slices.Equal(got, []int64{5, 6}) {
+		t.Errorf("Search for tied documents = %v, want [5 6]", got)
+	}
+}
@@ -0,0 +1,69 @@
+package search
+
+import "testing"
+
+func TestStem(t *testing.T) {
+	// Pairs from Porter's paper and the reference vocabulary
+	tests := []struct {
+		word, stem string
+	}{
+		// Step 1a: plurals
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"ties", "ti"},
+		{"caress", "caress"},
+		{"cats", "cat"},
+
+		// Step 1b: -ed and -ing
+		{"feed", "feed"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"bled", "bled"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"conflated", "conflat"},
+		{"troubled", "troubl"},
+		{"sized", "size"},
+		{"hopping", "hop"},
+		{"tanned", "tan"},
+		{"falling", "fall"},
+		{"hissing", "hiss"},
+		{"fizzed", "fizz"},
+		{"failing", "fail"},
+		{"filing", "file"},
+
+		// Step 1c: y to i
+		{"happy", "happi"},
+		{"sky", "sky"},
+
+		// Steps 2 to 4: derivational suffixes
+		{"relational", "relat"},
+		{"conditional", "condit"},
+		{"generalization", "gener"},
+		{"oscillators", "oscil"},
+		{"hopeful", "hope"},
+		{"goodness", "good"},
+		{"electrical", "electr"},
+		{"adjustment", "adjust"},
+		{"crashes", "crash"},
+		{"crashed", "crash"},
+		{"crashing", "crash"},
+
+		// Step 5: final e and ll
+		{"probate", "probat"},
+		{"rate", "rate"},
+		{"cease", "ceas"},
+		{"controlling", "control"},
+		{"roll", "roll"},
+
+		// Left alone
+		{"is", "is"},
+		{"café", "café"},
+		{"v2", "v2"},
+	}
+	for _, test := range tests {
+		if got := Stem(test.word); got != test.stem {
+			t.Errorf("Stem(%q) = %q, want %q", test.word, got, test.stem)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Implements a broker for server-sent events, used to push submission and ticket changes to connected browsers as they happen.
+// Each connected browser subscribes as a Client on behalf of a user; events are addressed to specific usernames and/or to all admin users, and are only delivered to clients allowed to see them.
+// Brokers are safe for concurrent use via the inclusion of a Mutex with each struct.
+package sse
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	buffered = 16 // Events buffered per client before further events to that client are dropped
+)
+
+// Event is a message pushed to subscribed clients.
+type Event struct {
+	Name   string   // Event name, e.g. "submission.created"
+	Data   string   // Event payload, typically JSON
+	Users  []string // Usernames the event concerns
+	Admins bool     // If true, the event is also delivered to every admin user
+}
+
+// Client is a single subscribed browser connection.
+type Client struct {
+	User   string
+	Admin  bool
+	Events chan Event
+}
+
+// Broker tracks subscribed clients and fans events out to them.
+type Broker struct {
+	mu      sync.Mutex
+	clients map[*Client]bool
+}
+
+// NewBroker creates a new Broker with no subscribed clients, and returns its pointer.
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[*Client]bool)}
+}
+
+// Subscribe registers a new client for a given user.
+func (b *Broker) Subscribe(user string, admin bool) *Client {
+	client := &Client{
+		User:   user,
+		Admin:  admin,
+		Events: make(chan Event, buffered),
+	}
+	b.mu.Lock()
+	b.clients[client] = true
+	b.mu.Unlock()
+	return client
+}
+
+// Unsubscribe removes a client from the broker and closes its Events channel.
+func (b *Broker) Unsubscribe(client *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[client] {
+		delete(b.clients, client)
+		close(client.Events)
+	}
+}
+
+// Publish delivers an event to every client allowed to see it. Slow clients never block the publisher; events which do not fit in a client's buffer are dropped for that client.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for client := range b.clients {
+		if !event.VisibleTo(client) {
+			continue
+		}
+		select {
+		case client.Events <- event:
+		default:
+		}
+	}
+}
+
+// Clients returns the number of currently subscribed clients.
+func (b *Broker) Clients() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.clients)
+}
+
+// VisibleTo reports whether a client is allowed to receive an event.
+func (event Event) VisibleTo(client *Client) bool {
+	if event.Admins && client.Admin {
+		return true
+	}
+	for _, user := range event.Users {
+		if user == client.User {
+			return true
+		}
+	}
+	return false
+}
+
+// Write formats an event in the text/event-stream wire format.
+func Write(w io.Writer, event Event) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "event: %s\n", event.Name)
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Fprintf(&sb, "data: %s\n", line)
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Comment writes an SSE comment line, which clients ignore; used to keep idle connections from timing out.
+func Comment(w io.Writer, text string) error {
+	_, err := fmt.Fprintf(w, ": %s\n\n", text)
+	return err
+}
@@ -12,8 +12,8 @@ import (
 
 // Testdata is a struct used to contain submissions, users, ticketlog, and products which would be populated when demo mode is activated.
 type Testdata struct {
-	Testsubs      *[]dsa.Ticket
-	Testusers     *[]*dsa.UserNode
+	Testsubs      *dsa.Submissionqueue
+	Testusers     *dsa.Userlog
 	Testticketlog *dsa.AVLtree
 	Testproducts  *[]string
 }
@@ -29,7 +29,7 @@ func Demomode(ticketIDcounter *int64, testdataloader chan Testdata, wg *sync.Wai
 		Testproducts:  nil,
 	}
 
-	testload.Testsubs = &[]dsa.Ticket{}
+	testload.Testsubs = dsa.NewSubmissionqueue()
 	testload.Testusers = dsa.NewHT()
 	testload.Testticketlog = dsa.NewAVLT(dsa.ByTicketID)
 	testload.Testproducts = &([]string{})
@@ -37,23 +37,29 @@ func Demomode(ticketIDcounter *int64, testdataloader chan Testdata, wg *sync.Wai
 	// Users: 1 admin user, 2 test users
 	pw, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.MinCost)
 	adminuser := dsa.User{
-		Name:  "admin",
-		Pw:    pw,
-		Admin: true,
+		Name:   "admin",
+		Pw:     pw,
+		Role:   dsa.RoleAdmin,
+		Email:  "admin@example.com",
+		Notify: dsa.NotifyAll,
 	}
 
 	pw, _ = bcrypt.GenerateFromPassword([]byte("user1"), bcrypt.MinCost)
 	user1 := dsa.User{
-		Name:  "user1",
-		Pw:    pw,
-		Admin: false,
+		Name:   "user1",
+		Pw:     pw,
+		Role:   dsa.RoleDeveloper,
+		Email:  "user1@example.com",
+		Notify: dsa.NotifyAll,
 	}
 
 	pw, _ = bcrypt.GenerateFromPassword([]byte("user2"), bcrypt.MinCost)
 	user2 := dsa.User{
-		Name:  "user2",
-		Pw:    pw,
-		Admin: false,
+		Name:   "user2",
+		Pw:     pw,
+		Role:   dsa.RoleDeveloper,
+		Email:  "user2@example.com",
+		Notify: dsa.NotifyAll,
 	}
 
 	dsa.AddUser(testload.Testusers, adminuser)
@@ -237,10 +243,10 @@ func Demomode(ticketIDcounter *int64, testdataloader chan Testdata, wg *sync.Wai
 	}
 	atomic.AddInt64(ticketIDcounter, 1)
 
-	dsa.Addsubmission(testload.Testsubs, sub1)
-	dsa.Addsubmission(testload.Testsubs, sub2)
-	dsa.Addsubmission(testload.Testsubs, sub3)
-	dsa.Addsubmission(testload.Testsubs, sub4)
+	testload.Testsubs.Push(sub1)
+	testload.Testsubs.Push(sub2)
+	testload.Testsubs.Push(sub3)
+	testload.Testsubs.Push(sub4)
 
 	testdataloader <- testload
 }
@@ -0,0 +1,174 @@
+// Implements a limiter of failed attempts, used to slow down password guessing at login.
+// Failures are counted per key, such as a username or client address. After Free failures, each further attempt on a key must wait a delay which doubles with every failure, from Base up to Max; after LockAfter failures the key is locked out for LockFor.
+// A key's failures are forgotten once Forget has passed since its last failure and it is not locked, so that an occasional typo does not add up over weeks; they are also cleared by Reset, as after a successful login, and by Unlock.
+// The current time is read through a replaceable Now function, so that delays can be checked deterministically against a fixed clock.
+// Limiters are safe for concurrent use via the inclusion of a Mutex with each struct.
+package throttle
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Lock describes a key which is currently throttled or locked out.
+type Lock struct {
+	Key      string
+	Failures int
+	Until    time.Time // Attempts are refused until this time
+	Locked   bool      // True if locked out after LockAfter failures, rather than throttled
+}
+
+// Limiter counts failed attempts per key, and decides how long each key must wait before its next attempt.
+type Limiter struct {
+	Free      int              // Failures allowed before attempts are delayed
+	Base      time.Duration    // Delay after the first failure beyond Free; doubles with each further failure
+	Max       time.Duration    // Longest delay between attempts, short of lockout
+	LockAfter int              // Failures after which the key is locked out; zero disables lockout
+	LockFor   time.Duration    // Length of a lockout
+	Forget    time.Duration    // Failures are forgotten this long after the last one, unless locked out
+	Now       func() time.Time // Clock used by the limiter; replaceable for deterministic checks
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	swept   time.Time // Time of the last sweep of forgotten entries
+}
+
+// Failures recorded for a single key.
+type entry struct {
+	failures int
+	last     time.Time // Time of the latest failure
+	until    time.Time // Attempts are refused until this time
+	locked   bool
+}
+
+// New creates a Limiter with the given backoff, and returns its pointer. Lockout is disabled until LockAfter and LockFor are set.
+func New(free int, base, max time.Duration) *Limiter {
+	return &Limiter{
+		Free:    free,
+		Base:    base,
+		Max:     max,
+		Forget:  24 * time.Hour,
+		Now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Wait returns how long a key must wait before its next attempt, or zero if it may try now.
+func (l *Limiter) Wait(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	e := l.lookup(key, now)
+	if e == nil || !now.Before(e.until) {
+		return 0
+	}
+	return e.until.Sub(now)
+}
+
+// Fail records a failed attempt for a key, returning true if it locked the key out.
+func (l *Limiter) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	if now.Sub(l.swept) >= time.Minute {
+		l.sweep(now)
+	}
+	e := l.lookup(key, now)
+	if e == nil {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.last = now
+	if l.LockAfter > 0 && e.failures >= l.LockAfter {
+		if e.locked {
+			return false
+		}
+		e.locked = true
+		e.until = now.Add(l.LockFor)
+		return true
+	}
+	if over := e.failures - l.Free; over > 0 {
+		delay := l.Max
+		if over <= 30 && l.Base<<(over-1) < l.Max {
+			delay = l.Base << (over - 1)
+		}
+		e.until = now.Add(delay)
+	}
+	return false
+}
+
+// Reset forgets the failures of a key, as after a successful attempt. Has no effect on a key which is locked out.
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e := l.lookup(key, l.Now()); e != nil && !e.locked {
+		delete(l.entries, key)
+	}
+}
+
+// Unlock forgets the failures of a key, ending any delay or lockout. Returns false if the key had none.
+func (l *Limiter) Unlock(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lookup(key, l.Now()) == nil {
+		return false
+	}
+	delete(l.entries, key)
+	return true
+}
+
+// Locks returns the keys which are currently throttled or locked out, sorted by key.
+func (l *Limiter) Locks() []Lock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	l.sweep(now)
+	locks := []Lock{}
+	for key, e := range l.entries {
+		if now.Before(e.until) {
+			locks = append(locks, Lock{Key: key, Failures: e.failures, Until: e.until, Locked: e.locked})
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+	return locks
+}
+
+// Utility functions
+
+// Returns the entry of a key, or nil if it has none or its failures have been forgotten. Assumes the lock is held.
+func (l *Limiter) lookup(key string, now time.Time) *entry {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if l.expired(e, now) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+// Reports whether an entry's failures are to be forgotten: its lockout is over, or it is not locked out and its last failure is older than Forget.
+func (l *Limiter) expired(e *entry, now time.Time) bool {
+	if e.locked {
+		return !now.Before(e.until)
+	}
+	return !now.Before(e.last.Add(l.Forget)) && !now.Before(e.until)
+}
+
+// Discards the entries of every key whose failures are to be forgotten, so that the limiter does not grow without bound. Fail sweeps at most once a minute. Assumes the lock is held.
+func (l *Limiter) sweep(now time.Time) {
+	for key, e := range l.entries {
+		if l.expired(e, now) {
+			delete(l.entries, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,212 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+// Builds a limiter with a clock the test moves by hand.
+func newFixture(now *time.Time) *Limiter {
+	l := New(2, time.Second, 10*time.Second)
+	l.LockAfter = 10
+	l.LockFor = 15 * time.Minute
+	l.Forget = time.Hour
+	l.Now = func() time.Time { return *now }
+	return l
+}
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := newFixture(&now)
+
+	waits := []time.Duration{
+		0, 0, // Free failures
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, // Doubling from Base
+		10 * time.Second, 10 * time.Second, // Capped at Max
+	}
+	for i, want := range waits {
+		if l.Fail("alice") {
+			t.Fatalf("failure %d locked the key out", i+1)
+		}
+		if got := l.Wait("alice"); got != want {
+			t.Errorf("after %d failures: wait %v, want %v", i+1, got, want)
+		}
+	}
+
+	// The delay runs down with the clock
+	now = now.Add(4 * time.Second)
+	if got := l.Wait("alice"); got != 6*time.Second {
+		t.Errorf("4s into a 10s delay: wait %v, want 6s", got)
+	}
+	if got := l.Wait("bob"); got != 0 {
+		t.Errorf("key with no failures: wait %v, want 0", got)
+	}
+}
+
+func TestBackoffShiftGuard(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := New(0, time.Second, 1000*time.Hour)
+	l.Now = func() time.Time { return now }
+
+	// Far beyond 30 failures, Base shifted by the count would overflow; the delay must stay at Max
+	previous := time.Duration(0)
+	for i := 1; i <= 100; i++ {
+		l.Fail("alice")
+		got := l.Wait("alice")
+		if got < previous || got > l.Max {
+			t.Fatalf("after %d failures: wait %v, previous %v, Max %v", i, got, previous, l.Max)
+		}
+		previous = got
+	}
+	if previous != l.Max {
+		t.Errorf("after 100 failures: wait %v, want Max %v", previous, l.Max)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	l := newFixture(&now)
+
+	for i := 1; i < l.LockAfter; i++ {
+		if l.Fail("alice") {
+			t.Fatalf("failure %d of %d locked the key out", i, l.LockAfter)
+		}
+	}
+	if !l.Fail("alice") {
+		t.Fatalf("failure %d did not lock the key out", l.LockAfter)
+	}
+	if l.Fail("alice") {
+		t.Errorf("a failure while locked out reported a new lockout")
+	}
+	if got := l.Wait("alice"); got != l.LockFor {
+		t.Errorf("locked out: wait %v, want %v", got, l.LockFor)
+	}
+	locks := l.Locks()
+	if len(locks) != 1 || locks[0].Key != "alice" || !locks[0].Locked || !locks[0].Until.Equal(start.Add(l.LockFor)) {
+		t.Errorf("Locks = %+v, want alice locked until %v", locks, start.Add(l.LockFor))
+	}
+
+	// A successful attempt cannot clear a lockout
+	l.Reset("alice")
+	if got := l.Wait("alice"); got != l.LockFor {
+		t.Errorf("after Reset while locked out: wait %v, want %v", got, l.LockFor)
+	}
+
+	// Once the lockout is over, its failures are forgotten
+	now = start.Add(l.LockFor)
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("after the lockout: wait %v, want 0", got)
+	}
+	l.Fail("alice")
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("first failure after the lockout: wait %v, want 0", got)
+	}
+}
+
+func TestReset(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := newFixture(&now)
+
+	for i := 0; i < 4; i++ {
+		l.Fail("alice")
+	}
+	l.Reset("alice")
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("after Reset: wait %v, want 0", got)
+	}
+	l.Fail("alice")
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("first failure after Reset: wait %v, want 0", got)
+	}
+}
+
+func TestForget(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	l := newFixture(&now)
+
+	for i := 0; i < 4; i++ {
+		l.Fail("alice")
+	}
+	now = start.Add(l.Forget - time.Second)
+	l.Fail("alice")
+	if got := l.Wait("alice"); got != 4*time.Second {
+		t.Errorf("fifth failure within Forget: wait %v, want 4s", got)
+	}
+
+	// Forget counts from the latest failure
+	now = now.Add(l.Forget)
+	l.Fail("alice")
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("first failure after Forget: wait %v, want 0", got)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	now := start
+	l := newFixture(&now)
+	l.LockFor = 3 * l.Forget
+
+	for _, key := range []string{"alice", "bob", "carol"} {
+		l.Fail(key)
+	}
+	for i := 0; i < l.LockAfter; i++ {
+		l.Fail("mallory")
+	}
+
+	// Keys which are never looked up again are dropped by the next Fail after Forget, except one still locked out
+	now = start.Add(l.Forget)
+	l.Fail("dave")
+	if len(l.entries) != 2 || l.entries["dave"] == nil || l.entries["mallory"] == nil {
+		t.Errorf("after the sweep the limiter holds %v, want dave and mallory", keys(l))
+	}
+
+	// Fail sweeps at most once a minute
+	now = now.Add(l.Forget - 30*time.Second)
+	l.Fail("erin")
+	now = now.Add(30 * time.Second)
+	l.Fail("frank")
+	if l.entries["dave"] == nil {
+		t.Errorf("sweep ran within a minute of the last one: limiter holds %v", keys(l))
+	}
+	now = now.Add(30 * time.Second)
+	l.Fail("grace")
+	if len(l.entries) != 4 || l.entries["dave"] != nil {
+		t.Errorf("limiter holds %v, want erin, frank, grace and mallory", keys(l))
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	l := newFixture(&now)
+
+	for i := 0; i < l.LockAfter; i++ {
+		l.Fail("alice")
+	}
+	if !l.Unlock("alice") {
+		t.Fatalf("Unlock of a locked out key = false")
+	}
+	if got := l.Wait("alice"); got != 0 {
+		t.Errorf("after Unlock: wait %v, want 0", got)
+	}
+	if len(l.Locks()) != 0 {
+		t.Errorf("after Unlock: Locks = %+v, want none", l.Locks())
+	}
+	if l.Unlock("alice") {
+		t.Errorf("second Unlock = true")
+	}
+	if l.Unlock("bob") {
+		t.Errorf("Unlock of a key with no failures = true")
+	}
+}
+
+// Returns the keys a limiter holds entries for.
+func keys(l *Limiter) []string {
+	result := []string{}
+	for key := range l.entries {
+		result = append(result, key)
+	}
+	return result
+}
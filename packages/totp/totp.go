@@ -0,0 +1,187 @@
+// Implements time-based one-time passwords (RFC 6238) for second-factor login, as generated by authenticator apps: six-digit HMAC-SHA1 codes, changing every 30 seconds.
+// Secrets are shared with the app through an otpauth:// URI (shown as a QR code) or typed in as base32, and are kept sealed with AES-GCM at rest; see Sealer.
+// Users who lose their app fall back on one-time recovery codes, of which only hashes are stored.
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Period = 30 * time.Second // Time step between codes
+	Digits = 6
+	Skew   = 1 // Steps either side of the current one still accepted, to allow for clock drift
+)
+
+var (
+	// ErrInvalidSecret is returned for secrets which are not valid base32.
+	ErrInvalidSecret = errors.New("invalid totp secret")
+	// ErrSealed is returned by Open for sealed secrets which cannot be decrypted with the key, or have been tampered with.
+	ErrSealed = errors.New("sealed secret cannot be opened")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random 160-bit secret, base32-encoded as authenticator apps expect.
+func GenerateSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(raw), nil
+}
+
+// Code returns the code for a secret at a given time.
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, step(t)), nil
+}
+
+// Validate checks a code against the steps within Skew of a given time, and returns the step it matched.
+// Steps up to and including last are refused, so that a code cannot be used twice; pass the step returned by the previous successful validation, or 0.
+func Validate(secret, input string, t time.Time, last int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	input = strings.ReplaceAll(input, " ", "")
+	if err != nil || len(input) != Digits {
+		return 0, false
+	}
+	now := step(t)
+	for s := now - Skew; s <= now+Skew; s++ {
+		if s > last && subtle.ConstantTimeCompare([]byte(code(key, s)), []byte(input)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns the otpauth:// URI which enrolls a secret in an authenticator app, labelled with an issuer and account name.
+func URI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	query := url.Values{"secret": {secret}, "issuer": {issuer}}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// FormatSecret splits a secret into groups of four characters, to make typing it into an app easier.
+func FormatSecret(secret string) string {
+	groups := make([]string, 0, len(secret)/4+1)
+	for len(secret) > 4 {
+		groups = append(groups, secret[:4])
+		secret = secret[4:]
+	}
+	return strings.Join(append(groups, secret), " ")
+}
+
+// RecoveryCodes returns n random one-time recovery codes, formatted as "xxxx-xxxx", along with their hashes for storage.
+func RecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		text := strings.ToLower(encoding.EncodeToString(raw))
+		codes[i] = text[:4] + "-" + text[4:]
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hex-encoded SHA-256 hash of a recovery code, ignoring case, spaces and dashes.
+// Recovery codes are random enough that a fast hash is sufficient.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Sealer encrypts secrets for storage with AES-256-GCM. Safe for concurrent use.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a Sealer from a 32-byte key, returning its pointer.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("totp key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts a secret, returning the random nonce and ciphertext, base64-encoded.
+func (s *Sealer) Seal(secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.aead.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// Open decrypts a secret sealed by Seal with the same key.
+func (s *Sealer) Open(sealed string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < s.aead.NonceSize() {
+		return "", ErrSealed
+	}
+	nonce, ciphertext := raw[:s.aead.NonceSize()], raw[s.aead.NonceSize():]
+	secret, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrSealed
+	}
+	return string(secret), nil
+}
+
+// Utility functions
+
+// Returns the time step a time falls in.
+func step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Returns the code for a key at a given step (RFC 4226 dynamic truncation).
+func code(key []byte, s int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(s))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0F
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
+	return fmt.Sprintf("%0*d", Digits, value%1000000)
+}
+
+// Decodes a base32 secret, as typed or shown: case, spaces and padding are ignored.
+func decodeSecret(secret string) ([]byte, error) {
+	normalized := strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "=")
+	key, err := encoding.DecodeString(normalized)
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
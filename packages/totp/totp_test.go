@@ -0,0 +1,137 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 SHA-1 test secret, the ASCII string "12345678901234567890", base32-encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated from eight digits to six
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		got, err := Code(rfcSecret, time.Unix(test.unix, 0))
+		if err != nil || got != test.code {
+			t.Errorf("Code at %d = %q, %v, want %q", test.unix, got, err, test.code)
+		}
+	}
+
+	// Secrets are accepted as typed: lower case, grouped and padded
+	if got, _ := Code("gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", time.Unix(59, 0)); got != "287082" {
+		t.Errorf("Code with a formatted secret = %q, want 287082", got)
+	}
+	if _, err := Code("not base32!", time.Unix(59, 0)); err != ErrInvalidSecret {
+		t.Errorf("Code with an invalid secret: error %v, want ErrInvalidSecret", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := step(now)
+	codeAt := func(offset int64) string {
+		return code([]byte("12345678901234567890"), current+offset)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		last  int64
+		step  int64
+		ok    bool
+	}{
+		{"current step", "005924", 0, current, true},
+		{"spaced input", "005 924", 0, current, true},
+		{"previous step", codeAt(-Skew), 0, current - Skew, true},
+		{"next step", codeAt(Skew), 0, current + Skew, true},
+		{"beyond skew before", codeAt(-Skew - 1), 0, 0, false},
+		{"beyond skew after", codeAt(Skew + 1), 0, 0, false},
+		{"replayed", "005924", current, 0, false},
+		{"older than last", codeAt(-Skew), current - Skew, 0, false},
+		{"newer than last", codeAt(Skew), current, current + Skew, true},
+		{"wrong code", "123456", 0, 0, false},
+		{"too short", "00592", 0, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := Validate(rfcSecret, test.input, now, test.last)
+		if ok != test.ok || got != test.step {
+			t.Errorf("%s: Validate(%q, last %d) = %d, %v, want %d, %v", test.name, test.input, test.last, got, ok, test.step, test.ok)
+		}
+	}
+}
+
+func TestSealer(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	s, err := NewSealer(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := s.Seal(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened, err := s.Open(sealed); err != nil || opened != rfcSecret {
+		t.Errorf("Open(Seal(secret)) = %q, %v", opened, err)
+	}
+	if again, _ := s.Seal(rfcSecret); again == sealed {
+		t.Errorf("sealing a secret twice gave the same output; nonces are not random")
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(raw)
+	other, _ := NewSealer(bytes.Repeat([]byte{2}, 32))
+
+	tests := []struct {
+		name   string
+		sealer *Sealer
+		sealed string
+	}{
+		{"tampered", s, tampered},
+		{"wrong key", other, sealed},
+		{"not base64", s, "!!!"},
+		{"shorter than a nonce", s, base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+	for _, test := range tests {
+		if opened, err := test.sealer.Open(test.sealed); err != ErrSealed {
+			t.Errorf("%s: Open = %q, %v, want ErrSealed", test.name, opened, err)
+		}
+	}
+
+	if _, err := NewSealer(key[:16]); err == nil {
+		t.Errorf("NewSealer accepted a 16-byte key")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := HashRecoveryCode("abcd-efgh")
+	for _, input := range []string{"abcdefgh", "ABCD-EFGH", " abcd - efgh ", "AbCd EfGh"} {
+		if got := HashRecoveryCode(input); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from that of %q", input, "abcd-efgh")
+		}
+	}
+	if HashRecoveryCode("abcd-efgi") == want {
+		t.Errorf("different recovery codes hash the same")
+	}
+
+	codes, hashes, err := RecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range codes {
+		if len(codes[i]) != 9 || codes[i][4] != '-' || HashRecoveryCode(codes[i]) != hashes[i] {
+			t.Errorf("recovery code %q does not match its hash, or is not formatted xxxx-xxxx", codes[i])
+		}
+	}
+}
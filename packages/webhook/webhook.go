@@ -0,0 +1,330 @@
+// Implements outbound webhooks, used to notify external services whenever submissions or tickets change state.
+// Each registered Hook subscribes to a set of events; matching events are delivered as a JSON payload signed with HMAC-SHA256 using the hook's secret.
+// Failed deliveries are retried with exponential backoff, and every attempt is recorded in a bounded delivery log for display to admin users.
+// Dispatchers are safe for concurrent use via the inclusion of a Mutex with each struct.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Events which hooks are able to subscribe to.
+const (
+	SubmissionCreated  = "submission.created"
+	SubmissionApproved = "submission.approved"
+	SubmissionRejected = "submission.rejected"
+	TicketUpdated      = "ticket.updated"
+	TicketClaimed      = "ticket.claimed"
+	TicketResolved     = "ticket.resolved"
+	TicketDeleted      = "ticket.deleted"
+	TicketCommented    = "ticket.commented"
+)
+
+// Events lists every event a hook may subscribe to, in the order they are displayed.
+var Events = []string{
+	SubmissionCreated,
+	SubmissionApproved,
+	SubmissionRejected,
+	TicketUpdated,
+	TicketClaimed,
+	TicketResolved,
+	TicketDeleted,
+	TicketCommented,
+}
+
+// Headers attached to every delivery. SignatureHeader holds "sha256=" followed by the hex-encoded HMAC of the request body.
+const (
+	EventHeader     = "X-Bugtracker-Event"
+	DeliveryHeader  = "X-Bugtracker-Delivery"
+	SignatureHeader = "X-Bugtracker-Signature"
+)
+
+const (
+	maxLogged = 200 // Number of delivery attempts retained in the delivery log
+)
+
+var (
+	// ErrInvalidURL signals that a hook was registered with a URL that is not absolute http(s).
+	ErrInvalidURL = errors.New("webhook url must be an absolute http or https url")
+	// ErrNoEvents signals that a hook was registered without subscribing to any events.
+	ErrNoEvents = errors.New("webhook must subscribe to at least one event")
+	// ErrUnknownEvent signals that a hook was registered with an event not listed in Events.
+	ErrUnknownEvent = errors.New("webhook subscribed to unknown event")
+)
+
+// Hook is a registered webhook endpoint.
+type Hook struct {
+	ID     int64
+	URL    string
+	Secret string
+	Events []string
+}
+
+// Subscribed reports whether the hook is subscribed to a given event.
+func (h Hook) Subscribed(event string) bool {
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body sent to each hook.
+type Payload struct {
+	Delivery string      `json:"delivery"`
+	Event    string      `json:"event"`
+	Created  time.Time   `json:"created"`
+	Data     interface{} `json:"data"`
+}
+
+// Delivery records the outcome of a single delivery attempt.
+type Delivery struct {
+	ID         string
+	HookID     int64
+	URL        string
+	Event      string
+	Attempt    int
+	StatusCode int
+	Err        string
+	Time       time.Time
+}
+
+// Succeeded reports whether the attempt received a 2xx response.
+func (d Delivery) Succeeded() bool {
+	return d.Err == "" && d.StatusCode >= 200 && d.StatusCode < 300
+}
+
+// Dispatcher holds the registered hooks and delivers events to them.
+type Dispatcher struct {
+	Client      *http.Client          // Client used for deliveries; swap out to point at a local receiver.
+	MaxAttempts int                   // Attempts made per delivery before giving up.
+	Backoff     time.Duration         // Delay before the first retry, doubled on each subsequent retry.
+	Log         func(string) error    // Optional; called with a summary of every attempt.
+	Sleep       func(d time.Duration) // Used between retries; replaceable so retries need not wait in real time.
+
+	mu         sync.Mutex
+	hooks      []Hook
+	nextID     int64
+	deliveries []Delivery
+	wg         sync.WaitGroup
+}
+
+// New creates a Dispatcher with the given hooks already registered, and returns its pointer.
+func New(hooks []Hook) *Dispatcher {
+	d := &Dispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		Sleep:       time.Sleep,
+	}
+	for _, hook := range hooks {
+		if hook.ID >= d.nextID {
+			d.nextID = hook.ID + 1
+		}
+		d.hooks = append(d.hooks, hook)
+	}
+	return d
+}
+
+// Hooks returns a copy of all registered hooks.
+func (d *Dispatcher) Hooks() []Hook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]Hook, len(d.hooks))
+	copy(result, d.hooks)
+	return result
+}
+
+// AddHook validates and registers a new hook, returning it with its assigned ID.
+func (d *Dispatcher) AddHook(rawurl, secret string, events []string) (Hook, error) {
+	parsed, err := url.Parse(rawurl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Hook{}, ErrInvalidURL
+	}
+	if len(events) == 0 {
+		return Hook{}, ErrNoEvents
+	}
+	for _, event := range events {
+		if !known(event) {
+			return Hook{}, ErrUnknownEvent
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	hook := Hook{
+		ID:     d.nextID,
+		URL:    rawurl,
+		Secret: secret,
+		Events: events,
+	}
+	d.nextID++
+	d.hooks = append(d.hooks, hook)
+	return hook, nil
+}
+
+// DeleteHook removes the hook with a given ID. Returns false if no such hook exists.
+func (d *Dispatcher) DeleteHook(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.hooks {
+		if d.hooks[i].ID == id {
+			d.hooks = append(d.hooks[:i], d.hooks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Deliveries returns the delivery log, most recent attempt first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]Delivery, len(d.deliveries))
+	for i := range d.deliveries {
+		result[i] = d.deliveries[len(d.deliveries)-1-i]
+	}
+	return result
+}
+
+// Dispatch delivers an event to every hook subscribed to it. Deliveries happen in the background so callers (i.e. handlers) are never blocked.
+func (d *Dispatcher) Dispatch(event string, data interface{}) {
+	for _, hook := range d.Hooks() {
+		if !hook.Subscribed(event) {
+			continue
+		}
+		d.wg.Add(1)
+		go func(hook Hook) {
+			defer d.wg.Done()
+			d.Deliver(hook, event, data)
+		}(hook)
+	}
+}
+
+// Wait blocks until all background deliveries started by Dispatch have finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Deliver synchronously sends one event to one hook, retrying with exponential backoff until a 2xx response is received or MaxAttempts is reached.
+// Returns the final attempt.
+func (d *Dispatcher) Deliver(hook Hook, event string, data interface{}) Delivery {
+	payload := Payload{
+		Delivery: uuid.NewV4().String(),
+		Event:    event,
+		Created:  time.Now().UTC(),
+		Data:     data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return d.record(Delivery{
+			ID:      payload.Delivery,
+			HookID:  hook.ID,
+			URL:     hook.URL,
+			Event:   event,
+			Attempt: 1,
+			Err:     err.Error(),
+			Time:    time.Now(),
+		})
+	}
+
+	var last Delivery
+	wait := d.Backoff
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		last = d.record(d.attempt(hook, payload, body, attempt))
+		if last.Succeeded() {
+			break
+		}
+		if attempt < d.MaxAttempts {
+			d.Sleep(wait)
+			wait *= 2
+		}
+	}
+	return last
+}
+
+// Sign computes the value of SignatureHeader for a request body. Receivers verify deliveries by recomputing it with their copy of the secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether a signature produced by Sign matches the body.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Utility functions
+
+// Performs a single POST of the payload to the hook.
+func (d *Dispatcher) attempt(hook Hook, payload Payload, body []byte, attempt int) Delivery {
+	result := Delivery{
+		ID:      payload.Delivery,
+		HookID:  hook.ID,
+		URL:     hook.URL,
+		Event:   payload.Event,
+		Attempt: attempt,
+		Time:    time.Now(),
+	}
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, payload.Event)
+	req.Header.Set(DeliveryHeader, payload.Delivery)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+	res.Body.Close()
+	result.StatusCode = res.StatusCode
+	return result
+}
+
+// Appends an attempt to the delivery log, discarding the oldest entries beyond maxLogged.
+func (d *Dispatcher) record(delivery Delivery) Delivery {
+	d.mu.Lock()
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxLogged {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxLogged:]
+	}
+	d.mu.Unlock()
+
+	if d.Log != nil {
+		outcome := fmt.Sprintf("status %d", delivery.StatusCode)
+		if delivery.Err != "" {
+			outcome = delivery.Err
+		}
+		d.Log(fmt.Sprintf("Webhook %d (%s) delivery %s of %s, attempt %d: %s.", delivery.HookID, delivery.URL, delivery.ID, delivery.Event, delivery.Attempt, outcome))
+	}
+	return delivery
+}
+
+// Checks if an event is one of the subscribable Events.
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"ticket.updated"}`)
+	// Known HMAC-SHA256 of the body with key "secret"
+	const want = "sha256=9bade220b80b912a6259aecc3feadeb26a2d88b2e0cbf787cc1ae2c38d848337"
+	signature := Sign("secret", body)
+	if signature != want {
+		t.Fatalf("Sign = %q, want %q", signature, want)
+	}
+	if !Verify("secret", body, signature) {
+		t.Error("Verify rejected a signature made with the same secret")
+	}
+	if Verify("other", body, signature) {
+		t.Error("Verify accepted a signature made with a different secret")
+	}
+	if Verify("secret", []byte(`{"event":"ticket.deleted"}`), signature) {
+		t.Error("Verify accepted a signature for a different body")
+	}
+	if Verify("secret", body, "") {
+		t.Error("Verify accepted an empty signature")
+	}
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests <- received{req.Header, body}
+	}))
+	defer server.Close()
+
+	d := New(nil)
+	hook, err := d.AddHook(server.URL, "s3cret", []string{TicketUpdated})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := d.Deliver(hook, TicketUpdated, map[string]int{"ticket": 7})
+	if !delivery.Succeeded() || delivery.Attempt != 1 {
+		t.Fatalf("Deliver = %+v, want success on the first attempt", delivery)
+	}
+
+	got := <-requests
+	if !Verify("s3cret", got.body, got.header.Get(SignatureHeader)) {
+		t.Errorf("signature %q does not verify against the body", got.header.Get(SignatureHeader))
+	}
+	if got.header.Get(EventHeader) != TicketUpdated {
+		t.Errorf("%s = %q, want %q", EventHeader, got.header.Get(EventHeader), TicketUpdated)
+	}
+	var payload Payload
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Delivery != delivery.ID || payload.Delivery != got.header.Get(DeliveryHeader) {
+		t.Errorf("delivery ID %q does not match header %q and log %q", payload.Delivery, got.header.Get(DeliveryHeader), delivery.ID)
+	}
+	if payload.Event != TicketUpdated {
+		t.Errorf("payload event = %q, want %q", payload.Event, TicketUpdated)
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls < 3 {
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	d := New(nil)
+	d.Backoff = time.Second
+	d.Sleep = func(wait time.Duration) { waits = append(waits, wait) }
+	hook, _ := d.AddHook(server.URL, "s3cret", []string{TicketUpdated})
+
+	delivery := d.Deliver(hook, TicketUpdated, nil)
+	if !delivery.Succeeded() || delivery.Attempt != 3 {
+		t.Fatalf("Deliver = %+v, want success on the third attempt", delivery)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; !equalDurations(waits, want) {
+		t.Errorf("waited %v between attempts, want %v", waits, want)
+	}
+	log := d.Deliveries()
+	if len(log) != 3 {
+		t.Fatalf("delivery log has %d attempts, want 3", len(log))
+	}
+	for i, wantAttempt := range []int{3, 2, 1} { // Most recent first
+		if log[i].Attempt != wantAttempt || log[i].ID != delivery.ID {
+			t.Errorf("log[%d] = attempt %d of %s, want attempt %d of %s", i, log[i].Attempt, log[i].ID, wantAttempt, delivery.ID)
+		}
+	}
+	if log[1].StatusCode != http.StatusInternalServerError || log[1].Succeeded() {
+		t.Errorf("log[1] = %+v, want a failed attempt with status 500", log[1])
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	d := New(nil)
+	d.MaxAttempts = 4
+	d.Backoff = time.Second
+	d.Sleep = func(wait time.Duration) { waits = append(waits, wait) }
+	hook, _ := d.AddHook(server.URL, "", []string{TicketUpdated})
+
+	delivery := d.Deliver(hook, TicketUpdated, nil)
+	if delivery.Succeeded() || delivery.Attempt != 4 {
+		t.Fatalf("Deliver = %+v, want failure after 4 attempts", delivery)
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}; !equalDurations(waits, want) {
+		t.Errorf("waited %v between attempts, want %v (no wait after the last)", waits, want)
+	}
+}
+
+func TestDispatchOnlySubscribed(t *testing.T) {
+	var mu sync.Mutex
+	events := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[req.URL.Path+" "+req.Header.Get(EventHeader)]++
+	}))
+	defer server.Close()
+
+	d := New(nil)
+	d.AddHook(server.URL+"/a", "", []string{TicketUpdated, TicketDeleted})
+	d.AddHook(server.URL+"/b", "", []string{TicketDeleted})
+	d.Dispatch(TicketUpdated, nil)
+	d.Dispatch(TicketDeleted, nil)
+	d.Dispatch(SubmissionCreated, nil)
+	d.Wait()
+
+	want := map[string]int{"/a " + TicketUpdated: 1, "/a " + TicketDeleted: 1, "/b " + TicketDeleted: 1}
+	if len(events) != len(want) {
+		t.Errorf("received %v, want %v", events, want)
+	}
+	for key, count := range want {
+		if events[key] != count {
+			t.Errorf("received %v, want %v", events, want)
+			break
+		}
+	}
+}
+
+func TestAddHookValidates(t *testing.T) {
+	d := New([]Hook{{ID: 4, URL: "http://example.com", Events: []string{TicketUpdated}}})
+	tests := []struct {
+		url    string
+		events []string
+		want   error
+	}{
+		{"ftp://example.com", []string{TicketUpdated}, ErrInvalidURL},
+		{"/relative", []string{TicketUpdated}, ErrInvalidURL},
+		{"https://example.com", nil, ErrNoEvents},
+		{"https://example.com", []string{"ticket.exploded"}, ErrUnknownEvent},
+	}
+	for _, tt := range tests {
+		if _, err := d.AddHook(tt.url, "", tt.events); err != tt.want {
+			t.Errorf("AddHook(%q, %v) error = %v, want %v", tt.url, tt.events, err, tt.want)
+		}
+	}
+	hook, err := d.AddHook("https://example.com/hook", "", []string{TicketUpdated})
+	if err != nil || hook.ID != 5 {
+		t.Errorf("AddHook = %+v, %v; want ID 5, following the loaded hooks", hook, err)
+	}
+}
+
+func equalDurations(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,53 +2,48 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"goInAction2/assignment/packages/dsa"
+	"goInAction2/assignment/packages/duewatch"
+	"goInAction2/assignment/packages/mailer"
+	"goInAction2/assignment/packages/mailin"
+	"goInAction2/assignment/packages/qrcode"
+	"goInAction2/assignment/packages/query"
+	"goInAction2/assignment/packages/search"
+	"goInAction2/assignment/packages/sse"
+	"goInAction2/assignment/packages/totp"
+	"goInAction2/assignment/packages/webhook"
+	"html/template"
+	"net"
 	"net/http"
+	"net/mail"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// func keepAlive(res http.ResponseWriter, req *http.Request) {
-// 	res.Header().Set("Content-Type", "text/event-stream")
-// 	res.Header().Set("Cache-Control", "no-cache")
-// 	res.Header().Set("Connection", "keep-alive")
-
-// 	flusher, ok := res.(http.Flusher)
-// 	if !ok {
-// 		if alreadyLoggedIn(req) {
-// 			generalRecord.AddLog(fmt.Sprintf("User %s's browser doesn't support server-sent events", loggedin.Name))
-// 		} else {
-// 			generalRecord.AddLog("User (not logged in)'s browser doesn't support server-sent events")
-// 		}
-// 	}
-
-// 	// Send a comment every second to prevent connection timeout.
-// 	for {
-// 		_, err := fmt.Fprint(res, "")
-// 		if err != nil {
-// 			if alreadyLoggedIn(req) {
-// 				submissionsCSV.SaveSubmissions(submissions)
-// 				ticketsCSV.SaveTickets(ticketlog)
-// 				generalRecord.AddLog(fmt.Sprintf("User %s closed their browser tab. Submissions and Ticketlog saved.", loggedin.Name))
-// 			} else {
-// 				generalRecord.AddLog("User (not logged in) closed their browser tab.")
-// 			}
-// 		}
-// 		flusher.Flush()
-// 		time.Sleep(time.Second)
-// 	}
-// }
-
-func dltProductsHeap(input int, products *[]string, submissionsToDlt *[]int64, submissions *[]dsa.Ticket) *[]int64 {
-	for i := range *submissions {
-		compareval := (*submissions)[i].Product
+func dltProductsHeap(input int, products *[]string, submissionsToDlt *[]int64, submissions *dsa.Submissionqueue) *[]int64 {
+	for _, ticket := range submissions.Tickets() {
+		compareval := ticket.Product
 		if compareval == input {
-			*submissionsToDlt = append(*submissionsToDlt, (*submissions)[i].TicketID)
+			*submissionsToDlt = append(*submissionsToDlt, ticket.TicketID)
 		} else if compareval > input {
-			(*submissions)[i].Product = compareval - 1
+			submissions.Update(ticket.TicketID, func(ticket *dsa.Ticket) {
+				ticket.Product = compareval - 1
+			})
 		}
 	}
 	return submissionsToDlt
@@ -60,11 +55,8 @@ func dltProductsAVL(input int, products *[]string, ticketsToDlt *[]int64, avlroo
 		return ticketsToDlt
 	}
 
-	compareval := avlroot.Ticket.Product
-	if compareval == input {
+	if avlroot.Ticket.Product == input {
 		*ticketsToDlt = append(*ticketsToDlt, avlroot.Ticket.TicketID)
-	} else if compareval > input {
-		avlroot.Ticket.Product = compareval - 1
 	}
 
 	ticketsToDlt = dltProductsAVL(input, products, ticketsToDlt, avlroot.Left)
@@ -93,7 +85,6 @@ func newacc(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 		usernameChan := make(chan string)
 		passwordChan := make(chan string)
 		repeatChan := make(chan string)
-		adminrawChan := make(chan string)
 
 		go func() {
 			usernameChan <- req.FormValue("username")
@@ -107,19 +98,15 @@ func newacc(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 			repeatChan <- req.FormValue("repeat")
 		}()
 
-		go func() {
-			adminrawChan <- req.FormValue("admin")
-		}()
-
 		username := <-usernameChan
 		password := <-passwordChan
 		repeat := <-repeatChan
-		adminraw := <-adminrawChan
+		emailraw := req.FormValue("email")
 
-		admin := false
-
-		if adminraw != "" {
-			admin = true
+		// Signing up cannot grant any more than signupRole, except on a fresh install, where the first account must be able to assign roles
+		role := signupRole
+		if adminCount() == 0 {
+			role = dsa.RoleAdmin
 		}
 		if username != "" && password != "" {
 			// check if username exist/ taken
@@ -134,28 +121,38 @@ func newacc(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 				http.Error(res, "Passwords entered do not match.", http.StatusForbidden)
 				return dsa.EmptyUser, errInvalid
 			}
-			// create session
-			id := uuid.NewV4()
-			myCookie := &http.Cookie{
-				Name:  "myCookie",
-				Value: id.String(),
+			// validate password against policy
+			if err := passwords.Check(username, password); err != nil {
+				userRecord.AddLog(fmt.Sprintf("Attempted account creation(non-admin), but password for username %s rejected by policy (%s).", username, err))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return dsa.EmptyUser, err
 			}
-			http.SetCookie(res, myCookie)
-			generalRecord.AddLog("MyCookie: New session created (Non-admin signup page).")
-
-			bPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+			// validate email address, if given
+			email, err := checkEmail(emailraw)
+			if err != nil {
+				userRecord.AddLog(fmt.Sprintf("Attempted account creation(non-admin), but email address %s invalid or taken.", emailraw))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return dsa.EmptyUser, err
+			}
+			bPassword, err := passwords.Hash(password)
 			if err != nil {
 				http.Error(res, "Internal server error", http.StatusInternalServerError)
 				return dsa.EmptyUser, errInvalid
 			}
 
 			myUser = dsa.User{
-				Name:  username,
-				Pw:    bPassword,
-				Admin: admin}
-			mapSessions[myCookie.Value] = myUser
+				Name:   username,
+				Pw:     bPassword,
+				Role:   role,
+				Email:  email,
+				Notify: dsa.NotifyAll}
 			dsa.AddUser(users, myUser)
-			userRecord.AddLog(fmt.Sprintf("Successful account creation(non-admin). Username: %s, Admin: %t.", username, admin))
+			userRecord.AddLog(fmt.Sprintf("Successful account creation(non-admin). Username: %s, Role: %s.", username, role))
+			// create session
+			if err := startSession(res, req, myUser); err != nil {
+				http.Error(res, "Internal server error", http.StatusInternalServerError)
+				return dsa.EmptyUser, err
+			}
 		} else {
 			userRecord.AddLog("Attempted account creation(non-admin), but blank username and/or password entered.")
 			http.Error(res, errBlank.Error(), http.StatusForbidden)
@@ -177,10 +174,12 @@ func newaccadmin(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 		username := req.FormValue("username")
 		password := req.FormValue("password")
 		repeat := req.FormValue("repeat")
-		adminraw := req.FormValue("admin")
-		admin := false
-		if adminraw != "" {
-			admin = true
+		emailraw := req.FormValue("email")
+		role, ok := dsa.ParseRole(req.FormValue("role"))
+		if !ok {
+			userRecord.AddLog(fmt.Sprintf("Attempted account creation(admin), but role %s invalid.", req.FormValue("role")))
+			http.Error(res, "Invalid role.", http.StatusForbidden)
+			return dsa.EmptyUser, errInvalid
 		}
 		if username != "" && password != "" {
 			// check if username exist/ taken
@@ -197,18 +196,35 @@ func newaccadmin(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 				return dsa.EmptyUser, errInvalid
 			}
 
-			bPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+			// validate password against policy
+			if err := passwords.Check(username, password); err != nil {
+				userRecord.AddLog(fmt.Sprintf("Attempted account creation(admin), but password for username %s rejected by policy (%s).", username, err))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return dsa.EmptyUser, err
+			}
+
+			// validate email address, if given
+			email, err := checkEmail(emailraw)
+			if err != nil {
+				userRecord.AddLog(fmt.Sprintf("Attempted account creation(admin), but email address %s invalid or taken.", emailraw))
+				http.Error(res, err.Error(), http.StatusForbidden)
+				return dsa.EmptyUser, err
+			}
+
+			bPassword, err := passwords.Hash(password)
 			if err != nil {
 				http.Error(res, "Internal server error", http.StatusInternalServerError)
 				return dsa.EmptyUser, errInvalid
 			}
 
 			myUser = dsa.User{
-				Name:  username,
-				Pw:    bPassword,
-				Admin: admin}
+				Name:   username,
+				Pw:     bPassword,
+				Role:   role,
+				Email:  email,
+				Notify: dsa.NotifyAll}
 			dsa.AddUser(users, myUser)
-			userRecord.AddLog(fmt.Sprintf("Successful account creation(admin). Username: %s, Admin: %t.", username, admin))
+			userRecord.AddLog(fmt.Sprintf("Successful account creation(admin). Username: %s, Role: %s.", username, role))
 		} else {
 			userRecord.AddLog("Attempted account creation(admin), but blank username and/or password entered.")
 			http.Error(res, errBlank.Error(), http.StatusForbidden)
@@ -221,6 +237,51 @@ func newaccadmin(res http.ResponseWriter, req *http.Request) (dsa.User, error) {
 	return dsa.EmptyUser, nil
 }
 
+// userChoice is an account listed on the admin pages which select one, identified by username so that the selection is unaffected by the order of the hash table.
+type userChoice struct {
+	Name  string
+	Lines []string // As printed by dsa.PrintSLLusername
+}
+
+// userChoices lists every account for an admin to select from, sorted by username.
+func userChoices() []userChoice {
+	choices := []userChoice{}
+	for _, user := range users.All() {
+		choices = append(choices, userChoice{user.Name, dsa.PrintSLLusername(&dsa.UserNode{User: user})})
+	}
+	slices.SortFunc(choices, func(a, b userChoice) int { return strings.Compare(a.Name, b.Name) })
+	return choices
+}
+
+// adminCount returns the number of users with the Admin role.
+func adminCount() int {
+	count := 0
+	for _, user := range users.All() {
+		if user.Role == dsa.RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// checkEmail validates an optional email address entered for an account, returning it in canonical (lower-case) form.
+// Blank input is allowed, and returns a blank address.
+func checkEmail(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	addr, err := mail.ParseAddress(raw)
+	if err != nil || addr.Address != raw {
+		return "", errInvalid
+	}
+	email := strings.ToLower(addr.Address)
+	if exists, _ := dsa.SearchEmail(users, email); exists {
+		return "", errExisting
+	}
+	return email, nil
+}
+
 func getUser(res http.ResponseWriter, req *http.Request) dsa.User {
 	// get current session cookie
 	myCookie, err := req.Cookie("myCookie")
@@ -231,29 +292,93 @@ func getUser(res http.ResponseWriter, req *http.Request) dsa.User {
 			Value: id.String(),
 		}
 		generalRecord.AddLog("MyCookie: New session created.")
+		http.SetCookie(res, myCookie)
 	}
-	http.SetCookie(res, myCookie)
 
 	// if the user exists already, get user
-	var myUserNode *dsa.UserNode
-	if user, ok := mapSessions[myCookie.Value]; ok {
-		_, myUserNode = dsa.SearchUser(users, user.Name)
-	}
-
-	if myUserNode == nil {
-		return dsa.EmptyUser
-	}
-	return myUserNode.User
+	user, _ := sessionUser(req)
+	return user
 }
 
 func alreadyLoggedIn(req *http.Request) bool {
+	_, ok := sessionUser(req)
+	return ok
+}
+
+// currentSession returns the unexpired session of a request, recording the request against it so that it does not go idle.
+func currentSession(req *http.Request) (dsa.Session, bool) {
 	myCookie, err := req.Cookie("myCookie")
 	if err != nil {
-		return false
+		return dsa.Session{}, false
 	}
-	user := mapSessions[myCookie.Value]
-	ok, _ := dsa.SearchUser(users, user.Name)
-	return ok
+	return sessions.Touch(myCookie.Value, time.Now())
+}
+
+// sessionUser returns the account of the user logged in to a request's session, as currently recorded in the users hash table (so that role changes apply at once).
+func sessionUser(req *http.Request) (dsa.User, bool) {
+	session, ok := currentSession(req)
+	if !ok {
+		return dsa.EmptyUser, false
+	}
+	found, myUserNode := dsa.SearchUser(users, session.User)
+	if !found {
+		return dsa.EmptyUser, false
+	}
+	return myUserNode.User, true
+}
+
+// requirePermission wraps a page handler so that it is only served to logged-in users whose role grants a given permission; everyone else is redirected to the main menu.
+// Each access is logged against a description of the page.
+func requirePermission(permission dsa.Permission, page string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		user, ok := sessionUser(req)
+		if !ok {
+			generalRecord.AddLog(fmt.Sprintf("New User (not logged in) accessed %s. Redirected to main menu.", page))
+			http.Redirect(res, req, "/", http.StatusSeeOther)
+			return
+		}
+		if !user.Can(permission) {
+			generalRecord.AddLog(fmt.Sprintf("Username %s (Role: %s) accessed %s without permission to %s. Redirected to main menu.", user.Name, user.Role, page, permission))
+			http.Redirect(res, req, "/", http.StatusSeeOther)
+			return
+		}
+		generalRecord.AddLog(fmt.Sprintf("Username %s (Role: %s) accessed %s.", user.Name, user.Role, page))
+		handler(res, withUser(req, user))
+	}
+}
+
+// requireAPIPermission is requirePermission for API endpoints, which answer with an error status rather than a redirect.
+func requireAPIPermission(permission dsa.Permission, handler http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		user, ok := sessionUser(req)
+		if !ok {
+			http.Error(res, "Not logged in", http.StatusUnauthorized)
+			return
+		}
+		if !user.Can(permission) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler(res, withUser(req, user))
+	}
+}
+
+// userKey is the request context key under which requirePermission and requireAPIPermission store the logged-in user.
+type userKey struct{}
+
+// withUser returns a copy of a request carrying the user it is served to.
+func withUser(req *http.Request, user dsa.User) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), userKey{}, user))
+}
+
+// requestUser returns the user a request is served to, as found by requirePermission or requireAPIPermission when the request came in.
+// Handlers not wrapped by either get dsa.EmptyUser, and should call sessionUser instead.
+func requestUser(req *http.Request) dsa.User {
+	user, ok := req.Context().Value(userKey{}).(dsa.User)
+	if !ok {
+		return dsa.EmptyUser
+	}
+	return user
 }
 
 func newSubmission(title, desc, creator, assignee string,
@@ -272,55 +397,917 @@ func newSubmission(title, desc, creator, assignee string,
 	return newticket
 }
 
-func preloadPivots(index int, label string) pivotItem {
-	pivoted := &dsa.AVLtree{
-		Root:     nil,
-		Sortfunc: dsa.ByTicketID,
-	}
-	switch index {
-	case 0: // Product
-		pivoted.Sortfunc = dsa.ByProduct
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 1: // Status
-		pivoted.Sortfunc = dsa.ByStatus
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 2: // Category
-		pivoted.Sortfunc = dsa.ByCategory
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 3: // Estimated Hours to Complete
-		pivoted.Sortfunc = dsa.ByEstHours
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 4: // Priority
-		pivoted.Sortfunc = dsa.ByPriority
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 5: // Start Date
-		pivoted.Sortfunc = dsa.ByStartDate
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 6: // Due Date
-		pivoted.Sortfunc = dsa.ByDueDate
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 7: // Creator
-		pivoted.Sortfunc = dsa.ByCreator
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 8: // Assignee
-		pivoted.Sortfunc = dsa.ByAssignee
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 9: // Title
-		pivoted.Sortfunc = dsa.ByTitle
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	case 10: // Description
-		pivoted.Sortfunc = dsa.ByDescription
-		pivoted.Root = dsa.AVLpivot(ticketlog.Root, pivoted.Root, pivoted.Sortfunc)
-	}
-	return pivotItem{label, pivoted}
-}
-
-func passPreload(options []string) <-chan pivotItem {
-	c := make(chan pivotItem)
-	go func() {
-		for index, label := range options {
-			c <- preloadPivots(index, label)
+// sortOptions lists the keys tickets can be re-sorted by, in the order they are offered.
+var sortOptions = []sortOption{
+	{"Product", "Product", dsa.CompareProduct},
+	{"Status", "Status", dsa.CompareStatus},
+	{"Category", "Category", dsa.CompareCategory},
+	{"Estimated Hours to Complete", "EstHours", dsa.CompareEstHours},
+	{"Priority", "Priority", dsa.ComparePriority},
+	{"Start Date", "StartDate", dsa.CompareStartDate},
+	{"Due Date", "DueDate", dsa.CompareDueDate},
+	{"Creator", "Creator", dsa.CompareCreator},
+	{"Assignee", "Assignee", dsa.CompareAssignee},
+	{"Title", "Title", dsa.CompareTitle},
+	{"Description", "Description", dsa.CompareDescription},
+	{"Ticket ID", "TicketID", dsa.CompareTicketID},
+}
+
+// sortKeysFor looks up the sort keys chosen by label, returning them with the index field of the first key and a description of the resulting order, e.g. "Priority, then Due Date (descending)".
+func sortKeysFor(labels []string, descending []bool) ([]dsa.SortKey, string, string, error) {
+	keys := make([]dsa.SortKey, 0, len(labels))
+	described := make([]string, 0, len(labels))
+	field := ""
+	for i, label := range labels {
+		found := false
+		for _, option := range sortOptions {
+			if option.label == label {
+				keys = append(keys, dsa.SortKey{Compare: option.compare, Descending: descending[i]})
+				if field == "" {
+					field = option.field
+				}
+				found = true
+			}
 		}
-	}()
-	return c
+		if !found {
+			return nil, "", "", errInvalid
+		}
+		if descending[i] {
+			label += " (descending)"
+		}
+		described = append(described, label)
+	}
+	return keys, field, strings.Join(described, ", then "), nil
+}
+
+// ticketEvent is the representation of a ticket passed to event subscribers, with indexed fields resolved to their names.
+type ticketEvent struct {
+	TicketID    int64     `json:"ticketID"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Creator     string    `json:"creator"`
+	Assignee    string    `json:"assignee"`
+	Team        string    `json:"team,omitempty"`
+	Product     string    `json:"product"`
+	Status      string    `json:"status"`
+	Category    string    `json:"category"`
+	Priority    string    `json:"priority"`
+	EstHours    int       `json:"estHours"`
+	StartDate   time.Time `json:"startDate"`
+	DueDate     time.Time `json:"dueDate"`
+	Actor       string    `json:"actor"`
+	Comment     string    `json:"comment,omitempty"`
+}
+
+// emitEvent notifies subscribers (webhooks, connected browsers, email and in-app notifications) that a submission or ticket has changed. Actor is the username responsible for the change.
+func emitEvent(event string, ticket dsa.Ticket, actor string) {
+	publishEvent(event, ticket, newTicketEvent(ticket, actor))
+}
+
+// emitComment notifies subscribers that a comment was left on a ticket or submission.
+func emitComment(comment dsa.Comment) {
+	ticket, ok := findTicket(comment.TicketID)
+	if !ok {
+		return
+	}
+	payload := newTicketEvent(ticket, comment.Author)
+	payload.Comment = comment.Body
+	publishEvent(webhook.TicketCommented, ticket, payload)
+}
+
+// newTicketEvent builds the representation of a ticket passed to subscribers.
+func newTicketEvent(ticket dsa.Ticket, actor string) ticketEvent {
+	return ticketEvent{
+		TicketID:    ticket.TicketID,
+		Title:       ticket.Title,
+		Description: ticket.Description,
+		Creator:     ticket.Creator,
+		Assignee:    ticket.Assignee,
+		Team:        ticket.Team,
+		Product:     labelOf(products, ticket.Product),
+		Status:      labelOf(statuses, ticket.Status),
+		Category:    labelOf(categories, ticket.Category),
+		Priority:    labelOf(priorities, ticket.Priority),
+		EstHours:    ticket.EstHours,
+		StartDate:   ticket.StartDate,
+		DueDate:     ticket.DueDate,
+		Actor:       actor,
+	}
+}
+
+// publishEvent fans an event out to every kind of subscriber, after bringing the search index up to date with the change.
+func publishEvent(event string, ticket dsa.Ticket, payload ticketEvent) {
+	reindex(ticket.TicketID)
+	hookDispatcher.Dispatch(event, payload)
+	notifyByEmail(event, ticket, payload.Actor)
+	notifyInbox(event, ticket, payload.Actor)
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		generalRecord.AddLog(fmt.Sprintf("Failed to encode %s event for ticket ID %v: %s", event, ticket.TicketID, err))
+		return
+	}
+	users, admins := eventAudience(event, ticket)
+	liveBroker.Publish(sse.Event{
+		Name:   event,
+		Data:   string(data),
+		Users:  users,
+		Admins: admins,
+	})
+}
+
+// eventAudience determines who may see a given event: the usernames it concerns, and whether users who manage the submissions queue (see dsa.ApproveSubmissions) should also receive it.
+// Events of restricted products go to those of the queue's managers who may view the product by name instead.
+func eventAudience(event string, ticket dsa.Ticket) ([]string, bool) {
+	var audience []string
+	var admins bool
+	switch event {
+	case webhook.SubmissionCreated, webhook.SubmissionRejected:
+		audience, admins = []string{ticket.Creator}, true
+	case webhook.SubmissionApproved:
+		audience, admins = append([]string{ticket.Creator, ticket.Assignee}, teamMembers(ticket)...), true
+	default:
+		audience, admins = append([]string{ticket.Creator, ticket.Assignee}, teamMembers(ticket)...), false
+	}
+	if admins && productAccess.Restricted(labelOf(products, ticket.Product)) {
+		for _, user := range users.All() {
+			if user.Can(dsa.ApproveSubmissions) && productAllows(user, ticket.Product, dsa.AccessView) {
+				audience = append(audience, user.Name)
+			}
+		}
+		admins = false
+	}
+	return audience, admins
+}
+
+// notifyInbox records in-app notifications about an event for each affected user. Users are not notified of their own actions.
+func notifyInbox(event string, ticket dsa.Ticket, actor string) {
+	ref := fmt.Sprintf("#%d \"%s\"", ticket.TicketID, ticket.Title)
+	switch event {
+	case webhook.SubmissionApproved:
+		addNotification(actor, event, ticket, fmt.Sprintf("Your submission %s was approved by %s.", ref, actor), ticket.Creator)
+		addNotification(actor, event, ticket, fmt.Sprintf("You were assigned ticket %s.", ref), ticket.Assignee)
+		if ticket.Assignee == "" {
+			addNotification(actor, event, ticket, fmt.Sprintf("Ticket %s is waiting to be claimed in the %s team queue.", ref, ticket.Team), teamMembers(ticket)...)
+		}
+	case webhook.SubmissionRejected:
+		addNotification(actor, event, ticket, fmt.Sprintf("Your submission %s was rejected by %s.", ref, actor), ticket.Creator)
+	case webhook.TicketUpdated:
+		addNotification(actor, event, ticket, fmt.Sprintf("Ticket %s status changed to %s by %s.", ref, labelOf(statuses, ticket.Status), actor), ticket.Creator, ticket.Assignee)
+	case webhook.TicketClaimed:
+		if ticket.Assignee == actor {
+			addNotification(actor, event, ticket, fmt.Sprintf("Ticket %s was claimed by %s.", ref, actor), ticket.Creator)
+		} else {
+			addNotification(actor, event, ticket, fmt.Sprintf("Ticket %s was assigned to %s by %s.", ref, ticket.Assignee, actor), ticket.Creator)
+			addNotification(actor, event, ticket, fmt.Sprintf("You were assigned ticket %s by %s.", ref, actor), ticket.Assignee)
+		}
+	case webhook.TicketResolved:
+		addNotification(actor, event, ticket, fmt.Sprintf("Ticket %s was marked complete by %s.", ref, actor), ticket.Creator, ticket.Assignee)
+	case webhook.TicketCommented:
+		addNotification(actor, event, ticket, fmt.Sprintf("%s commented on ticket %s.", actor, ref), ticket.Creator, ticket.Assignee)
+	}
+}
+
+// addNotification adds a notification to the inbox of each recipient, and pushes their new unread count to any page they have open.
+// Blank, unknown and repeated recipients are skipped, as is the actor.
+func addNotification(actor, event string, ticket dsa.Ticket, message string, recipients ...string) {
+	notified := make(map[string]bool)
+	for _, username := range recipients {
+		if username == "" || username == actor || notified[username] {
+			continue
+		}
+		if ok, _ := dsa.SearchUser(users, username); !ok {
+			continue
+		}
+		notified[username] = true
+		inbox.Notify(dsa.Notification{
+			User:     username,
+			TicketID: ticket.TicketID,
+			Kind:     event,
+			Message:  message,
+			Created:  time.Now(),
+		})
+		liveBroker.Publish(sse.Event{
+			Name:  "notification",
+			Data:  strconv.Itoa(inbox.Unread(username)),
+			Users: []string{username},
+		})
+	}
+}
+
+// reindex brings the search index up to date with a ticket or submission, unindexing it if it no longer exists.
+func reindex(ticketID int64) {
+	ticket, ok := findTicket(ticketID)
+	if !ok {
+		searchIndex.Remove(ticketID)
+		return
+	}
+	searchIndex.Update(ticketID, searchDocument(ticket))
+}
+
+// buildIndex indexes every ticket and submission from scratch. Only used when the ticket log and submissions are replaced wholesale, i.e. on startup and in demo mode.
+func buildIndex() *search.Index {
+	index := search.NewIndex()
+	for _, ticket := range collectTickets(ticketlog.Snapshot(), nil) {
+		index.Update(ticket.TicketID, searchDocument(ticket))
+	}
+	for _, ticket := range submissions.Tickets() {
+		index.Update(ticket.TicketID, searchDocument(ticket))
+	}
+	return index
+}
+
+// searchDocument returns the searchable text of a ticket: its title, description and comments.
+func searchDocument(ticket dsa.Ticket) search.Document {
+	body := []string{ticket.Description}
+	for _, comment := range commentlog.Comments(ticket.TicketID) {
+		body = append(body, comment.Body)
+	}
+	return search.Document{Title: ticket.Title, Body: body}
+}
+
+// queryEnv returns the environment in which a user's ticket queries are evaluated.
+func queryEnv(username string) query.Env {
+	return query.Env{
+		User:       username,
+		Now:        time.Now(),
+		Products:   *products,
+		Statuses:   *statuses,
+		Categories: *categories,
+		Priorities: *priorities,
+	}
+}
+
+// runQuery returns the printed tickets in the ticket log which match a query run by a user and which the user may view, in ticket ID order.
+func runQuery(input, username string) ([][]string, error) {
+	filter, err := query.Compile(input, queryEnv(username))
+	if err != nil {
+		return nil, err
+	}
+	_, node := dsa.SearchUser(users, username)
+	user := dsa.EmptyUser
+	if node != nil {
+		user = node.User
+	}
+	visible, _ := viewable(user)
+	result := make([][]string, 0)
+	for _, ticket := range collectTickets(ticketlog.Snapshot(), nil) {
+		if filter(ticket) && visible(ticket) {
+			result = append(result, dsa.PrintTicket(ticket, priorities, products, statuses, categories))
+		}
+	}
+	return result, nil
+}
+
+// findTicket returns the ticket or outstanding submission with a given ID.
+func findTicket(ticketID int64) (dsa.Ticket, bool) {
+	if node := dsa.AVLsearch(ticketlog.Snapshot(), ticketID); node != nil {
+		return node.Ticket, true
+	}
+	return submissions.Get(ticketID)
+}
+
+// labelOf returns the name at a given index of a category slice, or an empty string if the index is out of range.
+func labelOf(slice *[]string, index int) string {
+	if index < 0 || index >= len(*slice) {
+		return ""
+	}
+	return (*slice)[index]
+}
+
+// ticketRef matches a ticket ID quoted in an email subject, e.g. "Re: [Ticket #12] Broken wand" or "[#12]".
+var ticketRef = regexp.MustCompile(`(?i)\[(?:ticket\s*)?#(\d+)\]`)
+
+// receiveMail turns an incoming email into a submission, or into a comment if its subject refers to an existing ticket or submission.
+// The sender must match the email address of an existing account. New submissions are filed against the product named by the recipient address, e.g. saucer@ for "Flying Saucer".
+// Returning an error rejects the email.
+func receiveMail(msg mailin.Message) error {
+	ok, sender := dsa.SearchEmail(users, msg.From)
+	if !ok {
+		submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email from %s (no account with that email address).", msg.From))
+		return errUnknownSender
+	}
+	author := sender.User.Name
+
+	// The envelope sender is as easily forged as any header, so mail is only attributed to a user if it is sent to one of their personal addresses
+	recipients, found := []string{}, false
+	for _, recipient := range msg.To {
+		address, key := splitMailKey(recipient)
+		if key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(sender.User.MailKey)) == 1 {
+			recipients = append(recipients, address)
+			found = true
+		}
+	}
+	if !found {
+		submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email from %s (not sent to a personal address of user %s).", msg.From, author))
+		return errWrongMailKey
+	}
+
+	// Replies become comments
+	if match := ticketRef.FindStringSubmatch(msg.Subject); match != nil {
+		ticketID, _ := strconv.ParseInt(match[1], 10, 64)
+		body := stripQuoted(msg.Body)
+		ticket, found := findTicket(ticketID)
+		if !found {
+			submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email reply from user %s (no ticket ID %v).", author, ticketID))
+			return errUnknownTicket
+		}
+		if !productAllows(sender.User, ticket.Product, dsa.AccessView) {
+			submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email reply from user %s (no access to ticket ID %v).", author, ticketID))
+			return errNoAccess
+		}
+		if body == "" {
+			return errBlank
+		}
+		comment := dsa.Comment{
+			TicketID: ticketID,
+			Author:   author,
+			Body:     body,
+			Posted:   msg.Received,
+		}
+		commentlog.AddComment(comment)
+		ticketRecord.AddLog(fmt.Sprintf("Comment added to ticket ID %v by user %v (via email).", ticketID, author))
+		emitComment(comment)
+		return nil
+	}
+
+	// Anything else is a new submission
+	product := productFor(recipients)
+	if product < 0 {
+		submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email from user %s (no product matches %s).", author, strings.Join(recipients, ", ")))
+		return errUnknownProduct
+	}
+	if !productAllows(sender.User, product, dsa.AccessSubmit) {
+		submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email from user %s (no access to product %s).", author, (*products)[product]))
+		return errNoAccess
+	}
+	title := strings.TrimSpace(msg.Subject)
+	if title == "" || msg.Body == "" {
+		submissionRecord.AddLog(fmt.Sprintf("Rejected inbound email from user %s (blank subject or body).", author))
+		return errBlank
+	}
+
+	ticketID := atomic.AddInt64(&ticketIDcounter, 1) - 1
+	ticket := dsa.Newticket(
+		ticketID, product, 0, indexOf(categories, "Bug"), indexOf(priorities, "Medium"), 1,
+		msg.Received, msg.Received.AddDate(0, 1, 0),
+		author, title, msg.Body, "",
+		priorities, products, statuses, categories)
+	submissions.Push(ticket)
+	submissionRecord.AddLog(fmt.Sprintf("Ticket ID %v submitted by user %v (via email).", ticketID, author))
+	emitEvent(webhook.SubmissionCreated, ticket, author)
+	return nil
+}
+
+// productFor returns the index of the product addressed by any of an email's recipients, or -1 if none match.
+// The local part of the address may be the whole product name with spaces removed ("flyingsaucer@") or any single word of it ("saucer@").
+func productFor(recipients []string) int {
+	for _, recipient := range recipients {
+		local := strings.ToLower(recipient)
+		if at := strings.LastIndex(local, "@"); at >= 0 {
+			local = local[:at]
+		}
+		for index, product := range *products {
+			words := strings.Fields(strings.ToLower(product))
+			if local == strings.Join(words, "") {
+				return index
+			}
+			for _, word := range words {
+				if local == word {
+					return index
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// personalAddress returns a user's personal inbound address for a product, e.g. "flyingsaucer+KEY@bugtracker.localhost".
+// Mail from the user is only accepted when sent to one of these addresses, and only the user and the application know the key.
+func personalAddress(user dsa.User, product int) string {
+	local := "support"
+	if product >= 0 && product < len(*products) {
+		local = strings.Join(strings.Fields(strings.ToLower((*products)[product])), "")
+	}
+	return local + "+" + user.MailKey + "@" + mailDomain
+}
+
+// splitMailKey splits the key out of a personal address, returning the address without it ("flyingsaucer@...") and the key, which is blank if the address has none.
+func splitMailKey(recipient string) (string, string) {
+	at := strings.LastIndex(recipient, "@")
+	if at < 0 {
+		at = len(recipient)
+	}
+	plus := strings.Index(recipient[:at], "+")
+	if plus < 0 {
+		return recipient, ""
+	}
+	return recipient[:plus] + recipient[at:], strings.ToLower(recipient[plus+1 : at])
+}
+
+// ticketExists checks whether a ticket ID belongs to a ticket in the ticket log or to an outstanding submission.
+func ticketExists(ticketID int64) bool {
+	if dsa.AVLsearch(ticketlog.Snapshot(), ticketID) != nil {
+		return true
+	}
+	_, found := submissions.Get(ticketID)
+	return found
+}
+
+// stripQuoted removes the quoted original message from an email reply, keeping only the new text.
+func stripQuoted(body string) string {
+	lines := strings.Split(body, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "On ") && strings.HasSuffix(trimmed, "wrote:") {
+			break
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// indexOf returns the index of a name within a category slice, falling back to the first entry if not found.
+func indexOf(slice *[]string, name string) int {
+	for index, item := range *slice {
+		if item == name {
+			return index
+		}
+	}
+	return 0
+}
+
+// envOr returns the value of an environment variable, or a fallback if it is unset or blank.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envDuration returns the duration held by an environment variable (e.g. "36h"), or fallback if it is unset or invalid.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// envInt returns the non-negative integer held by an environment variable, or fallback if it is unset or invalid.
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// notifyByEmail queues notification emails about an event for each affected user who has opted in. Users are not notified of their own actions.
+func notifyByEmail(event string, ticket dsa.Ticket, actor string) {
+	ref := fmt.Sprintf("[Ticket #%d] %s", ticket.TicketID, ticket.Title)
+	switch event {
+	case webhook.SubmissionApproved:
+		sendNotice(ticket.Creator, actor, dsa.NotifyApproval, "Approved: "+ref,
+			fmt.Sprintf("Your submission was approved by %s and added to the ticket log.", actor), ticket)
+		sendNotice(ticket.Assignee, actor, dsa.NotifyAssigned, "Assigned to you: "+ref,
+			"You have been assigned a new ticket. See View My Assignments for your current work.", ticket)
+		if ticket.Assignee == "" {
+			for _, member := range teamMembers(ticket) {
+				sendNotice(member, actor, dsa.NotifyAssigned, "Assigned to your team: "+ref,
+					fmt.Sprintf("A new ticket has been assigned to the %s team. See Team Queues to claim it.", ticket.Team), ticket)
+			}
+		}
+	case webhook.TicketClaimed:
+		if ticket.Assignee != actor {
+			sendNotice(ticket.Assignee, actor, dsa.NotifyAssigned, "Assigned to you: "+ref,
+				fmt.Sprintf("%s has assigned you a ticket from the %s team queue. See View My Assignments for your current work.", actor, ticket.Team), ticket)
+		}
+	case webhook.SubmissionRejected:
+		sendNotice(ticket.Creator, actor, dsa.NotifyApproval, "Rejected: "+ref,
+			fmt.Sprintf("Your submission was rejected by %s.", actor), ticket)
+	}
+}
+
+// sendNotice queues a single notification email to a user, if they have an email address and have opted in to that kind of notification.
+func sendNotice(username, actor string, notification int, subject, message string, ticket dsa.Ticket) {
+	if username == "" || username == actor {
+		return
+	}
+	ok, recipient := dsa.SearchUser(users, username)
+	if !ok || !recipient.User.Wants(notification) {
+		return
+	}
+
+	body := []string{"Hi " + username + ",", "", message, ""}
+	for _, line := range dsa.PrintTicket(ticket, priorities, products, statuses, categories) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "---") {
+			body = append(body, line)
+		}
+	}
+	body = append(body, "", "Reply to this email to comment on the ticket.")
+
+	err := notifier.Enqueue(mailer.Mail{
+		To:      recipient.User.Email,
+		ReplyTo: personalAddress(recipient.User, ticket.Product),
+		Subject: subject,
+		Body:    strings.Join(body, "\n"),
+	})
+	if err != nil && err != mailer.ErrDisabled {
+		mailRecord.AddLog(fmt.Sprintf("Could not queue notification to user %s: %s.", username, err))
+	}
+}
+
+// sendResetLink issues a password reset token for a user and emails them a link to redeem it, through the notification mailer.
+// The token is discarded again if the email cannot be queued.
+func sendResetLink(user dsa.User) error {
+	token, err := resetTokens.Issue(user.Name, time.Now().Add(resetTTL))
+	if err != nil {
+		return err
+	}
+	err = notifier.Enqueue(mailer.Mail{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: strings.Join([]string{
+			fmt.Sprintf("A password reset was requested for your account, %s.", user.Name),
+			"",
+			"Follow this link to choose a new password. It can be used once, and expires in " + resetTTL.String() + ":",
+			baseURL + "/resetpassword?token=" + token,
+			"",
+			"If you did not request a reset, ignore this email; your password has not been changed.",
+		}, "\n"),
+	})
+	if err != nil {
+		resetTokens.DeleteUser(user.Name)
+	}
+	resetTokens.Expire(time.Now())
+	resetTokensCSV.SaveResetTokens(resetTokens)
+	return err
+}
+
+// pendingLogin is a login whose password has been checked, waiting for the user's second factor.
+type pendingLogin struct {
+	User     string
+	Secret   string // TOTP secret offered for enrollment, if the user must enroll a second factor before logging in
+	Expires  time.Time
+	Failures int // Wrong codes entered so far
+}
+
+const (
+	pendingTTL      = 5 * time.Minute
+	pendingAttempts = 5  // Wrong codes after which a pending login is discarded, and the password must be entered again
+	recoveryCount   = 10 // Recovery codes issued on enrollment
+	totpIssuer      = "BugTracker"
+)
+
+// clientAddr returns the IP address a request came from, without its port.
+func clientAddr(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// recordLoginFailure counts a failed login attempt against both the username and the client address, logging any lockout it causes.
+func recordLoginFailure(username, addr string) {
+	if loginsByUser.Fail(username) {
+		userRecord.AddLog(fmt.Sprintf("Username %s locked out for %s after %d failed sign-in attempts.", username, loginsByUser.LockFor, loginsByUser.LockAfter))
+	}
+	if loginsByAddr.Fail(addr) {
+		userRecord.AddLog(fmt.Sprintf("Address %s locked out for %s after %d failed sign-in attempts.", addr, loginsByAddr.LockFor, loginsByAddr.LockAfter))
+	}
+}
+
+// loginFailed records a failed login attempt and writes the response, which is the same whether the username or the password was wrong.
+func loginFailed(res http.ResponseWriter, username, addr string) {
+	recordLoginFailure(username, addr)
+	http.Error(res, "Username and/or password do not match", http.StatusUnauthorized)
+}
+
+// tooManyAttempts writes the response to a login attempt refused while its username or address is throttled or locked out.
+func tooManyAttempts(res http.ResponseWriter, wait time.Duration) {
+	wait = (wait + time.Second - 1).Truncate(time.Second)
+	res.Header().Set("Retry-After", strconv.Itoa(int(wait/time.Second)))
+	http.Error(res, fmt.Sprintf("Too many failed sign-in attempts; try again in %s.", wait), http.StatusTooManyRequests)
+}
+
+// requires2FA reports whether a user must have a second factor to log in: either an admin has required it of them, or of their role.
+func requires2FA(user dsa.User) bool {
+	return user.Require2FA || slices.Contains(require2FA, user.Role)
+}
+
+// startSession logs a user in, setting the session cookie. Expired sessions are discarded.
+func startSession(res http.ResponseWriter, req *http.Request, user dsa.User) error {
+	now := time.Now()
+	sessions.Expire(now)
+	token, err := sessions.Start(user.Name, clientAddr(req), req.UserAgent(), now)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(res, &http.Cookie{
+		Name:     "myCookie",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	generalRecord.AddLog(fmt.Sprintf("MyCookie: New session created for username %s.", user.Name))
+	userRecord.AddLog(fmt.Sprintf("Successful sign-in using username %s (Role: %s).", user.Name, user.Role))
+	return nil
+}
+
+// beginPendingLogin records a login waiting for a second factor, setting a short-lived cookie to identify it. Expired pending logins are discarded.
+func beginPendingLogin(res http.ResponseWriter, user dsa.User, secret string) {
+	id := uuid.NewV4().String()
+	now := time.Now()
+	pendingMu.Lock()
+	for key, pending := range pendingLogins {
+		if now.After(pending.Expires) {
+			delete(pendingLogins, key)
+		}
+	}
+	pendingLogins[id] = pendingLogin{User: user.Name, Secret: secret, Expires: now.Add(pendingTTL)}
+	pendingMu.Unlock()
+	http.SetCookie(res, &http.Cookie{
+		Name:     "pendingLogin",
+		Value:    id,
+		MaxAge:   int(pendingTTL / time.Second),
+		HttpOnly: true,
+	})
+}
+
+// endPendingLogin discards the pending login of a request, and its cookie.
+func endPendingLogin(res http.ResponseWriter, req *http.Request) {
+	if cookie, err := req.Cookie("pendingLogin"); err == nil {
+		pendingMu.Lock()
+		delete(pendingLogins, cookie.Value)
+		pendingMu.Unlock()
+	}
+	http.SetCookie(res, &http.Cookie{Name: "pendingLogin", MaxAge: -1})
+}
+
+// checkSecondFactor checks a code entered by a user, either from their authenticator app or one of their recovery codes.
+// Returns the user as it must be saved on success, with the code's time step recorded or the recovery code used up, and which kind of code was accepted.
+func checkSecondFactor(user dsa.User, input string) (dsa.User, string, bool) {
+	if secret, err := totpSealer.Open(user.TOTP); err == nil {
+		if step, ok := totp.Validate(secret, input, time.Now(), user.TOTPStep); ok {
+			user.TOTPStep = step
+			return user, "authenticator code", true
+		}
+	}
+	hash := totp.HashRecoveryCode(input)
+	for i, stored := range user.Recovery {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			user.Recovery = append(user.Recovery[:i:i], user.Recovery[i+1:]...)
+			return user, "recovery code", true
+		}
+	}
+	return user, "", false
+}
+
+// setSecondFactor returns an edit for dsa.UpdateUser which gives a user the second factor of edited, as worked out from the user as fetched (by checkSecondFactor, enrollSecondFactor etc.).
+// The edit is refused if the stored second factor has changed since the user was fetched, e.g. if a concurrent request has already accepted the same code.
+func setSecondFactor(fetched, edited dsa.User) func(user *dsa.User) bool {
+	return func(user *dsa.User) bool {
+		if user.TOTP != fetched.TOTP || user.TOTPStep != fetched.TOTPStep || !slices.Equal(user.Recovery, fetched.Recovery) {
+			return false
+		}
+		user.TOTP, user.TOTPStep, user.Recovery = edited.TOTP, edited.TOTPStep, edited.Recovery
+		return true
+	}
+}
+
+// enrollSecondFactor checks the first code entered from an authenticator app set up with a new secret.
+// On success, returns the user as it must be saved, with the secret sealed and a fresh set of recovery codes, along with those codes for showing to the user once.
+func enrollSecondFactor(user dsa.User, secret, input string) (dsa.User, []string, error) {
+	step, ok := totp.Validate(secret, input, time.Now(), 0)
+	if !ok {
+		return user, nil, errWrongCode
+	}
+	sealed, err := totpSealer.Seal(secret)
+	if err != nil {
+		return user, nil, err
+	}
+	codes, hashes, err := totp.RecoveryCodes(recoveryCount)
+	if err != nil {
+		return user, nil, err
+	}
+	user.TOTP, user.TOTPStep, user.Recovery = sealed, step, hashes
+	return user, codes, nil
+}
+
+// enrollment holds what the enrollment form shows for a new secret: a QR code for scanning into an authenticator app, and the secret for typing in instead.
+type enrollment struct {
+	Secret    string
+	Formatted string
+	QR        template.URL // PNG data URI
+}
+
+// newEnrollment prepares the enrollment form for a user and secret.
+func newEnrollment(user dsa.User, secret string) enrollment {
+	data := enrollment{Secret: secret, Formatted: totp.FormatSecret(secret)}
+	if code, err := qrcode.Encode(totp.URI(totpIssuer, user.Name, secret)); err == nil {
+		if png, err := code.PNG(4); err == nil {
+			data.QR = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+	}
+	return data
+}
+
+// loadTOTPKey returns the key sealing TOTP secrets: given in hex, or else read from a file, which is created with a random key if it does not exist.
+func loadTOTPKey(hexKey, path string) ([]byte, error) {
+	if hexKey == "" {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			key := make([]byte, 32)
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+			return key, os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+		}
+		if err != nil {
+			return nil, err
+		}
+		hexKey = string(content)
+	}
+	return hex.DecodeString(strings.TrimSpace(hexKey))
+}
+
+// notifyDue notifies the creator and assignee of a ticket, by email and in-app, when the ticket falls due soon, becomes overdue or is escalated.
+func notifyDue(alert duewatch.Alert) {
+	ticket := alert.Ticket
+	due := ticket.DueDate.Format("2 Jan 2006 15:04")
+	kind, subject := "ticket.duesoon", "Due soon: "
+	message := fmt.Sprintf("Ticket #%d \"%s\" is due soon (due %s).", ticket.TicketID, ticket.Title, due)
+	if alert.State == duewatch.Overdue {
+		kind, subject = "ticket.overdue", "Overdue: "
+		message = fmt.Sprintf("Ticket #%d \"%s\" is overdue (due %s).", ticket.TicketID, ticket.Title, due)
+	}
+	if alert.Escalated {
+		kind, subject = "ticket.escalated", "Escalated: "
+		message = fmt.Sprintf("Ticket #%d \"%s\" is overdue (due %s), and its priority has been raised from %s to %s.", ticket.TicketID, ticket.Title, due, labelOf(priorities, alert.Previous), labelOf(priorities, ticket.Priority))
+	}
+	subject += fmt.Sprintf("[Ticket #%d] %s", ticket.TicketID, ticket.Title)
+
+	sendNotice(ticket.Assignee, "", dsa.NotifyDue, subject, message, ticket)
+	if ticket.Creator != ticket.Assignee {
+		sendNotice(ticket.Creator, "", dsa.NotifyDue, subject, message, ticket)
+	}
+	addNotification("", kind, ticket, message, ticket.Assignee, ticket.Creator)
+}
+
+// escalateTicket sets the priority of a ticket in the ticket log. Returns false if the ticket no longer exists.
+func escalateTicket(ticketID int64, priority int) bool {
+	var previous int
+	_, ok := ticketlog.Update(ticketID, func(ticket *dsa.Ticket) {
+		previous = ticket.Priority
+		ticket.Priority = priority
+	})
+	if !ok {
+		return false
+	}
+	ticketRecord.AddLog(fmt.Sprintf("Ticket ID %v overdue; priority escalated from %s to %s.", ticketID, labelOf(priorities, previous), labelOf(priorities, priority)))
+	return true
+}
+
+// productAllows reports whether a user has at least a given access to a product, by index (see dsa.Productaccess). Users who may manage products have full access to every product.
+func productAllows(user dsa.User, product int, access dsa.Access) bool {
+	return user.Can(dsa.ManageProducts) || productAccess.Allows(labelOf(products, product), user.Name, access)
+}
+
+// userAllows is productAllows for a user known only by username. Unknown users have no access to restricted products.
+func userAllows(username string, product int, access dsa.Access) bool {
+	_, node := dsa.SearchUser(users, username)
+	if node == nil {
+		return productAllows(dsa.EmptyUser, product, access)
+	}
+	return productAllows(node.User, product, access)
+}
+
+// canManageProduct reports whether a user may change who has access to a product. Only users who may manage products can restrict an open product.
+func canManageProduct(user dsa.User, product int) bool {
+	name := labelOf(products, product)
+	return user.Can(dsa.ManageProducts) || (productAccess.Restricted(name) && productAccess.Allows(name, user.Name, dsa.AccessManage))
+}
+
+// viewable returns a filter keeping only the tickets a user may view, and whether the user may view every product, in which case callers may skip filtering.
+func viewable(user dsa.User) (func(ticket dsa.Ticket) bool, bool) {
+	hidden := make(map[int]bool)
+	for index := range *products {
+		if !productAllows(user, index, dsa.AccessView) {
+			hidden[index] = true
+		}
+	}
+	return func(ticket dsa.Ticket) bool { return !hidden[ticket.Product] }, len(hidden) == 0
+}
+
+// keepTickets returns the tickets for which keep returns true, in their original order.
+func keepTickets(tickets []dsa.Ticket, keep func(ticket dsa.Ticket) bool) []dsa.Ticket {
+	result := make([]dsa.Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if keep(ticket) {
+			result = append(result, ticket)
+		}
+	}
+	return result
+}
+
+// pageTickets returns up to size tickets of a slice starting from a given position, along with the length of the slice.
+func pageTickets(tickets []dsa.Ticket, from, size int) ([]dsa.Ticket, int) {
+	total := len(tickets)
+	from = min(max(from, 0), total)
+	return tickets[from:min(from+size, total)], total
+}
+
+// teamMembers returns the members of the team a ticket is assigned to, if any.
+func teamMembers(ticket dsa.Ticket) []string {
+	if ticket.Team == "" {
+		return nil
+	}
+	team, _ := teams.GetTeam(ticket.Team)
+	return team.Members
+}
+
+// unclaimed returns the tickets assigned to a team which none of its members has claimed yet, ordered by TicketID.
+func unclaimed(team string) []dsa.Ticket {
+	result := make([]dsa.Ticket, 0)
+	for _, ticket := range ticketindex.Team(team) {
+		if ticket.Assignee == "" {
+			result = append(result, ticket)
+		}
+	}
+	return result
+}
+
+// canWork reports whether a username belongs to a user whose role allows them to be assigned tickets.
+func canWork(username string) bool {
+	found, node := dsa.SearchUser(users, username)
+	return found && node.User.Can(dsa.WorkTickets)
+}
+
+// pageRequest reads the page number and page size asked for in a request's "page" and "size" parameters, falling back to the first page of defaultPageSize tickets.
+// Returns the position of the first ticket on the page, counting from 0, along with the page size.
+func pageRequest(req *http.Request) (int, int) {
+	size, err := strconv.Atoi(req.FormValue("size"))
+	if err != nil || size <= 0 {
+		size = defaultPageSize
+	} else if size > maxPageSize {
+		size = maxPageSize
+	}
+	page, err := strconv.Atoi(req.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return (page - 1) * size, size
+}
+
+// newPager describes the page of a ticket list starting at a given position, with links to the neighbouring pages which keep the request's other parameters.
+func newPager(req *http.Request, from, size, total int) pager {
+	p := pager{
+		Number: from/size + 1,
+		Count:  (total + size - 1) / size,
+		Total:  total,
+	}
+	if p.Count == 0 {
+		p.Count = 1
+	}
+	link := func(page int) string {
+		query := req.URL.Query()
+		query.Set("page", strconv.Itoa(page))
+		query.Set("size", strconv.Itoa(size))
+		return req.URL.Path + "?" + query.Encode()
+	}
+	if p.Number > 1 {
+		p.Prev = link(p.Number - 1)
+	}
+	if p.Number < p.Count {
+		p.Next = link(p.Number + 1)
+	}
+	return p
+}
+
+// printTickets returns the formatted prints of a slice of tickets, for passing into the relevant HTML template.
+func printTickets(tickets []dsa.Ticket) [][]string {
+	result := make([][]string, 0, len(tickets))
+	for _, ticket := range tickets {
+		result = append(result, dsa.PrintTicket(ticket, priorities, products, statuses, categories))
+	}
+	return result
+}
+
+// collectTickets appends every ticket in an AVL tree to result, in order.
+func collectTickets(avlroot *dsa.TicketNode, result []dsa.Ticket) []dsa.Ticket {
+	if avlroot == nil {
+		return result
+	}
+	result = collectTickets(avlroot.Left, result)
+	result = append(result, avlroot.Ticket)
+	result = collectTickets(avlroot.Right, result)
+	return result
 }